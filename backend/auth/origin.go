@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CookieName is the cookie that carries the auth token for cookie-based auth.
+const CookieName = "mt_auth"
+
+// CSRFHeader is the header that must echo CSRFToken on state-changing
+// requests authenticated by cookie.
+const CSRFHeader = "X-CSRF-Token"
+
+// allowedOrigins is the explicit list of browser origins that may call the
+// API or open the WebSocket. Set by InitOrigins.
+var allowedOrigins []string
+
+// InitOrigins loads the allowed origins from MT_ALLOWED_ORIGINS
+// (comma-separated, e.g. "http://localhost:5173,https://mt.example.test").
+// Without it, only the Vite dev server and the backend itself on localhost
+// and 127.0.0.1 are allowed.
+func InitOrigins(port string) {
+	allowedOrigins = nil
+	if env := os.Getenv("MT_ALLOWED_ORIGINS"); env != "" {
+		for _, origin := range strings.Split(env, ",") {
+			origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+			if origin != "" {
+				allowedOrigins = append(allowedOrigins, origin)
+			}
+		}
+	} else {
+		for _, host := range []string{"localhost", "127.0.0.1"} {
+			allowedOrigins = append(allowedOrigins,
+				"http://"+host+":5173",
+				"http://"+host+":"+port,
+				"https://"+host+":"+port,
+			)
+		}
+	}
+	log.Printf("Allowed origins: %s", strings.Join(allowedOrigins, ", "))
+}
+
+// AllowedOrigins returns the configured origin allow-list.
+func AllowedOrigins() []string {
+	return allowedOrigins
+}
+
+// OriginAllowed reports whether origin exactly matches an allowed origin.
+func OriginAllowed(origin string) bool {
+	origin = strings.TrimRight(origin, "/")
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOrigin returns the browser origin of a request: the Origin header,
+// falling back to the scheme and host of the Referer. Empty for non-browser
+// clients (curl, scripts), which send neither.
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		if u, err := url.Parse(referer); err == nil && u.Host != "" {
+			return u.Scheme + "://" + u.Host
+		}
+	}
+	return ""
+}
+
+// CheckOrigin validates the origin of a request (used for WebSocket
+// upgrades). Requests without an origin come from non-browser clients and
+// are allowed; rejected origins are logged.
+func CheckOrigin(r *http.Request) bool {
+	origin := requestOrigin(r)
+	if origin == "" || OriginAllowed(origin) {
+		return true
+	}
+	log.Printf("[Auth] Rejected %s %s from origin %q (allowed: %s; set MT_ALLOWED_ORIGINS to change)", r.Method, r.URL.Path, origin, strings.Join(allowedOrigins, ", "))
+	return false
+}
+
+// CSRFToken returns the CSRF token for this process, derived from the
+// startup auth token so it rotates with it.
+func CSRFToken() string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequestToken returns the auth token presented by a request and whether it
+// came from the cookie rather than an explicit header or query parameter.
+func RequestToken(r *http.Request) (string, bool) {
+	if t := r.Header.Get("X-Auth-Token"); t != "" {
+		return t, false
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer "), false
+	}
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t, false
+	}
+	if c, err := r.Cookie(CookieName); err == nil {
+		return c.Value, true
+	}
+	return "", false
+}
+
+// SetAuthCookie stores the auth token in an HttpOnly, SameSite=Strict
+// cookie for cookie-based auth.
+func SetAuthCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// isStateChanging reports whether the method can modify server state.
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// Protect is middleware that enforces the origin allow-list on
+// state-changing requests and requires a matching CSRF header when such a
+// request is authenticated only by the auth cookie.
+func Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isStateChanging(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !CheckOrigin(r) {
+			http.Error(w, `{"error": "origin not allowed"}`, http.StatusForbidden)
+			return
+		}
+
+		if candidate, viaCookie := RequestToken(r); viaCookie && Validate(candidate) {
+			csrf := r.Header.Get(CSRFHeader)
+			if subtle.ConstantTimeCompare([]byte(csrf), []byte(CSRFToken())) != 1 {
+				log.Printf("[Auth] Rejected %s %s from origin %q: missing or invalid CSRF token", r.Method, r.URL.Path, requestOrigin(r))
+				http.Error(w, `{"error": "invalid CSRF token"}`, http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireToken is middleware for endpoints that let scripts drive the app
+// (such as typing into terminals): the request must carry the auth token,
+// whatever its origin.
+func RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		candidate, _ := RequestToken(r)
+		if !Validate(candidate) {
+			http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
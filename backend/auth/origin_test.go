@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ---- Origin allow-list tests ----
+
+func TestInitOrigins_DefaultsAndEnv(t *testing.T) {
+	t.Setenv("MT_ALLOWED_ORIGINS", "")
+	InitOrigins("8130")
+	for _, origin := range []string{"http://localhost:5173", "http://127.0.0.1:8130", "https://localhost:8130", "http://localhost:5173/"} {
+		if !OriginAllowed(origin) {
+			t.Errorf("default origins reject %s", origin)
+		}
+	}
+	for _, origin := range []string{"http://localhost:5174", "http://evil.test", "http://localhost:8130.evil.test"} {
+		if OriginAllowed(origin) {
+			t.Errorf("default origins allow %s", origin)
+		}
+	}
+
+	t.Setenv("MT_ALLOWED_ORIGINS", " http://localhost:5174/ , https://mt.example.test")
+	InitOrigins("8130")
+	if !OriginAllowed("http://localhost:5174") || !OriginAllowed("https://mt.example.test") {
+		t.Errorf("MT_ALLOWED_ORIGINS not applied: %v", AllowedOrigins())
+	}
+	if OriginAllowed("http://localhost:5173") {
+		t.Error("MT_ALLOWED_ORIGINS should replace the defaults")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	t.Setenv("MT_ALLOWED_ORIGINS", "")
+	InitOrigins("8130")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no origin (non-browser client)", nil, true},
+		{"allowed origin", map[string]string{"Origin": "http://localhost:5173"}, true},
+		{"other origin", map[string]string{"Origin": "http://evil.test"}, false},
+		{"referer fallback allowed", map[string]string{"Referer": "http://localhost:5173/some/page"}, true},
+		{"referer fallback rejected", map[string]string{"Referer": "http://evil.test/page"}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := CheckOrigin(r); got != tt.want {
+			t.Errorf("%s: CheckOrigin = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ---- Protect / RequireToken tests ----
+
+func TestProtect(t *testing.T) {
+	t.Setenv("MT_ALLOWED_ORIGINS", "")
+	InitOrigins("8130")
+	token = "test-token"
+	defer func() { token = "" }()
+
+	handler := Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		cookie  string
+		headers map[string]string
+		want    int
+	}{
+		{"GET from any origin", http.MethodGet, "http://evil.test", "", nil, http.StatusOK},
+		{"POST from other origin", http.MethodPost, "http://evil.test", "", map[string]string{"X-Auth-Token": "test-token"}, http.StatusForbidden},
+		{"POST without origin", http.MethodPost, "", "", nil, http.StatusOK},
+		{"POST with cookie, no CSRF header", http.MethodPost, "http://localhost:5173", "test-token", nil, http.StatusForbidden},
+		{"POST with cookie, wrong CSRF header", http.MethodPost, "http://localhost:5173", "test-token", map[string]string{CSRFHeader: "nope"}, http.StatusForbidden},
+		{"POST with cookie and CSRF header", http.MethodPost, "http://localhost:5173", "test-token", map[string]string{CSRFHeader: CSRFToken()}, http.StatusOK},
+		{"POST with header token", http.MethodPost, "http://localhost:5173", "", map[string]string{"X-Auth-Token": "test-token"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/exec", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	token = "test-token"
+	defer func() { token = "" }()
+
+	handler := RequireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name string
+		set  func(r *http.Request)
+		want int
+	}{
+		{"no token", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong token", func(r *http.Request) { r.Header.Set("X-Auth-Token", "nope") }, http.StatusUnauthorized},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer test-token") }, http.StatusOK},
+		{"header token", func(r *http.Request) { r.Header.Set("X-Auth-Token", "test-token") }, http.StatusOK},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: CookieName, Value: "test-token"}) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/exec", nil)
+		tt.set(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+
+	"markdown-themes-backend/utils"
 )
 
 const (
@@ -17,9 +22,14 @@ const (
 // token holds the generated auth token for this process.
 var token string
 
+// signingKey is the persistent HMAC secret used to sign URLs (share links).
+// Unlike token it survives restarts so signed links stay valid.
+var signingKey []byte
+
 // Init generates a cryptographically random auth token, stores it in
 // memory, and writes it to TokenFile with mode 0600 so only the current
-// user can read it. Call once at startup.
+// user can read it. It also loads (or creates) the URL signing key.
+// Call once at startup.
 func Init() error {
 	b := make([]byte, tokenBytes)
 	if _, err := rand.Read(b); err != nil {
@@ -31,9 +41,55 @@ func Init() error {
 		return fmt.Errorf("write token file: %w", err)
 	}
 	log.Printf("Auth token written to %s", TokenFile)
+
+	key, err := loadSigningKey()
+	if err != nil {
+		return fmt.Errorf("signing key: %w", err)
+	}
+	signingKey = key
 	return nil
 }
 
+func signingKeyPath() string {
+	return filepath.Join(utils.DataDir(), "signing.key")
+}
+
+// loadSigningKey reads the signing key, generating a new 0600 key file on
+// first run.
+func loadSigningKey() ([]byte, error) {
+	path := signingKeyPath()
+	if data, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(string(data)); err == nil && len(key) == tokenBytes {
+			return key, nil
+		}
+		log.Printf("Warning: signing key at %s is malformed, regenerating", path)
+	}
+
+	key := make([]byte, tokenBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("crypto/rand: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of message under the signing key.
+func Sign(message string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature performs a constant-time check of sig against Sign(message).
+func VerifySignature(message, sig string) bool {
+	return hmac.Equal([]byte(Sign(message)), []byte(sig))
+}
+
 // Token returns the in-memory auth token generated at startup.
 func Token() string {
 	return token
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"markdown-themes-backend/auth"
+	"markdown-themes-backend/utils"
+)
+
+// --- CLI companion ---
+//
+// Run with arguments, the binary is a client of the running server rather
+// than a server (symlink it as `mt`):
+//
+//	mt open README.md:40    open a file in the viewer, like `code`
+//
+// It finds the server from the same environment the server reads (PORT,
+// BIND_ADDR, UNIX_SOCKET, TLS...) and authenticates with the token in
+// auth.TokenFile. Run in an app terminal, MDT_SESSION_ID sends the file
+// to the clients viewing that terminal.
+
+const cliUsage = `Usage: mt <command> [arguments]
+
+Commands:
+  open FILE[:LINE[:COL]]...   open files in the markdown-themes viewer
+`
+
+// runCommand runs a CLI subcommand and returns the exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "open":
+		return cliOpen(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "mt: unknown command %q\n\n%s", args[0], cliUsage)
+	return 2
+}
+
+// cliOpen opens files in the running app's viewer.
+func cliOpen(targets []string) int {
+	if len(targets) == 0 {
+		fmt.Fprint(os.Stderr, "mt open: no file given\n\n"+cliUsage)
+		return 2
+	}
+	client, base, err := serverClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mt open: %v\n", err)
+		return 1
+	}
+	token, err := os.ReadFile(auth.TokenFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mt open: no auth token at %s (is the server running?)\n", auth.TokenFile)
+		return 1
+	}
+	cwd, _ := os.Getwd()
+
+	status := 0
+	for _, target := range targets {
+		body, _ := json.Marshal(map[string]string{
+			"target":    target,
+			"cwd":       cwd,
+			"sessionId": os.Getenv("MDT_SESSION_ID"),
+		})
+		req, _ := http.NewRequest(http.MethodPost, base+"/api/open", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		if err := cliDo(client, req); err != nil {
+			fmt.Fprintf(os.Stderr, "mt open: %s: %v\n", target, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// cliDo sends a request, turning an error response into an error.
+func cliDo(client *http.Client, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	data, _ := io.ReadAll(res.Body)
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		return fmt.Errorf("%s", body.Error)
+	}
+	return fmt.Errorf("server returned %s", res.Status)
+}
+
+// serverClient returns an HTTP client and base URL for the running server:
+// its Unix socket if it has one, or its TCP listener (trusting its TLS
+// certificate).
+func serverClient() (*http.Client, string, error) {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8130"
+	}
+	cfg, err := loadListenConfig(port)
+	if err != nil {
+		return nil, "", err
+	}
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	if cfg.UnixSocket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+		return client, "http://unix", nil
+	}
+
+	host := cfg.BindAddr
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	if cfg.TLS {
+		certFile := cfg.TLSCert
+		if certFile == "" {
+			certFile = filepath.Join(utils.DataDir(), "tls", "cert.pem")
+		}
+		pem, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, "", fmt.Errorf("no certificate in %s", certFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return client, fmt.Sprintf("%s://%s", cfg.scheme(), net.JoinHostPort(host, port)), nil
+}
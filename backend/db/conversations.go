@@ -11,6 +11,8 @@ import (
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"markdown-themes-backend/utils"
 )
 
 // DB is the global database instance
@@ -105,12 +107,7 @@ func Get() *sql.DB {
 
 func getDBPath() string {
 	// Use XDG data home or fallback to ~/.local/share
-	dataHome := os.Getenv("XDG_DATA_HOME")
-	if dataHome == "" {
-		home, _ := os.UserHomeDir()
-		dataHome = filepath.Join(home, ".local", "share")
-	}
-	return filepath.Join(dataHome, "markdown-themes", "conversations.db")
+	return filepath.Join(utils.DataDir(), "conversations.db")
 }
 
 func createTables(db *sql.DB) error {
@@ -144,6 +141,49 @@ func createTables(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
+
+	CREATE TABLE IF NOT EXISTS shares (
+		id TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		is_dir INTEGER NOT NULL DEFAULT 0,
+		note TEXT,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		revoked_at INTEGER,
+		access_count INTEGER NOT NULL DEFAULT 0,
+		last_accessed_at INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_shares_expires_at ON shares(expires_at);
+
+	CREATE TABLE IF NOT EXISTS terminal_sessions (
+		id TEXT PRIMARY KEY,
+		tmux_session TEXT NOT NULL,
+		profile_id TEXT,
+		profile_name TEXT,
+		command TEXT,
+		cwd TEXT,
+		title TEXT,
+		tab_order INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		last_attached_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS terminal_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		terminal_id TEXT NOT NULL,
+		profile_id TEXT,
+		profile_name TEXT,
+		command TEXT NOT NULL,
+		cwd TEXT,
+		source TEXT NOT NULL,
+		started_at INTEGER NOT NULL,
+		finished_at INTEGER,
+		exit_code INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_terminal_audit_started_at ON terminal_audit(started_at);
+	CREATE INDEX IF NOT EXISTS idx_terminal_audit_terminal_id ON terminal_audit(terminal_id);
 	`
 
 	_, err := db.Exec(schema)
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Share is a signed, expiring read-only link to a file or directory.
+type Share struct {
+	ID             string `json:"id"`
+	Path           string `json:"path"`
+	IsDir          bool   `json:"isDir"`
+	Note           string `json:"note,omitempty"`
+	CreatedAt      int64  `json:"createdAt"`
+	ExpiresAt      int64  `json:"expiresAt"`
+	RevokedAt      *int64 `json:"revokedAt,omitempty"`
+	AccessCount    int    `json:"accessCount"`
+	LastAccessedAt *int64 `json:"lastAccessedAt,omitempty"`
+}
+
+// Active reports whether the share is neither revoked nor expired.
+func (s *Share) Active() bool {
+	return s.RevokedAt == nil && time.Now().UnixMilli() < s.ExpiresAt
+}
+
+const shareColumns = `id, path, is_dir, note, created_at, expires_at, revoked_at, access_count, last_accessed_at`
+
+func scanShare(scanner interface{ Scan(...interface{}) error }) (*Share, error) {
+	var s Share
+	var isDir int
+	var note sql.NullString
+	var revokedAt, lastAccessedAt sql.NullInt64
+
+	if err := scanner.Scan(&s.ID, &s.Path, &isDir, &note, &s.CreatedAt, &s.ExpiresAt,
+		&revokedAt, &s.AccessCount, &lastAccessedAt); err != nil {
+		return nil, err
+	}
+
+	s.IsDir = isDir != 0
+	if note.Valid {
+		s.Note = note.String
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Int64
+	}
+	if lastAccessedAt.Valid {
+		s.LastAccessedAt = &lastAccessedAt.Int64
+	}
+	return &s, nil
+}
+
+// CreateShare stores a new share record
+func CreateShare(s *Share) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if s.CreatedAt == 0 {
+		s.CreatedAt = time.Now().UnixMilli()
+	}
+	isDir := 0
+	if s.IsDir {
+		isDir = 1
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO shares (id, path, is_dir, note, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, s.ID, s.Path, isDir, nullString(s.Note), s.CreatedAt, s.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share: %w", err)
+	}
+	return nil
+}
+
+// GetShare returns a share by ID (nil if not found)
+func GetShare(id string) (*Share, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	s, err := scanShare(db.QueryRow(`SELECT `+shareColumns+` FROM shares WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return s, nil
+}
+
+// ListActiveShares returns unrevoked, unexpired shares, newest first
+func ListActiveShares() ([]Share, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query(`
+		SELECT `+shareColumns+` FROM shares
+		WHERE revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC
+	`, time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, *s)
+	}
+	return shares, nil
+}
+
+// RevokeShare marks a share as revoked
+func RevokeShare(id string) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec(`UPDATE shares SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		time.Now().UnixMilli(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+// RecordShareAccess bumps the access counter for a share
+func RecordShareAccess(id string) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`UPDATE shares SET access_count = access_count + 1, last_accessed_at = ? WHERE id = ?`,
+		time.Now().UnixMilli(), id)
+	return err
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Audit entry sources
+const (
+	AuditSourceShell = "shell" // reported by shell integration (OSC 133)
+	AuditSourceInput = "input" // a line typed at the prompt, without integration
+)
+
+// AuditEntry is a command run in an app terminal.
+type AuditEntry struct {
+	ID          int64  `json:"id"`
+	TerminalID  string `json:"terminalId"`
+	ProfileID   string `json:"profileId,omitempty"`
+	ProfileName string `json:"profileName,omitempty"`
+	Command     string `json:"command"`
+	Cwd         string `json:"cwd,omitempty"`
+	Source      string `json:"source"`
+	StartedAt   int64  `json:"startedAt"`
+	FinishedAt  *int64 `json:"finishedAt,omitempty"`
+	ExitCode    *int   `json:"exitCode,omitempty"`
+}
+
+// AuditQuery filters audit entries. Zero values don't filter.
+type AuditQuery struct {
+	Text       string // substring of the command or cwd
+	TerminalID string
+	Profile    string // profile ID or name
+	Since      int64  // started at or after (ms)
+	Until      int64  // started before (ms)
+	Failed     bool   // non-zero exit code only
+	Before     int64  // entries with a lower ID, for paging
+	Limit      int
+}
+
+const auditColumns = `id, terminal_id, profile_id, profile_name, command, cwd, source, started_at, finished_at, exit_code`
+
+func scanAuditEntry(scanner interface{ Scan(...interface{}) error }) (*AuditEntry, error) {
+	var e AuditEntry
+	var profileID, profileName, cwd sql.NullString
+	var finishedAt, exitCode sql.NullInt64
+
+	if err := scanner.Scan(&e.ID, &e.TerminalID, &profileID, &profileName, &e.Command, &cwd,
+		&e.Source, &e.StartedAt, &finishedAt, &exitCode); err != nil {
+		return nil, err
+	}
+
+	e.ProfileID = profileID.String
+	e.ProfileName = profileName.String
+	e.Cwd = cwd.String
+	if finishedAt.Valid {
+		e.FinishedAt = &finishedAt.Int64
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		e.ExitCode = &code
+	}
+	return &e, nil
+}
+
+// InsertAuditEntry stores a command and sets its ID
+func InsertAuditEntry(e *AuditEntry) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if e.StartedAt == 0 {
+		e.StartedAt = time.Now().UnixMilli()
+	}
+	res, err := db.Exec(`
+		INSERT INTO terminal_audit (terminal_id, profile_id, profile_name, command, cwd, source, started_at, finished_at, exit_code)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.TerminalID, nullString(e.ProfileID), nullString(e.ProfileName), e.Command, nullString(e.Cwd),
+		e.Source, e.StartedAt, e.FinishedAt, e.ExitCode)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	e.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// FinishAuditEntry records when a command finished and its exit code (nil
+// if unknown)
+func FinishAuditEntry(id int64, finishedAt int64, exitCode *int) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`UPDATE terminal_audit SET finished_at = ?, exit_code = ? WHERE id = ?`, finishedAt, exitCode, id)
+	if err != nil {
+		return fmt.Errorf("failed to finish audit entry: %w", err)
+	}
+	return nil
+}
+
+// DeleteAuditEntry removes an entry
+func DeleteAuditEntry(id int64) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := db.Exec(`DELETE FROM terminal_audit WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete audit entry: %w", err)
+	}
+	return nil
+}
+
+// SearchAuditEntries returns matching entries, newest first
+func SearchAuditEntries(q AuditQuery) ([]AuditEntry, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var where []string
+	var args []interface{}
+	if q.Text != "" {
+		pattern := "%" + likeEscaper.Replace(q.Text) + "%"
+		where = append(where, `(command LIKE ? ESCAPE '\' OR cwd LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if q.TerminalID != "" {
+		where = append(where, `terminal_id = ?`)
+		args = append(args, q.TerminalID)
+	}
+	if q.Profile != "" {
+		where = append(where, `(profile_id = ? OR profile_name = ?)`)
+		args = append(args, q.Profile, q.Profile)
+	}
+	if q.Since > 0 {
+		where = append(where, `started_at >= ?`)
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		where = append(where, `started_at < ?`)
+		args = append(args, q.Until)
+	}
+	if q.Failed {
+		where = append(where, `exit_code IS NOT NULL AND exit_code != 0`)
+	}
+	if q.Before > 0 {
+		where = append(where, `id < ?`)
+		args = append(args, q.Before)
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM terminal_audit`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+// likeEscaper escapes LIKE wildcards for ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// PruneAuditEntries deletes entries started before olderThan (ms, 0 to
+// keep all) and all but the newest keep entries (0 for no limit),
+// returning how many were deleted
+func PruneAuditEntries(olderThan int64, keep int) (int64, error) {
+	db := Get()
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	var deleted int64
+	if olderThan > 0 {
+		res, err := db.Exec(`DELETE FROM terminal_audit WHERE started_at < ?`, olderThan)
+		if err != nil {
+			return 0, fmt.Errorf("failed to prune audit log: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	if keep > 0 {
+		res, err := db.Exec(`
+			DELETE FROM terminal_audit
+			WHERE id <= (SELECT id FROM terminal_audit ORDER BY id DESC LIMIT 1 OFFSET ?)
+		`, keep)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to prune audit log: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TerminalSessionRecord is the persisted metadata of a tmux-backed terminal,
+// kept so sessions can be restored faithfully after a backend restart.
+type TerminalSessionRecord struct {
+	ID             string `json:"id"`
+	TmuxSession    string `json:"tmuxSession"`
+	ProfileID      string `json:"profileId,omitempty"`
+	ProfileName    string `json:"profileName,omitempty"`
+	Command        string `json:"command,omitempty"`
+	Cwd            string `json:"cwd,omitempty"`
+	Title          string `json:"title,omitempty"`
+	TabOrder       int    `json:"tabOrder"`
+	CreatedAt      int64  `json:"createdAt"`
+	LastAttachedAt *int64 `json:"lastAttachedAt,omitempty"`
+}
+
+const terminalSessionColumns = `id, tmux_session, profile_id, profile_name, command, cwd, title, tab_order, created_at, last_attached_at`
+
+func scanTerminalSession(scanner interface{ Scan(...interface{}) error }) (*TerminalSessionRecord, error) {
+	var s TerminalSessionRecord
+	var profileID, profileName, command, cwd, title sql.NullString
+	var lastAttachedAt sql.NullInt64
+
+	if err := scanner.Scan(&s.ID, &s.TmuxSession, &profileID, &profileName, &command, &cwd, &title,
+		&s.TabOrder, &s.CreatedAt, &lastAttachedAt); err != nil {
+		return nil, err
+	}
+
+	s.ProfileID = profileID.String
+	s.ProfileName = profileName.String
+	s.Command = command.String
+	s.Cwd = cwd.String
+	s.Title = title.String
+	if lastAttachedAt.Valid {
+		s.LastAttachedAt = &lastAttachedAt.Int64
+	}
+	return &s, nil
+}
+
+// SaveTerminalSession inserts or replaces a terminal session record
+func SaveTerminalSession(s *TerminalSessionRecord) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if s.CreatedAt == 0 {
+		s.CreatedAt = time.Now().UnixMilli()
+	}
+	var lastAttachedAt interface{}
+	if s.LastAttachedAt != nil {
+		lastAttachedAt = *s.LastAttachedAt
+	}
+
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO terminal_sessions (`+terminalSessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.ID, s.TmuxSession, nullString(s.ProfileID), nullString(s.ProfileName), nullString(s.Command),
+		nullString(s.Cwd), nullString(s.Title), s.TabOrder, s.CreatedAt, lastAttachedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save terminal session: %w", err)
+	}
+	return nil
+}
+
+// GetTerminalSession returns a terminal session record by ID (nil if not found)
+func GetTerminalSession(id string) (*TerminalSessionRecord, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	s, err := scanTerminalSession(db.QueryRow(`SELECT `+terminalSessionColumns+` FROM terminal_sessions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terminal session: %w", err)
+	}
+	return s, nil
+}
+
+// ListTerminalSessions returns all terminal session records in tab order
+func ListTerminalSessions() ([]TerminalSessionRecord, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query(`SELECT ` + terminalSessionColumns + ` FROM terminal_sessions ORDER BY tab_order, created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list terminal sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []TerminalSessionRecord{}
+	for rows.Next() {
+		s, err := scanTerminalSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan terminal session: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, nil
+}
+
+// TouchTerminalSession records that a client attached to the session
+func TouchTerminalSession(id string, at time.Time) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`UPDATE terminal_sessions SET last_attached_at = ? WHERE id = ?`, at.UnixMilli(), id)
+	if err != nil {
+		return fmt.Errorf("failed to touch terminal session: %w", err)
+	}
+	return nil
+}
+
+// UpdateTerminalSessionMeta updates the title and/or tab order of a session.
+// Nil arguments are left unchanged.
+func UpdateTerminalSessionMeta(id string, title *string, tabOrder *int) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`
+		UPDATE terminal_sessions
+		SET title = COALESCE(?, title), tab_order = COALESCE(?, tab_order)
+		WHERE id = ?
+	`, title, tabOrder, id)
+	if err != nil {
+		return fmt.Errorf("failed to update terminal session: %w", err)
+	}
+	return nil
+}
+
+// DeleteTerminalSession removes a terminal session record
+func DeleteTerminalSession(id string) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := db.Exec(`DELETE FROM terminal_sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete terminal session: %w", err)
+	}
+	return nil
+}
@@ -9,9 +9,7 @@ require (
 	github.com/go-chi/cors v1.2.1
 	github.com/gorilla/websocket v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/sys v0.13.0
 )
 
-require (
-	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
-)
+require golang.org/x/net v0.17.0 // indirect
@@ -53,16 +53,23 @@ func BeadsIssues(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jsonlPath := filepath.Join(filepath.Clean(path), ".beads", "issues.jsonl")
+	issues := LoadBeadsIssues(filepath.Clean(path))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issues": issues,
+		"count":  len(issues),
+	})
+}
+
+// LoadBeadsIssues reads {path}/.beads/issues.jsonl and returns its issues,
+// newest first. A missing file yields an empty slice.
+func LoadBeadsIssues(path string) []BeadsIssue {
+	jsonlPath := filepath.Join(path, ".beads", "issues.jsonl")
 
 	f, err := os.Open(jsonlPath)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"issues": []BeadsIssue{},
-			"count":  0,
-		})
-		return
+		return []BeadsIssue{}
 	}
 	defer f.Close()
 
@@ -91,10 +98,5 @@ func BeadsIssues(w http.ResponseWriter, r *http.Request) {
 	if issues == nil {
 		issues = []BeadsIssue{}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"issues": issues,
-		"count":  len(issues),
-	})
+	return issues
 }
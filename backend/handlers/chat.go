@@ -40,6 +40,7 @@ type BufferedEvent struct {
 
 // ConversationBuffer stores SSE events for a single conversation
 type ConversationBuffer struct {
+	convID    string
 	mu        sync.RWMutex
 	events    []BufferedEvent
 	nextID    int64
@@ -68,7 +69,7 @@ func getOrCreateBuffer(convID string) *ConversationBuffer {
 		return buf
 	}
 
-	buf := &ConversationBuffer{}
+	buf := &ConversationBuffer{convID: convID}
 	conversationBuffers[convID] = buf
 	return buf
 }
@@ -78,7 +79,7 @@ func resetBuffer(convID string) *ConversationBuffer {
 	bufferMu.Lock()
 	defer bufferMu.Unlock()
 
-	buf := &ConversationBuffer{}
+	buf := &ConversationBuffer{convID: convID}
 	conversationBuffers[convID] = buf
 	return buf
 }
@@ -91,21 +92,23 @@ func getBuffer(convID string) *ConversationBuffer {
 }
 
 // appendEvent adds an event to the buffer and returns the assigned event ID.
-// If the buffer is at capacity, the oldest event is evicted.
+// If the buffer is at capacity, the oldest event is evicted. The event is
+// also published to "chat:{conversationId}" subscribers.
 func (b *ConversationBuffer) appendEvent(data map[string]interface{}) int64 {
 	b.mu.Lock()
-	defer b.mu.Unlock()
-
 	id := b.nextID
 	b.nextID++
 
-	b.events = append(b.events, BufferedEvent{ID: id, Data: data})
+	ev := BufferedEvent{ID: id, Data: data}
+	b.events = append(b.events, ev)
 
 	// Evict oldest events if over capacity
 	if len(b.events) > maxEventsPerBuffer {
 		b.events = b.events[len(b.events)-maxEventsPerBuffer:]
 	}
+	b.mu.Unlock()
 
+	publishEvent("chat:"+b.convID, ev)
 	return id
 }
 
@@ -126,9 +129,50 @@ func (b *ConversationBuffer) eventsAfter(afterID int64) []BufferedEvent {
 // markCompleted marks the buffer as completed and schedules expiry
 func (b *ConversationBuffer) markCompleted() {
 	b.mu.Lock()
-	defer b.mu.Unlock()
 	b.completed = true
 	b.expiresAt = time.Now().Add(bufferExpiryAfter)
+	b.mu.Unlock()
+
+	publishEvent("chat:"+b.convID, map[string]interface{}{
+		"type":           "stream-complete",
+		"conversationId": b.convID,
+	})
+}
+
+// SubscribeChatEvents subscribes fn to a conversation's stream events and
+// returns the events buffered so far and whether the stream finished. The
+// snapshot and the subscription are taken together, so fn only gets events
+// the snapshot doesn't contain.
+func SubscribeChatEvents(convID string, fn func(data interface{})) (events []BufferedEvent, completed bool, unsubscribe func()) {
+	bufferMu.RLock()
+	defer bufferMu.RUnlock()
+	buf := conversationBuffers[convID]
+	if buf == nil {
+		return nil, false, SubscribeEvents("chat:"+convID, fn)
+	}
+
+	buf.mu.RLock()
+	defer buf.mu.RUnlock()
+	lastID := int64(-1)
+	for _, ev := range buf.events {
+		events = append(events, ev)
+		lastID = ev.ID
+	}
+	completed = buf.completed
+	// Events are published after the buffer lock is released: drop the
+	// ones already in the snapshot (unless a new turn replaced the buffer)
+	unsubscribe = SubscribeEvents("chat:"+convID, func(data interface{}) {
+		if getBuffer(convID) == buf {
+			if ev, ok := data.(BufferedEvent); ok && ev.ID <= lastID {
+				return
+			}
+			if _, ok := data.(map[string]interface{}); ok && completed {
+				return // stream-complete
+			}
+		}
+		fn(data)
+	})
+	return events, completed, unsubscribe
 }
 
 // isExpired returns true if the buffer has completed and passed its expiry time
@@ -302,7 +346,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "--resume", req.ClaudeSessionID)
 	}
 
-	cmd := exec.Command("claude", args...)
+	cmd := processCommand(ProcChat, "claude", args...)
 
 	// Set working directory if provided
 	if req.Cwd != "" {
@@ -337,14 +381,10 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	proc := &ActiveProcess{
-		Cmd:            cmd,
+		Cmd:            cmd.Cmd,
 		ConversationID: convID,
 		StartedAt:      time.Now(),
-		cancel: func() {
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
-		},
+		cancel:         cmd.Terminate,
 	}
 
 	processMu.Lock()
@@ -643,7 +683,9 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 		// Wait for process to finish
 		if err := cmd.Wait(); err != nil {
 			errMsg := stderrOutput.String()
-			if errMsg == "" {
+			if cmd.TimedOut() {
+				errMsg = "Claude CLI timed out"
+			} else if errMsg == "" {
 				errMsg = err.Error()
 			}
 			log.Printf("[Chat] Claude process exited with error: %s (stderr: %s)", err, errMsg)
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,62 +30,14 @@ func ClaudeSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find the most recently modified .jsonl conversation file
-	var bestSession *models.ClaudeSessionInfo
-	var bestModTime time.Time
-
-	// Walk through project directories
-	projectEntries, err := os.ReadDir(claudeProjectsDir)
+	sessions, err := RecentClaudeSessions(30 * time.Minute)
 	if err != nil {
 		http.Error(w, `{"error": "cannot read Claude projects directory"}`, http.StatusInternalServerError)
 		return
 	}
-
-	for _, projectEntry := range projectEntries {
-		if !projectEntry.IsDir() {
-			continue
-		}
-
-		projectDir := filepath.Join(claudeProjectsDir, projectEntry.Name())
-
-		// Look for .jsonl files directly in the project directory
-		// Claude Code stores conversations as {sessionId}.jsonl
-		entries, err := os.ReadDir(projectDir)
-		if err != nil {
-			continue
-		}
-
-		for _, entry := range entries {
-			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
-				continue
-			}
-
-			filePath := filepath.Join(projectDir, entry.Name())
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-
-			modTime := info.ModTime()
-
-			// Only consider files modified in the last 30 minutes as potentially active
-			if time.Since(modTime) > 30*time.Minute {
-				continue
-			}
-
-			if bestSession == nil || modTime.After(bestModTime) {
-				sessionID := strings.TrimSuffix(entry.Name(), ".jsonl")
-				workingDir := decodeProjectPath(projectEntry.Name())
-
-				bestSession = &models.ClaudeSessionInfo{
-					SessionID:        sessionID,
-					WorkingDir:       workingDir,
-					ConversationPath: filePath,
-					Pane:             "",
-					Status:           "active",
-				}
-				bestModTime = modTime
-			}
-		}
+	var bestSession *models.ClaudeSessionInfo
+	if len(sessions) > 0 {
+		bestSession = &sessions[0].ClaudeSessionInfo
 	}
 
 	if bestSession == nil {
@@ -142,6 +95,80 @@ func ClaudeSessionByID(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, `{"error": "session not found"}`, http.StatusNotFound)
 }
 
+// ClaudeProjectsDir returns ~/.claude/projects, where Claude Code stores
+// conversations as {project}/{sessionId}.jsonl.
+func ClaudeProjectsDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".claude", "projects")
+}
+
+// RecentClaudeSession is a Claude conversation file with its last write time.
+type RecentClaudeSession struct {
+	models.ClaudeSessionInfo
+	Modified time.Time `json:"modified"`
+}
+
+// RecentClaudeSessions scans ~/.claude/projects for conversation .jsonl files
+// modified within the given window, most recently modified first.
+func RecentClaudeSessions(within time.Duration) ([]RecentClaudeSession, error) {
+	claudeProjectsDir := ClaudeProjectsDir()
+
+	// Walk through project directories
+	projectEntries, err := os.ReadDir(claudeProjectsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []RecentClaudeSession{}
+	for _, projectEntry := range projectEntries {
+		if !projectEntry.IsDir() {
+			continue
+		}
+
+		projectDir := filepath.Join(claudeProjectsDir, projectEntry.Name())
+
+		// Look for .jsonl files directly in the project directory
+		// Claude Code stores conversations as {sessionId}.jsonl
+		entries, err := os.ReadDir(projectDir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			// Only consider recently modified files as potentially active
+			modTime := info.ModTime()
+			if time.Since(modTime) > within {
+				continue
+			}
+
+			sessions = append(sessions, RecentClaudeSession{
+				ClaudeSessionInfo: models.ClaudeSessionInfo{
+					SessionID:        strings.TrimSuffix(entry.Name(), ".jsonl"),
+					WorkingDir:       decodeProjectPath(projectEntry.Name()),
+					ConversationPath: filepath.Join(projectDir, entry.Name()),
+					Pane:             "",
+					Status:           "active",
+				},
+				Modified: modTime,
+			})
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Modified.After(sessions[j].Modified)
+	})
+	return sessions, nil
+}
+
 // decodeProjectPath converts the encoded directory name back to a filesystem path.
 // e.g., "-home-user-projects-myapp" -> "/home/user/projects/myapp"
 func decodeProjectPath(encoded string) string {
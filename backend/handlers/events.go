@@ -0,0 +1,57 @@
+package handlers
+
+import "sync"
+
+// Server-side event hooks. Long-running producers in this package (chat
+// streams, task runners) publish events under a key such as
+// "chat:{conversationId}"; the WebSocket hub subscribes to those keys to
+// push them to clients without HTTP polling.
+
+var (
+	eventSubscribers   = make(map[string]map[int]func(data interface{}))
+	eventSubscriberSeq int
+	eventMu            sync.RWMutex
+)
+
+// SubscribeEvents registers fn to receive every event published under key.
+// It returns a function that removes the subscription.
+func SubscribeEvents(key string, fn func(data interface{})) func() {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	eventSubscriberSeq++
+	id := eventSubscriberSeq
+	if eventSubscribers[key] == nil {
+		eventSubscribers[key] = make(map[int]func(data interface{}))
+	}
+	eventSubscribers[key][id] = fn
+
+	return func() {
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		delete(eventSubscribers[key], id)
+		if len(eventSubscribers[key]) == 0 {
+			delete(eventSubscribers, key)
+		}
+	}
+}
+
+// publishEvent delivers data to all subscribers of key. Subscribers are
+// called synchronously, outside the registry lock.
+func publishEvent(key string, data interface{}) {
+	eventMu.RLock()
+	subs := eventSubscribers[key]
+	if len(subs) == 0 {
+		eventMu.RUnlock()
+		return
+	}
+	fns := make([]func(data interface{}), 0, len(subs))
+	for _, fn := range subs {
+		fns = append(fns, fn)
+	}
+	eventMu.RUnlock()
+
+	for _, fn := range fns {
+		fn(data)
+	}
+}
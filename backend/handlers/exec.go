@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Non-interactive command runner. Runs a command or script to completion,
+// streaming stdout and stderr as separate event channels (SSE here, or the
+// "exec:{runId}" WebSocket topic) and reporting the exit code and duration.
+
+// ExecRequest describes a command to run.
+type ExecRequest struct {
+	Command     string            `json:"command,omitempty"`     // run with the user's shell (-c)
+	Script      string            `json:"script,omitempty"`      // written to a temp file and run with Interpreter
+	Interpreter string            `json:"interpreter,omitempty"` // e.g. "bash", "python3", "node" (default: shell)
+	Cwd         string            `json:"cwd,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Stdin       string            `json:"stdin,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"`   // seconds (default 300, max 3600)
+	Workspace   string            `json:"workspace,omitempty"` // history bucket (default: cwd)
+}
+
+// ExecRun is the status of one run.
+type ExecRun struct {
+	ID          string `json:"id"`
+	Workspace   string `json:"workspace"`
+	Command     string `json:"command"`
+	Interpreter string `json:"interpreter,omitempty"`
+	Cwd         string `json:"cwd"`
+	Status      string `json:"status"` // running, exited, failed, cancelled, timeout
+	ExitCode    *int   `json:"exitCode,omitempty"`
+	Error       string `json:"error,omitempty"`
+	StartedAt   int64  `json:"startedAt"` // Unix ms
+	EndedAt     int64  `json:"endedAt,omitempty"`
+	DurationMs  int64  `json:"durationMs,omitempty"`
+	StdoutBytes int64  `json:"stdoutBytes"`
+	StderrBytes int64  `json:"stderrBytes"`
+	Truncated   bool   `json:"truncated,omitempty"`
+}
+
+const (
+	defaultExecTimeout    = 5 * time.Minute
+	maxExecTimeout        = time.Hour
+	maxExecBufferedBytes  = 4 * 1024 * 1024 // output kept per run for replay
+	maxExecRunsPerSpace   = 50
+	execKillGrace         = 3 * time.Second
+	execScriptFilePattern = "mt-exec-*"
+)
+
+// execRun is a run plus its buffered events.
+type execRun struct {
+	info     ExecRun
+	events   []BufferedEvent
+	nextID   int64
+	buffered int64
+	done     chan struct{}
+	cancel   context.CancelFunc
+	// cancelled is set when the run was cancelled by a client (vs. timeout)
+	cancelled bool
+	mu        sync.RWMutex
+}
+
+var (
+	execRuns        = make(map[string]*execRun) // runId → run
+	execByWorkspace = make(map[string][]string) // workspace → runIds, oldest first
+	execMu          sync.RWMutex
+)
+
+// appendEvent buffers an event and publishes it to "exec:{runId}" subscribers.
+// Output beyond maxExecBufferedBytes is dropped from the buffer but the run
+// is marked truncated so clients know the replay is incomplete.
+func (r *execRun) appendEvent(data map[string]interface{}) {
+	r.mu.Lock()
+	if data["type"] == "exec-output" {
+		size := int64(len(data["data"].(string)))
+		if r.buffered+size > maxExecBufferedBytes {
+			if !r.info.Truncated {
+				r.info.Truncated = true
+				data = map[string]interface{}{
+					"type":  "exec-truncated",
+					"runId": r.info.ID,
+				}
+			} else {
+				r.mu.Unlock()
+				return
+			}
+		} else {
+			r.buffered += size
+		}
+	}
+	ev := BufferedEvent{ID: r.nextID, Data: data}
+	r.nextID++
+	r.events = append(r.events, ev)
+	r.mu.Unlock()
+
+	publishEvent("exec:"+r.info.ID, ev)
+}
+
+// eventsAfter returns buffered events with IDs strictly greater than afterID.
+func (r *execRun) eventsAfter(afterID int64) []BufferedEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []BufferedEvent
+	for _, ev := range r.events {
+		if ev.ID > afterID {
+			result = append(result, ev)
+		}
+	}
+	return result
+}
+
+func (r *execRun) snapshot() ExecRun {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info := r.info
+	if info.Status == "running" {
+		info.DurationMs = time.Now().UnixMilli() - info.StartedAt
+	}
+	return info
+}
+
+// SubscribeExecEvents returns the events buffered for a run and registers
+// fn for the ones that follow, so each event is seen exactly once. ok is
+// false (and nothing is subscribed) if the run is unknown.
+func SubscribeExecEvents(runID string, fn func(data interface{})) (events []BufferedEvent, unsubscribe func(), ok bool) {
+	execMu.RLock()
+	run, exists := execRuns[runID]
+	execMu.RUnlock()
+	if !exists {
+		return nil, nil, false
+	}
+
+	run.mu.RLock()
+	defer run.mu.RUnlock()
+	events = append(events, run.events...)
+	lastID := int64(-1)
+	if len(events) > 0 {
+		lastID = events[len(events)-1].ID
+	}
+	// Events are published after the run lock is released: drop the ones
+	// already in the snapshot
+	unsubscribe = SubscribeEvents("exec:"+runID, func(data interface{}) {
+		if ev, ok := data.(BufferedEvent); ok && ev.ID <= lastID {
+			return
+		}
+		fn(data)
+	})
+	return events, unsubscribe, true
+}
+
+// newExecID returns a random run ID.
+func newExecID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "exec-" + hex.EncodeToString(b)
+}
+
+// StartExec validates a request and starts the run in the background.
+func StartExec(req ExecRequest) (*ExecRun, error) {
+	if strings.TrimSpace(req.Command) == "" && strings.TrimSpace(req.Script) == "" {
+		return nil, fmt.Errorf("command or script required")
+	}
+	if req.Command != "" && req.Script != "" {
+		return nil, fmt.Errorf("specify either command or script, not both")
+	}
+
+	cwd := req.Cwd
+	if cwd == "" {
+		cwd, _ = os.UserHomeDir()
+	}
+	if strings.HasPrefix(cwd, "~") {
+		home, _ := os.UserHomeDir()
+		cwd = filepath.Join(home, cwd[1:])
+	}
+	if info, err := os.Stat(cwd); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("cwd is not a directory: %s", cwd)
+	}
+
+	timeout := defaultExecTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	if timeout > maxExecTimeout {
+		timeout = maxExecTimeout
+	}
+
+	workspace := req.Workspace
+	if workspace == "" {
+		workspace = cwd
+	}
+
+	// Build the command: a shell command line, or a script file run by its
+	// interpreter (so scripts can read the provided stdin)
+	shell := getShell()
+	var name string
+	var args []string
+	var scriptFile string
+	display := req.Command
+	if req.Command != "" {
+		name, args = shell, []string{"-c", req.Command}
+	} else {
+		f, err := os.CreateTemp("", execScriptFilePattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create script file: %w", err)
+		}
+		if _, err := f.WriteString(req.Script); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, fmt.Errorf("failed to write script file: %w", err)
+		}
+		f.Close()
+		scriptFile = f.Name()
+
+		interpreter := req.Interpreter
+		if interpreter == "" {
+			interpreter = shell
+		}
+		fields := strings.Fields(interpreter)
+		name, args = fields[0], append(fields[1:], scriptFile)
+		display = firstLine(req.Script)
+	}
+
+	// The exec class timeout caps the run's own
+	if limit := processLimits(ProcExec).TimeoutSeconds; limit > 0 && time.Duration(limit)*time.Second < timeout {
+		timeout = time.Duration(limit) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	cmd := manageCommand(ProcExec, exec.CommandContext(ctx, name, args...))
+	cmd.limits.TimeoutSeconds = 0 // enforced by ctx, so it's reported as a timeout
+	cmd.Dir = cwd
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, "MDT_EXEC=1")
+	for k, v := range req.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if req.Stdin != "" {
+		cmd.Stdin = strings.NewReader(req.Stdin)
+	}
+	// Don't wait forever for grandchildren holding the pipes open
+	cmd.WaitDelay = execKillGrace + time.Second
+
+	run := &execRun{
+		info: ExecRun{
+			ID:          newExecID(),
+			Workspace:   workspace,
+			Command:     display,
+			Interpreter: req.Interpreter,
+			Cwd:         cwd,
+			Status:      "running",
+			StartedAt:   time.Now().UnixMilli(),
+		},
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	stdout := &execOutputWriter{run: run, stream: "stdout"}
+	stderr := &execOutputWriter{run: run, stream: "stderr"}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Cancellation reaches the whole process group (pipelines, npm, ...)
+	cmd.Cancel = func() error {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		go func() {
+			select {
+			case <-run.done:
+			case <-time.After(execKillGrace):
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+		}()
+		return nil
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		if scriptFile != "" {
+			os.Remove(scriptFile)
+		}
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+
+	registerExecRun(run)
+	run.appendEvent(map[string]interface{}{
+		"type": "exec-started",
+		"run":  run.snapshot(),
+	})
+	log.Printf("[Exec] Started %s in %s: %s", run.info.ID, cwd, display)
+
+	go func() {
+		defer cancel()
+		if scriptFile != "" {
+			defer os.Remove(scriptFile)
+		}
+
+		waitErr := cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+
+		run.finish(ctx, cmd.Cmd, waitErr)
+	}()
+
+	info := run.snapshot()
+	return &info, nil
+}
+
+// execOutputWriter turns one output channel into exec-output events,
+// holding back a trailing partial UTF-8 sequence until the next write.
+type execOutputWriter struct {
+	run     *execRun
+	stream  string
+	pending []byte
+}
+
+func (w *execOutputWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	cut := utf8CompletePrefix(data)
+	w.pending = append([]byte(nil), data[cut:]...)
+	w.run.emitOutput(w.stream, data[:cut])
+	return len(p), nil
+}
+
+func (w *execOutputWriter) flush() {
+	w.run.emitOutput(w.stream, w.pending)
+	w.pending = nil
+}
+
+func (r *execRun) emitOutput(stream string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	r.mu.Lock()
+	if stream == "stdout" {
+		r.info.StdoutBytes += int64(len(data))
+	} else {
+		r.info.StderrBytes += int64(len(data))
+	}
+	r.mu.Unlock()
+
+	r.appendEvent(map[string]interface{}{
+		"type":   "exec-output",
+		"runId":  r.info.ID,
+		"stream": stream,
+		"data":   string(data),
+	})
+}
+
+// finish records the outcome and publishes the exec-exit event.
+func (r *execRun) finish(ctx context.Context, cmd *exec.Cmd, waitErr error) {
+	r.mu.Lock()
+	now := time.Now()
+	r.info.EndedAt = now.UnixMilli()
+	r.info.DurationMs = r.info.EndedAt - r.info.StartedAt
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		r.info.ExitCode = &code
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case r.cancelled:
+		r.info.Status = "cancelled"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.info.Status = "timeout"
+		r.info.Error = "timed out"
+	case waitErr == nil || errors.As(waitErr, &exitErr):
+		r.info.Status = "exited"
+	default:
+		r.info.Status = "failed"
+		r.info.Error = waitErr.Error()
+	}
+	info := r.info
+	r.mu.Unlock()
+
+	r.appendEvent(map[string]interface{}{
+		"type":       "exec-exit",
+		"runId":      info.ID,
+		"status":     info.Status,
+		"exitCode":   info.ExitCode,
+		"durationMs": info.DurationMs,
+		"error":      info.Error,
+	})
+	close(r.done)
+
+	code := -1
+	if info.ExitCode != nil {
+		code = *info.ExitCode
+	}
+	log.Printf("[Exec] %s %s (exit %d, %dms)", info.ID, info.Status, code, info.DurationMs)
+}
+
+// registerExecRun adds a run to the history, evicting the oldest finished
+// runs of its workspace beyond maxExecRunsPerSpace.
+func registerExecRun(run *execRun) {
+	execMu.Lock()
+	defer execMu.Unlock()
+
+	execRuns[run.info.ID] = run
+	ids := append(execByWorkspace[run.info.Workspace], run.info.ID)
+	for len(ids) > maxExecRunsPerSpace {
+		evicted := false
+		for i, id := range ids {
+			old := execRuns[id]
+			select {
+			case <-old.done:
+				delete(execRuns, id)
+				ids = append(ids[:i], ids[i+1:]...)
+				evicted = true
+			default:
+			}
+			if evicted {
+				break
+			}
+		}
+		if !evicted {
+			break // everything still running; keep them all
+		}
+	}
+	execByWorkspace[run.info.Workspace] = ids
+}
+
+// CancelExec stops a running command (SIGTERM to its process group, then
+// SIGKILL after a grace period).
+func CancelExec(runID string) error {
+	execMu.RLock()
+	run, ok := execRuns[runID]
+	execMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("run %s not found", runID)
+	}
+	select {
+	case <-run.done:
+		return fmt.Errorf("run %s already finished", runID)
+	default:
+	}
+
+	run.mu.Lock()
+	run.cancelled = true
+	run.mu.Unlock()
+	run.cancel()
+	log.Printf("[Exec] Cancelling %s", runID)
+	return nil
+}
+
+// ListExecRuns returns a workspace's runs (all workspaces if empty), newest first.
+func ListExecRuns(workspace string) []ExecRun {
+	execMu.RLock()
+	var runs []*execRun
+	for ws, ids := range execByWorkspace {
+		if workspace != "" && ws != workspace {
+			continue
+		}
+		for _, id := range ids {
+			runs = append(runs, execRuns[id])
+		}
+	}
+	execMu.RUnlock()
+
+	result := make([]ExecRun, 0, len(runs))
+	for _, run := range runs {
+		result = append(result, run.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt > result[j].StartedAt
+	})
+	return result
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " …"
+	}
+	return s
+}
+
+// --- HTTP Handlers ---
+
+// ExecStart handles POST /api/exec - start a run. With ?stream=true (or
+// Accept: text/event-stream) the response is the run's SSE stream;
+// otherwise the run is returned immediately.
+func ExecStart(w http.ResponseWriter, r *http.Request) {
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	info, err := StartExec(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		streamExecToClient(w, r, info.ID, -1)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// ExecStream handles GET /api/exec/{id}/stream - SSE replay and live output.
+// Resumes after the Last-Event-ID header (or ?lastEventId) when given.
+func ExecStream(w http.ResponseWriter, r *http.Request) {
+	var after int64 = -1
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	if lastID != "" {
+		fmt.Sscanf(lastID, "%d", &after)
+	}
+	streamExecToClient(w, r, chi.URLParam(r, "id"), after)
+}
+
+// streamExecToClient writes a run's events as SSE until it exits or the
+// client disconnects.
+func streamExecToClient(w http.ResponseWriter, r *http.Request, runID string, after int64) {
+	execMu.RLock()
+	run, ok := execRuns[runID]
+	execMu.RUnlock()
+	if !ok {
+		http.Error(w, `{"error": "run not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": "streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		for _, ev := range run.eventsAfter(after) {
+			writeSSEWithID(w, flusher, ev.ID, ev.Data)
+			after = ev.ID
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-run.done:
+			for _, ev := range run.eventsAfter(after) {
+				writeSSEWithID(w, flusher, ev.ID, ev.Data)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExecGet handles GET /api/exec/{id} - run status, with ?output=true the
+// buffered stdout and stderr.
+func ExecGet(w http.ResponseWriter, r *http.Request) {
+	execMu.RLock()
+	run, ok := execRuns[chi.URLParam(r, "id")]
+	execMu.RUnlock()
+	if !ok {
+		http.Error(w, `{"error": "run not found"}`, http.StatusNotFound)
+		return
+	}
+
+	resp := map[string]interface{}{"run": run.snapshot()}
+	if r.URL.Query().Get("output") == "true" {
+		var stdout, stderr strings.Builder
+		for _, ev := range run.eventsAfter(-1) {
+			if ev.Data["type"] != "exec-output" {
+				continue
+			}
+			if ev.Data["stream"] == "stderr" {
+				stderr.WriteString(ev.Data["data"].(string))
+			} else {
+				stdout.WriteString(ev.Data["data"].(string))
+			}
+		}
+		resp["stdout"] = stdout.String()
+		resp["stderr"] = stderr.String()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ExecCancel handles DELETE /api/exec/{id}
+func ExecCancel(w http.ResponseWriter, r *http.Request) {
+	if err := CancelExec(chi.URLParam(r, "id")); err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonSuccess(w, nil)
+}
+
+// ExecHistory handles GET /api/exec/history?workspace=...
+func ExecHistory(w http.ResponseWriter, r *http.Request) {
+	runs := ListExecRuns(r.URL.Query().Get("workspace"))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
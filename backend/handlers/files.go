@@ -18,10 +18,18 @@ import (
 	"markdown-themes-backend/utils"
 )
 
-// AuthToken handles GET /api/auth/token
+// AuthToken handles GET /api/auth/token. It also sets the auth cookie; clients
+// relying on the cookie must echo csrfToken in the X-CSRF-Token header on
+// state-changing requests.
 func AuthToken(w http.ResponseWriter, r *http.Request) {
+	if !auth.CheckOrigin(r) {
+		http.Error(w, `{"error": "origin not allowed"}`, http.StatusForbidden)
+		return
+	}
+	auth.SetAuthCookie(w, r)
 	json.NewEncoder(w).Encode(map[string]string{
-		"token": auth.Token(),
+		"token":     auth.Token(),
+		"csrfToken": auth.CSRFToken(),
 	})
 }
 
@@ -139,7 +147,7 @@ func buildFileTree(path string, name string, depth int, showHidden bool) models.
 }
 
 func isGitDirty(repoPath string) bool {
-	cmd := exec.Command("git", "-C", repoPath, "status", "--porcelain")
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "status", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
 		return false
@@ -215,35 +223,41 @@ func GitStatus(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	path = filepath.Clean(path)
+	json.NewEncoder(w).Encode(GitStatusSnapshot(filepath.Clean(path)))
+}
 
+// GitStatusSnapshot runs `git status --porcelain` for the repository that
+// contains path and returns the parsed per-file status.
+func GitStatusSnapshot(path string) models.GitStatusResponse {
 	// Find git root
 	gitRoot := findGitRoot(path)
 	if gitRoot == "" {
-		json.NewEncoder(w).Encode(models.GitStatusResponse{
+		return models.GitStatusResponse{
 			IsGitRepo: false,
 			Files:     make(map[string]models.GitStatusInfo),
-		})
-		return
+		}
 	}
 
 	// Run git status --porcelain
-	cmd := exec.Command("git", "-C", gitRoot, "status", "--porcelain")
+	cmd := processCommand(ProcGit, "git", "-C", gitRoot, "status", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
-		json.NewEncoder(w).Encode(models.GitStatusResponse{
+		return models.GitStatusResponse{
 			IsGitRepo: true,
 			Files:     make(map[string]models.GitStatusInfo),
-		})
-		return
+		}
 	}
 
-	files := parseGitStatus(string(output), gitRoot)
-
-	json.NewEncoder(w).Encode(models.GitStatusResponse{
+	return models.GitStatusResponse{
 		IsGitRepo: true,
-		Files:     files,
-	})
+		Files:     parseGitStatus(string(output), gitRoot),
+	}
+}
+
+// FindGitRoot returns the closest ancestor of path (inclusive) that is a
+// git repository, or "" if there is none.
+func FindGitRoot(path string) string {
+	return findGitRoot(path)
 }
 
 func findGitRoot(path string) string {
@@ -369,19 +383,25 @@ func FileRaw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read file and write bytes directly (avoid http.ServeFile redirect behavior)
+	writeFileBytes(w, path, "public, max-age=3600")
+}
+
+// writeFileBytes reads a file and writes its bytes directly with a
+// Content-Type from its extension (avoids http.ServeFile redirect behavior).
+// Shared by FileRaw, ServeFile and share links.
+func writeFileBytes(w http.ResponseWriter, path string, cacheControl string) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		http.Error(w, "failed to read file", http.StatusInternalServerError)
 		return
 	}
 
-	ext := filepath.Ext(path)
-	mime := mimeTypeFromExt(ext)
-
-	w.Header().Set("Content-Type", mime)
+	// Callers may pre-set a Content-Type (e.g. text/plain for shared source files)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", mimeTypeFromExt(filepath.Ext(path)))
+	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Cache-Control", cacheControl)
 	w.Write(data)
 }
 
@@ -462,19 +482,7 @@ func ServeFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		http.Error(w, "failed to read file", http.StatusInternalServerError)
-		return
-	}
-
-	ext := filepath.Ext(filePath)
-	mime := mimeTypeFromExt(ext)
-
-	w.Header().Set("Content-Type", mime)
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Write(data)
+	writeFileBytes(w, filePath, "no-cache")
 }
 
 // FileMedia handles GET /api/files/media - serves images, video, audio as base64 data URIs
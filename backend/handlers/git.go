@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -80,7 +79,7 @@ func findGitRepos(path string, currentDepth, maxDepth int, repos *[]models.GitRe
 		}
 
 		// Get remote URL and derive GitHub URL
-		cmd := exec.Command("git", "-C", path, "remote", "get-url", "origin")
+		cmd := processCommand(ProcGit, "git", "-C", path, "remote", "get-url", "origin")
 		if output, err := cmd.Output(); err == nil {
 			repo.RemoteURL = strings.TrimSpace(string(output))
 			githubURL := remoteToGithubURL(repo.RemoteURL)
@@ -88,13 +87,13 @@ func findGitRepos(path string, currentDepth, maxDepth int, repos *[]models.GitRe
 		}
 
 		// Get tracking branch and ahead/behind
-		cmd = exec.Command("git", "-C", path, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+		cmd = processCommand(ProcGit, "git", "-C", path, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
 		if output, err := cmd.Output(); err == nil {
 			repo.Tracking = strings.TrimSpace(string(output))
 		}
 
 		if repo.Tracking != "" {
-			cmd = exec.Command("git", "-C", path, "rev-list", "--left-right", "--count", "HEAD...@{u}")
+			cmd = processCommand(ProcGit, "git", "-C", path, "rev-list", "--left-right", "--count", "HEAD...@{u}")
 			if output, err := cmd.Output(); err == nil {
 				parts := strings.Fields(strings.TrimSpace(string(output)))
 				if len(parts) == 2 {
@@ -105,13 +104,13 @@ func findGitRepos(path string, currentDepth, maxDepth int, repos *[]models.GitRe
 		}
 
 		// Get staged, unstaged, untracked files from git status
-		cmd = exec.Command("git", "-C", path, "status", "--porcelain")
+		cmd = processCommand(ProcGit, "git", "-C", path, "status", "--porcelain")
 		if output, err := cmd.Output(); err == nil {
 			parseRepoStatus(string(output), &repo)
 		}
 
 		// Get last activity (last commit date)
-		cmd = exec.Command("git", "-C", path, "log", "-1", "--format=%aI")
+		cmd = processCommand(ProcGit, "git", "-C", path, "log", "-1", "--format=%aI")
 		if output, err := cmd.Output(); err == nil {
 			lastActivity := strings.TrimSpace(string(output))
 			if lastActivity != "" {
@@ -120,7 +119,7 @@ func findGitRepos(path string, currentDepth, maxDepth int, repos *[]models.GitRe
 		}
 
 		// Get worktrees
-		cmd = exec.Command("git", "-C", path, "worktree", "list", "--porcelain")
+		cmd = processCommand(ProcGit, "git", "-C", path, "worktree", "list", "--porcelain")
 		if output, err := cmd.Output(); err == nil {
 			repo.Worktrees = parseWorktrees(string(output))
 		}
@@ -298,7 +297,7 @@ func GitGraph(w http.ResponseWriter, r *http.Request) {
 	// Git log format: hash|short|author|email|date|parents|refs|subject
 	format := "%H|%h|%an|%ae|%aI|%P|%D|%s"
 
-	cmd := exec.Command("git", "-C", gitRoot, "log",
+	cmd := processCommand(ProcGit, "git", "-C", gitRoot, "log",
 		"--all",
 		fmt.Sprintf("--format=%s", format),
 		fmt.Sprintf("-n%d", limit+1), // +1 to detect hasMore
@@ -406,7 +405,7 @@ func GitCommitDetails(w http.ResponseWriter, r *http.Request) {
 
 	// Get commit info
 	format := "%H|%h|%an|%ae|%aI|%P|%D|%s|%b"
-	cmd := exec.Command("git", "-C", gitRoot, "log", "-1", fmt.Sprintf("--format=%s", format), hash)
+	cmd := processCommand(ProcGit, "git", "-C", gitRoot, "log", "-1", fmt.Sprintf("--format=%s", format), hash)
 	output, err := cmd.Output()
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error": "commit not found: %s"}`, err.Error()), http.StatusNotFound)
@@ -450,7 +449,7 @@ func GitCommitDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get changed files
-	cmd = exec.Command("git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--name-status", "-r", "--numstat", hash)
+	cmd = processCommand(ProcGit, "git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--name-status", "-r", "--numstat", hash)
 	output, err = cmd.Output()
 	if err == nil {
 		details.Files = parseCommitFiles(string(output), gitRoot, hash)
@@ -463,14 +462,14 @@ func GitCommitDetails(w http.ResponseWriter, r *http.Request) {
 
 func parseCommitFiles(output string, gitRoot string, hash string) []models.GitFileChange {
 	// Get name-status output
-	cmd := exec.Command("git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--name-status", "-r", hash)
+	cmd := processCommand(ProcGit, "git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--name-status", "-r", hash)
 	statusOutput, err := cmd.Output()
 	if err != nil {
 		return nil
 	}
 
 	// Get numstat for additions/deletions
-	cmd = exec.Command("git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--numstat", "-r", hash)
+	cmd = processCommand(ProcGit, "git", "-C", gitRoot, "diff-tree", "--no-commit-id", "--numstat", "-r", hash)
 	numstatOutput, err := cmd.Output()
 	if err != nil {
 		return nil
@@ -602,7 +601,7 @@ func GitDiff(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "--", file)
 	}
 
-	cmd := exec.Command("git", args...)
+	cmd := processCommand(ProcGit, "git", args...)
 	output, err := cmd.Output()
 	if err != nil {
 		// Try without the parent (first commit)
@@ -611,7 +610,7 @@ func GitDiff(w http.ResponseWriter, r *http.Request) {
 			if file != "" {
 				args = append(args, "--", file)
 			}
-			cmd = exec.Command("git", args...)
+			cmd = processCommand(ProcGit, "git", args...)
 			output, err = cmd.Output()
 		}
 		if err != nil {
@@ -691,7 +690,7 @@ func GitRepoStage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	args := append([]string{"-C", repoPath, "add"}, body.Files...)
-	cmd := exec.Command("git", args...)
+	cmd := processCommand(ProcGit, "git", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git add failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -723,7 +722,7 @@ func GitRepoUnstage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	args := append([]string{"-C", repoPath, "reset", "HEAD", "--"}, body.Files...)
-	cmd := exec.Command("git", args...)
+	cmd := processCommand(ProcGit, "git", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git reset failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -754,7 +753,7 @@ func GitRepoCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd := exec.Command("git", "-C", repoPath, "commit", "-m", body.Message)
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "commit", "-m", body.Message)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git commit failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -774,7 +773,7 @@ func GitRepoPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd := exec.Command("git", "-C", repoPath, "push")
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "push")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git push failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -794,7 +793,7 @@ func GitRepoPull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd := exec.Command("git", "-C", repoPath, "pull")
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "pull")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git pull failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -814,7 +813,7 @@ func GitRepoFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd := exec.Command("git", "-C", repoPath, "fetch")
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "fetch")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("git fetch failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -845,14 +844,14 @@ func GitRepoDiscard(w http.ResponseWriter, r *http.Request) {
 
 	if body.All {
 		// Discard all changes: checkout all tracked files, clean untracked
-		cmd := exec.Command("git", "-C", repoPath, "checkout", ".")
+		cmd := processCommand(ProcGit, "git", "-C", repoPath, "checkout", ".")
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			jsonError(w, fmt.Sprintf("git checkout failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
 			return
 		}
 
-		cmd = exec.Command("git", "-C", repoPath, "clean", "-fd")
+		cmd = processCommand(ProcGit, "git", "-C", repoPath, "clean", "-fd")
 		output, err = cmd.CombinedOutput()
 		if err != nil {
 			jsonError(w, fmt.Sprintf("git clean failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -865,7 +864,7 @@ func GitRepoDiscard(w http.ResponseWriter, r *http.Request) {
 		}
 
 		args := append([]string{"-C", repoPath, "checkout", "--"}, body.Files...)
-		cmd := exec.Command("git", args...)
+		cmd := processCommand(ProcGit, "git", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			jsonError(w, fmt.Sprintf("git checkout failed: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
@@ -885,7 +884,7 @@ func GitRepoGenerateMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the staged diff
-	cmd := exec.Command("git", "-C", repoPath, "diff", "--cached")
+	cmd := processCommand(ProcGit, "git", "-C", repoPath, "diff", "--cached")
 	diffOutput, err := cmd.Output()
 	if err != nil {
 		jsonError(w, "failed to get staged diff", http.StatusInternalServerError)
@@ -904,7 +903,7 @@ func GitRepoGenerateMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use git log to get recent commit style
-	cmd = exec.Command("git", "-C", repoPath, "log", "--oneline", "-5")
+	cmd = processCommand(ProcGit, "git", "-C", repoPath, "log", "--oneline", "-5")
 	logOutput, _ := cmd.Output()
 
 	prompt := fmt.Sprintf(
@@ -916,12 +915,12 @@ func GitRepoGenerateMessage(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Try using claude CLI to generate the message
-	cmd = exec.Command("claude", "-p", prompt)
+	cmd = processCommand(ProcChat, "claude", "-p", prompt)
 	cmd.Dir = repoPath
 	output, err := cmd.Output()
 	if err != nil {
 		// Fallback: generate a simple message from the diff stat
-		cmd = exec.Command("git", "-C", repoPath, "diff", "--cached", "--stat")
+		cmd = processCommand(ProcGit, "git", "-C", repoPath, "diff", "--cached", "--stat")
 		statOutput, _ := cmd.Output()
 		jsonSuccess(w, map[string]interface{}{
 			"message": fmt.Sprintf("Update %s", strings.TrimSpace(string(statOutput))),
@@ -100,7 +100,7 @@ func NotepadSend(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "--permission-mode", req.PermissionMode)
 	}
 
-	cmd := exec.Command("claude", args...)
+	cmd := processCommand(ProcNotepad, "claude", args...)
 	if req.Cwd != "" {
 		cmd.Dir = req.Cwd
 	}
@@ -114,13 +114,9 @@ func NotepadSend(w http.ResponseWriter, r *http.Request) {
 	}
 
 	proc := &ActiveNotepadProcess{
-		Cmd:       cmd,
+		Cmd:       cmd.Cmd,
 		SessionID: sessionKey,
-		cancel: func() {
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
-		},
+		cancel:    cmd.Terminate,
 	}
 
 	notepadProcessMu.Lock()
@@ -136,6 +132,14 @@ func NotepadSend(w http.ResponseWriter, r *http.Request) {
 	// Run and capture output
 	output, err := cmd.Output()
 	if err != nil {
+		if cmd.TimedOut() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			json.NewEncoder(w).Encode(NotepadResponse{
+				Error: "Claude CLI timed out",
+			})
+			return
+		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			stderrStr := string(exitErr.Stderr)
 			log.Printf("[Notepad] Claude CLI error (exit %d): %s", exitErr.ExitCode(), stderrStr)
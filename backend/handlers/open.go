@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// --- Open in viewer ---
+//
+// `mt open FILE[:LINE[:COL]]` (see cli.go) asks the running app to open a
+// file, like `code FILE:LINE`. The file is resolved like a terminal link
+// and an open-file message goes to the clients viewing the terminal it was
+// run in (MDT_SESSION_ID), or to every client when run elsewhere.
+
+// OpenFileRequest is the body of POST /api/open.
+type OpenFileRequest struct {
+	Target    string `json:"target"`              // path[:line[:column]], as in terminal links
+	Cwd       string `json:"cwd,omitempty"`       // relative paths resolve against this
+	SessionID string `json:"sessionId,omitempty"` // terminal the command ran in
+}
+
+// OpenFile handles POST /api/open - open a file in the viewer
+func OpenFile(w http.ResponseWriter, r *http.Request) {
+	var req OpenFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	path, webURL, line, column := parseLink(req.Target)
+	if path == "" || webURL != "" {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, "not a file: "+req.Target), http.StatusBadRequest)
+		return
+	}
+
+	tm := GetTerminalManager()
+	session, inTerminal := tm.findSession(req.SessionID)
+	cwd := req.Cwd
+	if cwd == "" && inTerminal {
+		cwd, _ = liveCwd(session, "")
+	}
+	resolved := resolveLinkPath(cwd, path)
+	if resolved == "" {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, "no such file: "+path), http.StatusNotFound)
+		return
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":   "open-file",
+		"path":   resolved,
+		"line":   line,
+		"column": column,
+		"isDir":  info.IsDir(),
+	}
+	delivered := "all"
+	if inTerminal {
+		message["terminalId"] = session.ID
+		if len(tm.GetClients(session.ID)) > 0 {
+			delivered = "terminal"
+		}
+	}
+	if delivered == "terminal" {
+		tm.sendSessionEvent(session.ID, message)
+	} else if tm.broadcastAllFunc != nil {
+		tm.broadcastAllFunc(message)
+	}
+	log.Printf("[Open] %s:%d (to %s clients)", resolved, line, delivered)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"path":      resolved,
+		"line":      line,
+		"column":    column,
+		"delivered": delivered,
+	})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/auth"
+)
+
+// --- Dev server preview ---
+//
+// /preview/{port}/ proxies a dev server running in a terminal so the HTML
+// viewer can show it from the app's own origin. Only ports a terminal is
+// listening on (see monitorPorts) are proxied. The server thinks it's at
+// the root, so root-relative URLs in redirects, cookies and HTML, CSS and
+// JavaScript responses are rewritten under the prefix; servers that
+// support a base path can use X-Forwarded-Prefix instead. WebSocket
+// upgrades (hot reload) are passed through. Proxied pages are sandboxed
+// into an opaque origin (previewCSP), so they can't reach the app's API.
+// Their own requests come from origin "null": the app's CORS and origin
+// checks don't apply under /preview/ (see SkipPreview), and the proxy
+// answers CORS for the sandboxed page itself (previewCORSOrigin).
+
+// previewCSP runs proxied pages as an opaque origin: without
+// allow-same-origin, the dev server's scripts can't read the app's storage
+// or call its API with the app's credentials.
+const previewCSP = "sandbox allow-scripts allow-forms allow-popups allow-modals allow-downloads"
+
+// previewPrefix is the path all previews are served under.
+const previewPrefix = "/preview/"
+
+// previewOriginKey carries a request's CORS origin to ModifyResponse.
+type previewOriginKey struct{}
+
+// previewProxies caches a reverse proxy per port.
+var previewProxies sync.Map // int → *httputil.ReverseProxy
+
+// previewPath is the path a port is proxied under, without the trailing
+// slash.
+func previewPath(port int) string {
+	return previewPrefix + strconv.Itoa(port)
+}
+
+// SkipPreview wraps middleware so it doesn't run for preview requests.
+// The app's CORS and origin checks would refuse the sandboxed pages'
+// "null" origin; the proxy strips the app's credentials instead, so a
+// request through it can do no more than one sent to the dev server
+// directly.
+func SkipPreview(middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, previewPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// previewCORSOrigin returns the origin to allow a preview request from:
+// "null" when it comes from a sandboxed page this server served (module
+// scripts and fetches are CORS requests from the opaque origin), judged
+// by the referrer, which other sandboxed pages can't set. Empty otherwise.
+func previewCORSOrigin(r *http.Request) string {
+	if r.Header.Get("Origin") != "null" {
+		return ""
+	}
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Host != r.Host {
+		return ""
+	}
+	return "null"
+}
+
+// servePreviewPreflight answers a CORS preflight from a preview page,
+// allowing what it asks for: the dev server only knows its own origin.
+func servePreviewPreflight(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	origin := previewCORSOrigin(r)
+	if origin == "" {
+		return false
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	h.Add("Vary", "Origin")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+var (
+	// src="/x", href='/x' and friends in HTML
+	previewAttrPattern = regexp.MustCompile(`(?i)(\s(?:src|href|action|poster|formaction)\s*=\s*["'])(/[^"'\s]*)`)
+	// url(/x) in CSS, including style attributes
+	previewCSSPattern = regexp.MustCompile(`(url\(\s*["']?)(/[^"')\s]*)`)
+	// import "/x", from "/x" and import("/x") in JavaScript modules
+	previewImportPattern = regexp.MustCompile(`(\b(?:from|import)\s*\(?\s*["'])(/[^"'\s]*)`)
+	// Path=/x in Set-Cookie
+	previewCookiePathPattern = regexp.MustCompile(`(?i)(;\s*path=)(/[^;]*)`)
+)
+
+// rewriteRootPaths prefixes the root-relative paths matched by pattern
+// (the second group), leaving protocol-relative URLs and paths already
+// under the prefix alone.
+func rewriteRootPaths(pattern *regexp.Regexp, s, prefix string) string {
+	return pattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := pattern.FindStringSubmatch(m)
+		path := sub[2]
+		if strings.HasPrefix(path, "//") || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return m
+		}
+		return sub[1] + prefix + path
+	})
+}
+
+// rewritePreviewBody rewrites root-relative URLs in an HTML, CSS or
+// JavaScript response.
+func rewritePreviewBody(body, prefix string) string {
+	for _, pattern := range []*regexp.Regexp{previewAttrPattern, previewCSSPattern, previewImportPattern} {
+		body = rewriteRootPaths(pattern, body, prefix)
+	}
+	return body
+}
+
+// rewritePreviewLocation maps a redirect to the dev server (root-relative,
+// or absolute to localhost on its port) under the prefix.
+func rewritePreviewLocation(location string, port int, prefix string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if u.Host != "" {
+		host, p := u.Hostname(), u.Port()
+		if p != strconv.Itoa(port) || (host != "localhost" && host != "127.0.0.1" && host != "::1") {
+			return location
+		}
+		u.Scheme, u.Host = "", ""
+	}
+	if !strings.HasPrefix(u.Path, "/") || u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+		return u.String()
+	}
+	u.Path = prefix + u.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+// rewritablePreviewType reports whether a response's content type may
+// contain root-relative URLs worth rewriting.
+func rewritablePreviewType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/css",
+		"text/javascript", "application/javascript", "application/x-javascript":
+		return true
+	}
+	return false
+}
+
+func newPreviewProxy(port int) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "http", Host: "localhost:" + strconv.Itoa(port)}
+	prefix := previewPath(port)
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, prefix)
+			if pr.Out.URL.Path == "" {
+				pr.Out.URL.Path = "/"
+			}
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			// Bodies are rewritten, so ask for them uncompressed
+			pr.Out.Header.Del("Accept-Encoding")
+			// The dev server is the page's origin as far as it knows (Vite
+			// and others check it on WebSocket upgrades)
+			if pr.Out.Header.Get("Origin") != "" {
+				pr.Out.Header.Set("Origin", target.String())
+			}
+			if origin := previewCORSOrigin(pr.In); origin != "" {
+				pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), previewOriginKey{}, origin))
+			}
+
+			// The app's credentials are not the dev server's business
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("X-Auth-Token")
+			pr.Out.Header.Del(auth.CSRFHeader)
+			cookies := pr.In.Cookies()
+			pr.Out.Header.Del("Cookie")
+			for _, c := range cookies {
+				if c.Name != auth.CookieName {
+					pr.Out.AddCookie(c)
+				}
+			}
+		},
+		ModifyResponse: func(res *http.Response) error {
+			// Added to (not replacing) the dev server's own policy
+			res.Header.Add("Content-Security-Policy", previewCSP)
+			// The dev server answered CORS for its own origin, not the page's
+			if origin, _ := res.Request.Context().Value(previewOriginKey{}).(string); origin != "" {
+				res.Header.Set("Access-Control-Allow-Origin", origin)
+				res.Header.Del("Access-Control-Allow-Credentials")
+				res.Header.Add("Vary", "Origin")
+			}
+			if location := res.Header.Get("Location"); location != "" {
+				res.Header.Set("Location", rewritePreviewLocation(location, port, prefix))
+			}
+			if cookies := res.Header.Values("Set-Cookie"); len(cookies) > 0 {
+				res.Header.Del("Set-Cookie")
+				for _, c := range cookies {
+					res.Header.Add("Set-Cookie", rewriteRootPaths(previewCookiePathPattern, c, prefix))
+				}
+			}
+
+			if res.StatusCode == http.StatusSwitchingProtocols || res.Request.Method == http.MethodHead ||
+				!rewritablePreviewType(res.Header.Get("Content-Type")) {
+				return nil
+			}
+			if enc := res.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+				return nil
+			}
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				return err
+			}
+			rewritten := rewritePreviewBody(string(body), prefix)
+			res.Body = io.NopCloser(bytes.NewReader([]byte(rewritten)))
+			res.ContentLength = int64(len(rewritten))
+			res.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf(`{"error": %q}`, "preview: "+err.Error()), http.StatusBadGateway)
+		},
+	}
+}
+
+// PreviewProxy handles /preview/{port}/* - a dev server listening on
+// localhost:{port} in a terminal
+func PreviewProxy(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil || !GetTerminalManager().portOpen(port) {
+		http.Error(w, `{"error": "no terminal is listening on that port"}`, http.StatusNotFound)
+		return
+	}
+
+	// Relative URLs need the trailing slash
+	if r.URL.Path == previewPath(port) {
+		target := previewPath(port) + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	if servePreviewPreflight(w, r) {
+		return
+	}
+
+	proxy, ok := previewProxies.Load(port)
+	if !ok {
+		proxy, _ = previewProxies.LoadOrStore(port, newPreviewProxy(port))
+	}
+	proxy.(*httputil.ReverseProxy).ServeHTTP(w, r)
+}
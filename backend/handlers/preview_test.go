@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/auth"
+)
+
+// ---- Preview proxy tests ----
+
+func TestPreviewRewrite_RootRelativeURLs(t *testing.T) {
+	prefix := previewPath(5173)
+	body := `<script type="module" src="/@vite/client"></script><a href='/about'>a</a>` +
+		`<a href="//cdn.example.com/x">b</a><a href="/preview/5173/ok">c</a><a href="rel">d</a>` +
+		`<style>body{background:url(/bg.png)}</style><script type="module">import "/src/main.ts"; import("/lazy.js")</script>`
+	want := `<script type="module" src="/preview/5173/@vite/client"></script><a href='/preview/5173/about'>a</a>` +
+		`<a href="//cdn.example.com/x">b</a><a href="/preview/5173/ok">c</a><a href="rel">d</a>` +
+		`<style>body{background:url(/preview/5173/bg.png)}</style><script type="module">import "/preview/5173/src/main.ts"; import("/preview/5173/lazy.js")</script>`
+	if got := rewritePreviewBody(body, prefix); got != want {
+		t.Errorf("rewritePreviewBody =\n%s\nwant\n%s", got, want)
+	}
+
+	locations := map[string]string{
+		"/login?next=/":              "/preview/5173/login?next=/",
+		"http://localhost:5173/home": "/preview/5173/home",
+		"http://127.0.0.1:5173/":     "/preview/5173/",
+		"http://localhost:8080/home": "http://localhost:8080/home",
+		"https://example.com/":       "https://example.com/",
+		"relative/path":              "relative/path",
+		"/preview/5173/already":      "/preview/5173/already",
+	}
+	for in, want := range locations {
+		if got := rewritePreviewLocation(in, 5173, prefix); got != want {
+			t.Errorf("rewritePreviewLocation(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := rewriteRootPaths(previewCookiePathPattern, "sid=1; Path=/; HttpOnly", prefix); got != "sid=1; Path=/preview/5173/; HttpOnly" {
+		t.Errorf("cookie path = %q", got)
+	}
+}
+
+func TestPreviewProxy_SandboxesPages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		w.Write([]byte(`<script src="/app.js"></script>`))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	w := httptest.NewRecorder()
+	newPreviewProxy(port).ServeHTTP(w, httptest.NewRequest(http.MethodGet, previewPath(port)+"/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	policies := w.Header().Values("Content-Security-Policy")
+	if len(policies) != 2 || policies[1] != previewCSP || strings.Contains(previewCSP, "allow-same-origin") {
+		t.Errorf("Content-Security-Policy = %q", policies)
+	}
+}
+
+func TestPreviewProxy_SandboxedPageRequests(t *testing.T) {
+	var posted string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like Vite, allow CORS from the dev server's own origin only
+		if origin := r.Header.Get("Origin"); strings.HasPrefix(origin, "http://localhost:") {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		switch {
+		case r.Method == http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			posted = string(body)
+		case r.URL.Path == "/src/main.ts":
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte(`import "/src/app.ts"`))
+		}
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	tm := GetTerminalManager()
+	tm.portsMu.Lock()
+	tm.ports[port] = OpenPort{Port: port}
+	tm.portsMu.Unlock()
+	defer func() {
+		tm.portsMu.Lock()
+		delete(tm.ports, port)
+		tm.portsMu.Unlock()
+	}()
+
+	router := chi.NewRouter()
+	router.Use(SkipPreview(auth.Protect))
+	router.Handle("/preview/{port}/*", http.HandlerFunc(PreviewProxy))
+
+	page := "http://example.com" + previewPath(port) + "/"
+	request := func(method, path, referer string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, previewPath(port)+path, body)
+		req.Header.Set("Origin", "null")
+		req.Header.Set("Referer", referer)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// <script type="module"> is a CORS request from the opaque origin
+	w := request(http.MethodGet, "/src/main.ts", page, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "null" {
+		t.Errorf("module script: status %d, Access-Control-Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if got := w.Body.String(); got != `import "`+previewPath(port)+`/src/app.ts"` {
+		t.Errorf("module script body = %q", got)
+	}
+
+	w = request(http.MethodPost, "/api/items", page, strings.NewReader("name=x"))
+	if w.Code != http.StatusOK || posted != "name=x" {
+		t.Errorf("POST: status %d, dev server got %q", w.Code, posted)
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, previewPath(port)+"/api/items", nil)
+	req.Header.Set("Origin", "null")
+	req.Header.Set("Referer", page)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "null" ||
+		w.Header().Get("Access-Control-Allow-Methods") != http.MethodPut || w.Header().Get("Access-Control-Allow-Headers") != "content-type" {
+		t.Errorf("preflight: status %d, headers %v", w.Code, w.Header())
+	}
+
+	// Other sandboxed pages can't read previews
+	w = request(http.MethodGet, "/src/main.ts", "https://elsewhere.example/", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got == "null" {
+		t.Errorf("foreign page: Access-Control-Allow-Origin %q", got)
+	}
+}
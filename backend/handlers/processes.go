@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"markdown-themes-backend/utils"
+)
+
+// --- Spawned process management ---
+//
+// Child processes (git, the Claude CLI, command runs, tasks) run in their
+// own process group, so cancelling one, its timeout or backend shutdown
+// signals everything it started (tool subprocesses, npm → node) instead
+// of orphaning it. Each process class can have resource limits (CPU time,
+// address space, open files), set by a shell wrapper before the command
+// runs, and a wall-clock timeout, configured centrally in
+// process-limits.json. Terminal shells get the resource limits through
+// prlimit(2) once started, but no timeout.
+
+// Process classes
+const (
+	ProcTerminal = "terminal"
+	ProcChat     = "chat" // Claude CLI conversations (and commit messages)
+	ProcNotepad  = "notepad"
+	ProcGit      = "git"
+	ProcExec     = "exec"
+	ProcTask     = "task"
+)
+
+// processClasses lists the classes limits can be configured for.
+var processClasses = []string{ProcTerminal, ProcChat, ProcNotepad, ProcGit, ProcExec, ProcTask}
+
+// ProcessLimits are the limits for one class of process. Zero means no
+// limit.
+type ProcessLimits struct {
+	CPUSeconds     uint64 `json:"cpuSeconds,omitempty"`     // RLIMIT_CPU
+	AddressSpaceMB uint64 `json:"addressSpaceMB,omitempty"` // RLIMIT_AS
+	OpenFiles      uint64 `json:"openFiles,omitempty"`      // RLIMIT_NOFILE
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"` // wall-clock, not for terminals
+}
+
+// ProcessLimitsConfig maps process classes to their limits.
+type ProcessLimitsConfig map[string]ProcessLimits
+
+// processKillGrace is how long a process group has between SIGTERM and
+// SIGKILL.
+const processKillGrace = 3 * time.Second
+
+func processLimitsPath() string {
+	return filepath.Join(utils.DataDir(), "process-limits.json")
+}
+
+// LoadProcessLimits reads the process limits (none if never saved)
+func LoadProcessLimits() (ProcessLimitsConfig, error) {
+	config := ProcessLimitsConfig{}
+	data, err := os.ReadFile(processLimitsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveProcessLimits writes the process limits to disk
+func SaveProcessLimits(config ProcessLimitsConfig) error {
+	path := processLimitsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	processLimitsMu.Lock()
+	processLimitsCache = config
+	processLimitsMu.Unlock()
+	return nil
+}
+
+// validateProcessLimits checks that every class is known and timeouts are
+// not negative.
+func validateProcessLimits(config ProcessLimitsConfig) error {
+	for class, limits := range config {
+		known := false
+		for _, c := range processClasses {
+			known = known || c == class
+		}
+		if !known {
+			return fmt.Errorf("unknown process class %q (want one of %s)", class, strings.Join(processClasses, ", "))
+		}
+		if limits.TimeoutSeconds < 0 {
+			return fmt.Errorf("%s: timeoutSeconds must not be negative", class)
+		}
+	}
+	return nil
+}
+
+var (
+	processLimitsCache ProcessLimitsConfig
+	processLimitsMu    sync.Mutex
+)
+
+// processLimits returns a class's limits, reading the config once.
+func processLimits(class string) ProcessLimits {
+	processLimitsMu.Lock()
+	defer processLimitsMu.Unlock()
+	if processLimitsCache == nil {
+		config, err := LoadProcessLimits()
+		if err != nil {
+			log.Printf("[Process] Failed to load process limits, none applied: %v", err)
+			config = ProcessLimitsConfig{}
+		}
+		processLimitsCache = config
+	}
+	return processLimitsCache[class]
+}
+
+// hasRlimits reports whether any resource limit is set.
+func (l ProcessLimits) hasRlimits() bool {
+	return l.CPUSeconds > 0 || l.AddressSpaceMB > 0 || l.OpenFiles > 0
+}
+
+// rlimitSetting is one resource limit to set.
+type rlimitSetting struct {
+	name       string
+	resource   int
+	ulimitFlag string
+	unit       uint64 // bytes per ulimit unit
+	soft, hard uint64
+}
+
+// rlimits returns the resource limits to set. The CPU hard limit is a few
+// seconds past the soft one, so the process gets SIGXCPU before SIGKILL.
+func (l ProcessLimits) rlimits() []rlimitSetting {
+	var settings []rlimitSetting
+	if l.CPUSeconds > 0 {
+		settings = append(settings, rlimitSetting{"cpu", unix.RLIMIT_CPU, "t", 1, l.CPUSeconds, l.CPUSeconds + 5})
+	}
+	if l.AddressSpaceMB > 0 {
+		bytes := l.AddressSpaceMB << 20
+		settings = append(settings, rlimitSetting{"address space", unix.RLIMIT_AS, "v", 1024, bytes, bytes})
+	}
+	if l.OpenFiles > 0 {
+		settings = append(settings, rlimitSetting{"open files", unix.RLIMIT_NOFILE, "n", 1, l.OpenFiles, l.OpenFiles})
+	}
+	return settings
+}
+
+// capped lowers the setting to fit under a current limit: limits can
+// only be raised as far as the current hard limit.
+func (s rlimitSetting) capped(current unix.Rlimit) unix.Rlimit {
+	limit := unix.Rlimit{Cur: s.soft, Max: s.hard}
+	if limit.Max > current.Max {
+		limit.Max = current.Max
+	}
+	if limit.Cur > limit.Max {
+		limit.Cur = limit.Max
+	}
+	return limit
+}
+
+// rlimitScript returns shell commands setting the limits, for a wrapper
+// that applies them before exec'ing the real command (so nothing the
+// command forks escapes them). Limits are capped to the backend's own,
+// which the child inherits.
+func rlimitScript(limits ProcessLimits) string {
+	var script strings.Builder
+	for _, s := range limits.rlimits() {
+		var current unix.Rlimit
+		if err := unix.Getrlimit(s.resource, &current); err != nil {
+			continue
+		}
+		limit := s.capped(current)
+		// Soft first: the new hard limit may be below the current soft one
+		fmt.Fprintf(&script, "ulimit -S -%s %d; ", s.ulimitFlag, limit.Cur/s.unit)
+		if limit.Max != unix.RLIM_INFINITY {
+			fmt.Fprintf(&script, "ulimit -H -%s %d; ", s.ulimitFlag, limit.Max/s.unit)
+		}
+	}
+	return script.String()
+}
+
+// applyRlimits sets a running process's resource limits.
+func applyRlimits(pid int, limits ProcessLimits) error {
+	var errs []error
+	for _, s := range limits.rlimits() {
+		var current unix.Rlimit
+		err := unix.Prlimit(pid, s.resource, nil, &current)
+		if err == nil {
+			limit := s.capped(current)
+			err = unix.Prlimit(pid, s.resource, &limit, nil)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// limitTerminalProcess applies the terminal resource limits to a running
+// shell (started by tmux or the pty backend, so it can't be wrapped).
+func limitTerminalProcess(pid int) {
+	limits := processLimits(ProcTerminal)
+	if !limits.hasRlimits() {
+		return
+	}
+	if err := applyRlimits(pid, limits); err != nil {
+		log.Printf("[Process] Failed to limit terminal shell (pid %d): %v", pid, err)
+	}
+}
+
+// limitTmuxPanes applies the terminal resource limits to the shells of a
+// tmux target's panes (a session, window or pane).
+func limitTmuxPanes(target string) {
+	if !processLimits(ProcTerminal).hasRlimits() {
+		return
+	}
+	out, err := runTmux("list-panes", "-t", target, "-F", "#{pane_pid}")
+	if err != nil {
+		log.Printf("[Process] Failed to list panes of %s to limit: %v", target, err)
+		return
+	}
+	for _, line := range strings.Fields(out) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			limitTerminalProcess(pid)
+		}
+	}
+}
+
+// terminateGroup sends SIGTERM to a process group, then SIGKILL if it is
+// still running after the grace period (done is closed once it exits).
+func terminateGroup(pgid int, done <-chan struct{}) {
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(processKillGrace):
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	}()
+}
+
+// managedCmd is an exec.Cmd that runs in its own process group under its
+// class's limits and is terminated on shutdown. Its Start, Wait, Run,
+// Output and CombinedOutput replace exec.Cmd's.
+type managedCmd struct {
+	*exec.Cmd
+	class    string
+	limits   ProcessLimits
+	done     chan struct{}
+	doneOnce sync.Once
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+var (
+	runningProcesses   = make(map[*managedCmd]bool)
+	runningProcessesMu sync.Mutex
+)
+
+// processCommand returns a command of the given class, like exec.Command.
+func processCommand(class, name string, args ...string) *managedCmd {
+	return manageCommand(class, exec.Command(name, args...))
+}
+
+// manageCommand puts an unstarted command under process management, with
+// its class's current limits.
+func manageCommand(class string, cmd *exec.Cmd) *managedCmd {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	return &managedCmd{Cmd: cmd, class: class, limits: processLimits(class), done: make(chan struct{})}
+}
+
+// Start starts the process under its class's resource limits and arms
+// its timeout.
+func (c *managedCmd) Start() error {
+	limits := c.limits
+	name := filepath.Base(c.Path)
+	if limits.hasRlimits() && c.Err == nil && c.Process == nil {
+		// sh -c '<ulimits> exec "$0" "$@"' path args...
+		c.Args = append([]string{"/bin/sh", "-c", rlimitScript(limits) + `exec "$0" "$@"`, c.Path}, c.Args[1:]...)
+		c.Path = "/bin/sh"
+	}
+	if err := c.Cmd.Start(); err != nil {
+		return err
+	}
+	pid := c.Process.Pid
+	if limits.TimeoutSeconds > 0 {
+		timeout := time.Duration(limits.TimeoutSeconds) * time.Second
+		c.timer = time.AfterFunc(timeout, func() {
+			c.timedOut.Store(true)
+			log.Printf("[Process] %s process %d (%s) timed out after %s", c.class, pid, name, timeout)
+			terminateGroup(pid, c.done)
+		})
+	}
+
+	runningProcessesMu.Lock()
+	runningProcesses[c] = true
+	runningProcessesMu.Unlock()
+	return nil
+}
+
+// Wait waits for the process to exit, like exec.Cmd.Wait.
+func (c *managedCmd) Wait() error {
+	err := c.Cmd.Wait()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.doneOnce.Do(func() { close(c.done) })
+	runningProcessesMu.Lock()
+	delete(runningProcesses, c)
+	runningProcessesMu.Unlock()
+	return err
+}
+
+// TimedOut reports whether the process was stopped by its class timeout.
+func (c *managedCmd) TimedOut() bool {
+	return c.timedOut.Load()
+}
+
+// Terminate stops the process and everything it started. It does nothing
+// once the process has been waited for (its group ID may be reused).
+func (c *managedCmd) Terminate() {
+	if c.Process == nil {
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		terminateGroup(c.Process.Pid, c.done)
+	}
+}
+
+// Run starts the process and waits for it.
+func (c *managedCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the process and returns its stdout. Unless Stderr is set,
+// stderr is captured into the returned *exec.ExitError.
+func (c *managedCmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureStderr := c.Stderr == nil
+	if captureStderr {
+		c.Stderr = &stderr
+	}
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if captureStderr && errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the process and returns stdout and stderr together.
+func (c *managedCmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil || c.Stderr != nil {
+		return nil, errors.New("exec: Stdout or Stderr already set")
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	err := c.Run()
+	return out.Bytes(), err
+}
+
+// TerminateProcesses stops every running managed process and waits (up to
+// the kill grace period) for them to exit. Called on shutdown.
+func TerminateProcesses() {
+	runningProcessesMu.Lock()
+	procs := make([]*managedCmd, 0, len(runningProcesses))
+	for c := range runningProcesses {
+		procs = append(procs, c)
+	}
+	runningProcessesMu.Unlock()
+	if len(procs) == 0 {
+		return
+	}
+
+	log.Printf("[Process] Stopping %d running processes", len(procs))
+	for _, c := range procs {
+		c.Terminate()
+	}
+	deadline := time.After(processKillGrace + time.Second)
+	for _, c := range procs {
+		select {
+		case <-c.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// --- HTTP Handlers ---
+
+// ProcessLimitSettings handles GET /api/processes/limits - resource limits and
+// timeouts by process class
+func ProcessLimitSettings(w http.ResponseWriter, r *http.Request) {
+	processLimits("") // load the config
+	processLimitsMu.Lock()
+	config := processLimitsCache
+	processLimitsMu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"classes": processClasses,
+		"limits":  config,
+	})
+}
+
+// SaveProcessLimitSettings handles POST /api/processes/limits - replace
+// the limits of every class. New limits apply to processes started from
+// then on.
+func SaveProcessLimitSettings(w http.ResponseWriter, r *http.Request) {
+	var config ProcessLimitsConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if config == nil {
+		config = ProcessLimitsConfig{}
+	}
+	if err := validateProcessLimits(config); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := SaveProcessLimits(config); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Process] Limits updated for %d classes", len(config))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"classes": processClasses,
+		"limits":  config,
+	})
+}
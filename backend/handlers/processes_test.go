@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- Process limit tests ----
+
+func TestManagedCmd_TimeoutKillsProcessGroup(t *testing.T) {
+	processLimitsMu.Lock()
+	saved := processLimitsCache
+	processLimitsCache = ProcessLimitsConfig{ProcGit: {TimeoutSeconds: 1, OpenFiles: 64}}
+	processLimitsMu.Unlock()
+	defer func() {
+		processLimitsMu.Lock()
+		processLimitsCache = saved
+		processLimitsMu.Unlock()
+	}()
+
+	// The background sleep keeps stdout open: Output only returns once the
+	// whole group is gone
+	cmd := processCommand(ProcGit, "sh", "-c", "ulimit -n >&2; sleep 30 & sleep 30")
+	start := time.Now()
+	_, err := cmd.Output()
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Output returned after %s, want about 1s", elapsed)
+	}
+	if !cmd.TimedOut() {
+		t.Errorf("TimedOut() = false, err = %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("err = %v, want *exec.ExitError", err)
+	}
+	if got := strings.TrimSpace(string(exitErr.Stderr)); got != "64" {
+		t.Errorf("open files limit = %q, want 64", got)
+	}
+}
+
+func TestManagedCmd_WaitTwice(t *testing.T) {
+	cmd := processCommand(ProcExec, "true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// A second Wait errors like exec.Cmd's instead of panicking
+	if err := cmd.Wait(); err == nil {
+		t.Error("expected an error from the second Wait")
+	}
+	cmd.Terminate()
+}
+
+func TestValidateProcessLimits(t *testing.T) {
+	if err := validateProcessLimits(ProcessLimitsConfig{ProcChat: {TimeoutSeconds: 600}, ProcTerminal: {AddressSpaceMB: 4096}}); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	if err := validateProcessLimits(ProcessLimitsConfig{"browser": {CPUSeconds: 1}}); err == nil {
+		t.Error("unknown class accepted")
+	}
+	if err := validateProcessLimits(ProcessLimitsConfig{ProcGit: {TimeoutSeconds: -1}}); err == nil {
+		t.Error("negative timeout accepted")
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/auth"
+	"markdown-themes-backend/db"
+	"markdown-themes-backend/utils"
+)
+
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// shareSignature signs the immutable parts of a share link.
+func shareSignature(id, path string, expiresAt int64) string {
+	return auth.Sign(fmt.Sprintf("share\n%s\n%s\n%d", id, path, expiresAt))
+}
+
+// shareURL builds the public, path-based URL for a share so relative
+// references inside shared HTML resolve within the share.
+func shareURL(s *db.Share) string {
+	u := fmt.Sprintf("/share/%s/%d/%s/", s.ID, s.ExpiresAt, shareSignature(s.ID, s.Path, s.ExpiresAt))
+	if !s.IsDir {
+		u += url.PathEscape(filepath.Base(s.Path))
+	}
+	return u
+}
+
+// ShareCreate handles POST /api/shares - mint a signed read-only link
+func ShareCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path       string `json:"path"`
+		TTLSeconds int64  `json:"ttlSeconds,omitempty"`
+		Note       string `json:"note,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		jsonError(w, "path required", http.StatusBadRequest)
+		return
+	}
+
+	path := req.Path
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	path = filepath.Clean(path)
+	if !filepath.IsAbs(path) {
+		jsonError(w, "path must be absolute", http.StatusBadRequest)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		jsonError(w, "path not found", http.StatusNotFound)
+		return
+	}
+	if !info.IsDir() && utils.IsSecretsFile(info.Name()) {
+		jsonError(w, "refusing to share a secrets file", http.StatusForbidden)
+		return
+	}
+
+	ttl := defaultShareTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxShareTTL {
+		ttl = maxShareTTL
+	}
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		jsonError(w, "failed to generate share id", http.StatusInternalServerError)
+		return
+	}
+
+	share := &db.Share{
+		ID:        hex.EncodeToString(idBytes),
+		Path:      path,
+		IsDir:     info.IsDir(),
+		Note:      req.Note,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(),
+	}
+	if err := db.CreateShare(share); err != nil {
+		log.Printf("[Share] Failed to create: %s", err)
+		jsonError(w, "failed to create share", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Share] Created %s for %s (expires %s)", share.ID, path, time.UnixMilli(share.ExpiresAt).Format(time.RFC3339))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"share": share,
+		"url":   shareURL(share),
+	})
+}
+
+// SharesList handles GET /api/shares - audit list of active shares
+func SharesList(w http.ResponseWriter, r *http.Request) {
+	shares, err := db.ListActiveShares()
+	if err != nil {
+		log.Printf("[Share] Failed to list: %s", err)
+		jsonError(w, "failed to list shares", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(shares))
+	for i := range shares {
+		result = append(result, map[string]interface{}{
+			"share": shares[i],
+			"url":   shareURL(&shares[i]),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"shares": result,
+		"count":  len(result),
+	})
+}
+
+// ShareRevoke handles DELETE /api/shares/{id}
+func ShareRevoke(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := db.RevokeShare(id); err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("[Share] Revoked %s", id)
+	jsonSuccess(w, nil)
+}
+
+// ShareServe handles GET /share/{id}/{expires}/{sig}/* - read-only access to
+// a shared file or subtree. The signature, expiry and revocation state are
+// all checked on every request.
+func ShareServe(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	sig := chi.URLParam(r, "sig")
+	expiresAt, err := strconv.ParseInt(chi.URLParam(r, "expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid share link", http.StatusNotFound)
+		return
+	}
+
+	share, err := db.GetShare(id)
+	if err != nil || share == nil || share.ExpiresAt != expiresAt ||
+		!auth.VerifySignature(fmt.Sprintf("share\n%s\n%s\n%d", share.ID, share.Path, share.ExpiresAt), sig) {
+		http.Error(w, "invalid share link", http.StatusNotFound)
+		return
+	}
+	if !share.Active() {
+		http.Error(w, "share link expired or revoked", http.StatusGone)
+		return
+	}
+
+	// Shared HTML runs in an opaque origin so it cannot call the API
+	w.Header().Set("Content-Security-Policy", "sandbox allow-scripts")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	target := share.Path
+	if share.IsDir {
+		target, err = resolveSharePath(share.Path, chi.URLParam(r, "*"))
+		if err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if utils.IsSecretsFile(info.Name()) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	if info.IsDir() {
+		indexPath, err := resolveSharePath(share.Path, filepath.Join(chi.URLParam(r, "*"), "index.html"))
+		if _, statErr := os.Stat(indexPath); err == nil && statErr == nil {
+			target = indexPath
+		} else {
+			db.RecordShareAccess(share.ID)
+			writeShareListing(w, r, target)
+			return
+		}
+	}
+	db.RecordShareAccess(share.ID)
+
+	// Text without a known media type (markdown, source) is shown inline
+	if mimeTypeFromExt(filepath.Ext(target)) == "application/octet-stream" && !utils.IsBinaryFile(target) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	writeFileBytes(w, target, "private, no-cache")
+}
+
+// resolveSharePath resolves a path inside a shared directory. Hidden files
+// and directories (dotfiles, .git/) are refused, as are paths that lead
+// outside the share, lexically or through a symlink.
+func resolveSharePath(root, rel string) (string, error) {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", fmt.Errorf("hidden path")
+		}
+	}
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if !withinDir(root, target) {
+		return "", fmt.Errorf("outside the share")
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realTarget, err := filepath.EvalSymlinks(target)
+	if os.IsNotExist(err) {
+		return target, nil // 404 later
+	}
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(realRoot, realTarget) {
+		return "", fmt.Errorf("outside the share")
+	}
+	return realTarget, nil
+}
+
+// withinDir reports whether path is dir or inside it (lexically).
+func withinDir(dir, path string) bool {
+	inside, err := filepath.Rel(dir, path)
+	return err == nil && inside != ".." && !strings.HasPrefix(inside, ".."+string(filepath.Separator))
+}
+
+// writeShareListing renders a minimal HTML index for a shared directory.
+func writeShareListing(w http.ResponseWriter, r *http.Request, dir string) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		http.Error(w, "failed to read directory", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!doctype html><meta charset=\"utf-8\"><title>%s</title><h1>%s</h1><ul>",
+		html.EscapeString(filepath.Base(dir)), html.EscapeString(filepath.Base(dir)))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || utils.IsSecretsFile(name) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>", html.EscapeString(url.PathEscape(entry.Name())+strings.TrimPrefix(name, entry.Name())), html.EscapeString(name))
+	}
+	b.WriteString("</ul>")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
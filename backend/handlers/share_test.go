@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/db"
+)
+
+// ---- ShareServe tests ----
+
+// initShareTestDB opens the (process-wide) database under a temporary data
+// home. db.Init runs once, so the directory outlives the test.
+func initShareTestDB(t *testing.T) {
+	t.Helper()
+	if db.Get() == nil {
+		dataHome, err := os.MkdirTemp("", "mt-share-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Setenv("XDG_DATA_HOME", dataHome)
+		if _, err := db.Init(); err != nil {
+			t.Fatalf("db.Init: %v", err)
+		}
+	}
+}
+
+// newTestShare stores a share for path expiring after ttl.
+func newTestShare(t *testing.T, id, path string, isDir bool, ttl time.Duration) *db.Share {
+	t.Helper()
+	share := &db.Share{ID: id, Path: path, IsDir: isDir, ExpiresAt: time.Now().Add(ttl).UnixMilli()}
+	if err := db.CreateShare(share); err != nil {
+		t.Fatalf("CreateShare: %v", err)
+	}
+	return share
+}
+
+func serveShare(target string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Get("/share/{id}/{expires}/{sig}/*", ShareServe)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestShareServe(t *testing.T) {
+	initShareTestDB(t)
+
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("outside"), 0644)
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.md"), []byte("# notes"), 0644)
+	os.WriteFile(filepath.Join(root, ".env.local"), []byte("TOKEN=x"), 0644)
+	os.Mkdir(filepath.Join(root, ".git"), 0755)
+	os.WriteFile(filepath.Join(root, ".git", "config"), []byte("[core]"), 0644)
+	os.Symlink(outside, filepath.Join(root, "escape"))
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret-link.txt"))
+	os.Mkdir(filepath.Join(root, "docs"), 0755)
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "docs", "index.html"))
+
+	dir := newTestShare(t, "testdir", root, true, time.Hour)
+	base := shareURL(dir)
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+		body   string
+	}{
+		{"file in share", base + "notes.md", http.StatusOK, "# notes"},
+		{"bad signature", "/share/testdir/" + strings.Split(base, "/")[3] + "/bogus/notes.md", http.StatusNotFound, ""},
+		{"wrong expiry", "/share/testdir/1/" + strings.Split(base, "/")[4] + "/notes.md", http.StatusNotFound, ""},
+		{"unknown share", "/share/nope/1/sig/notes.md", http.StatusNotFound, ""},
+		{"dot-dot traversal", base + "docs/../../" + filepath.Base(outside) + "/secret.txt", http.StatusBadRequest, ""},
+		{"dotfile", base + ".env.local", http.StatusBadRequest, ""},
+		{"git dir", base + ".git/config", http.StatusBadRequest, ""},
+		{"symlinked dir escape", base + "escape/secret.txt", http.StatusBadRequest, ""},
+		{"symlinked file escape", base + "secret-link.txt", http.StatusBadRequest, ""},
+		{"missing file", base + "missing.md", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serveShare(tt.target)
+		if w.Code != tt.want {
+			t.Errorf("%s: GET %s = %d, want %d", tt.name, tt.target, w.Code, tt.want)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+		if strings.Contains(w.Body.String(), "outside") {
+			t.Errorf("%s: served a file outside the share", tt.name)
+		}
+	}
+
+	// A symlinked index.html is not served in place of the listing
+	if w := serveShare(base + "docs/"); strings.Contains(w.Body.String(), "outside") {
+		t.Error("docs/: served a symlinked index.html outside the share")
+	}
+}
+
+func TestShareServe_SymlinkedRoot(t *testing.T) {
+	initShareTestDB(t)
+
+	// The shared directory is reached through a symlink (like /tmp on macOS)
+	realRoot := t.TempDir()
+	os.WriteFile(filepath.Join(realRoot, "index.html"), []byte("<h1>site</h1>"), 0644)
+	os.Mkdir(filepath.Join(realRoot, "docs"), 0755)
+	os.WriteFile(filepath.Join(realRoot, "docs", "index.html"), []byte("<h1>docs</h1>"), 0644)
+	root := filepath.Join(t.TempDir(), "site")
+	os.Symlink(realRoot, root)
+
+	base := shareURL(newTestShare(t, "testlinkedroot", root, true, time.Hour))
+	for target, want := range map[string]string{base: "<h1>site</h1>", base + "docs/": "<h1>docs</h1>"} {
+		if w := serveShare(target); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want index.html %q", target, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func TestShareServe_ExpiredAndRevoked(t *testing.T) {
+	initShareTestDB(t)
+
+	file := filepath.Join(t.TempDir(), "report.md")
+	os.WriteFile(file, []byte("report"), 0644)
+
+	active := newTestShare(t, "testactive", file, false, time.Hour)
+	if w := serveShare(shareURL(active)); w.Code != http.StatusOK || w.Body.String() != "report" {
+		t.Fatalf("active share: %d %q", w.Code, w.Body.String())
+	}
+
+	expired := newTestShare(t, "testexpired", file, false, -time.Minute)
+	if w := serveShare(shareURL(expired)); w.Code != http.StatusGone {
+		t.Errorf("expired share = %d, want %d", w.Code, http.StatusGone)
+	}
+
+	revoked := newTestShare(t, "testrevoked", file, false, time.Hour)
+	if err := db.RevokeShare(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveShare(shareURL(revoked)); w.Code != http.StatusGone {
+		t.Errorf("revoked share = %d, want %d", w.Code, http.StatusGone)
+	}
+}
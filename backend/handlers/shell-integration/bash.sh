@@ -0,0 +1,88 @@
+# Shell integration for bash terminals spawned by markdown-themes.
+# Loaded with --init-file: sources the usual startup files, then reports
+# command boundaries (OSC 133) and the working directory (OSC 7).
+
+if [ -n "$MDT_SHELL_LOGIN" ]; then
+	unset MDT_SHELL_LOGIN
+	[ -r /etc/profile ] && . /etc/profile
+	if [ -r ~/.bash_profile ]; then
+		. ~/.bash_profile
+	elif [ -r ~/.bash_login ]; then
+		. ~/.bash_login
+	elif [ -r ~/.profile ]; then
+		. ~/.profile
+	fi
+else
+	[ -r ~/.bashrc ] && . ~/.bashrc
+fi
+
+if [[ $- == *i* ]] && [ -z "$__mdt_integrated" ]; then
+	__mdt_integrated=1
+
+	# Inside tmux the sequence must be wrapped for passthrough
+	__mdt_osc() {
+		if [ -n "$TMUX" ]; then
+			printf '\ePtmux;\e\e]%s\a\e\\' "$1"
+		else
+			printf '\e]%s\a' "$1"
+		fi
+	}
+
+	__mdt_urlencode() {
+		local LC_ALL=C s="$1" out="" c i
+		for ((i = 0; i < ${#s}; i++)); do
+			c=${s:i:1}
+			case "$c" in
+			[a-zA-Z0-9/._~-]) out+="$c" ;;
+			*) printf -v c '%%%02X' "'$c"; out+="$c" ;;
+			esac
+		done
+		printf '%s' "$out"
+	}
+
+	__mdt_running=0
+	__mdt_at_prompt=0
+
+	# First in PROMPT_COMMAND so $? is still the command's status
+	__mdt_precmd() {
+		local ret=$?
+		if [ "$__mdt_running" = 1 ]; then
+			__mdt_osc "133;D;$ret"
+			__mdt_running=0
+		fi
+		__mdt_osc "7;file://${HOSTNAME}$(__mdt_urlencode "$PWD")"
+		__mdt_osc "133;A"
+	}
+
+	# Last in PROMPT_COMMAND: the next DEBUG trap is the user's command
+	__mdt_prompt_ready() {
+		__mdt_at_prompt=1
+	}
+
+	__mdt_preexec() {
+		[ "$__mdt_at_prompt" = 1 ] || return 0
+		__mdt_at_prompt=0
+		__mdt_running=1
+		local cmd
+		cmd=$(HISTTIMEFORMAT= builtin history 1)
+		if [[ $cmd =~ ^\ *[0-9]+\*?\ +(.*)$ ]]; then
+			cmd=${BASH_REMATCH[1]}
+		else
+			cmd=$BASH_COMMAND
+		fi
+		__mdt_osc "133;C;cmdline_url=$(__mdt_urlencode "$cmd")"
+	}
+
+	__mdt_pc=$PROMPT_COMMAND
+	while [[ $__mdt_pc == *[\;\ ] ]]; do
+		__mdt_pc=${__mdt_pc%?}
+	done
+	PROMPT_COMMAND="__mdt_precmd${__mdt_pc:+;$__mdt_pc};__mdt_prompt_ready"
+	unset __mdt_pc
+
+	# Backslashes are prompt escapes in PS1
+	__mdt_b=$(__mdt_osc '133;B')
+	PS1="${PS1}\[${__mdt_b//\\/\\\\}\]"
+	unset __mdt_b
+	trap '__mdt_preexec' DEBUG
+fi
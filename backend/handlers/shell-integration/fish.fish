@@ -0,0 +1,29 @@
+# Shell integration for fish terminals spawned by markdown-themes.
+# Loaded with --init-command after config.fish: reports command boundaries
+# (OSC 133) and the working directory (OSC 7).
+
+if status is-interactive; and not set -q __mdt_integrated
+    set -g __mdt_integrated 1
+
+    # Inside tmux the sequence must be wrapped for passthrough
+    function __mdt_osc
+        if set -q TMUX
+            printf '\ePtmux;\e\e]%s\a\e\\' $argv[1]
+        else
+            printf '\e]%s\a' $argv[1]
+        end
+    end
+
+    function __mdt_prompt --on-event fish_prompt
+        __mdt_osc "7;file://$hostname"(string escape --style=url -- $PWD)
+        __mdt_osc '133;A'
+    end
+
+    function __mdt_preexec --on-event fish_preexec
+        __mdt_osc "133;C;cmdline_url="(string escape --style=url -- $argv[1])
+    end
+
+    function __mdt_postexec --on-event fish_postexec
+        __mdt_osc "133;D;$status"
+    end
+end
@@ -0,0 +1,880 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Task runner. Long-running project processes (dev servers, watchers, test
+// runners) are defined per workspace in .mt/tasks.json or detected from
+// package.json scripts and Makefile targets, and run in the background
+// with their output kept in a ring buffer. Status changes and output are
+// published as "tasks:{workspace}" events for the hub's "tasks" topic.
+
+// TaskDef describes a task.
+type TaskDef struct {
+	Name         string            `json:"name"`
+	Command      string            `json:"command"`       // run with the user's shell (-c)
+	Cwd          string            `json:"cwd,omitempty"` // relative to the workspace
+	Env          map[string]string `json:"env,omitempty"`
+	AutoRestart  bool              `json:"autoRestart,omitempty"`  // restart after a crash
+	ReadyPattern string            `json:"readyPattern,omitempty"` // regexp matched against output lines
+	ReadyPort    int               `json:"readyPort,omitempty"`    // ready once localhost:port accepts connections
+	Source       string            `json:"source"`                 // config, package.json, Makefile
+}
+
+// TaskConfig is the format of .mt/tasks.json.
+type TaskConfig struct {
+	Tasks []TaskDef `json:"tasks"`
+}
+
+// Task sources
+const (
+	TaskSourceConfig   = "config"
+	TaskSourcePackage  = "package.json"
+	TaskSourceMakefile = "Makefile"
+)
+
+// TaskStatus is a task and the state of its process.
+type TaskStatus struct {
+	TaskDef
+	Workspace string `json:"workspace"`
+	Status    string `json:"status"` // idle, running, stopping, exited, crashed
+	Ready     bool   `json:"ready"`
+	PID       int    `json:"pid,omitempty"`
+	ExitCode  *int   `json:"exitCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Restarts  int    `json:"restarts"`
+	StartedAt int64  `json:"startedAt,omitempty"` // Unix ms
+	EndedAt   int64  `json:"endedAt,omitempty"`
+	RestartAt int64  `json:"restartAt,omitempty"` // when a crashed task will be restarted
+}
+
+// TaskLogLine is a line of a task's output.
+type TaskLogLine struct {
+	Seq    int64  `json:"seq"`
+	Stream string `json:"stream"` // stdout, stderr
+	Text   string `json:"text"`
+	Time   int64  `json:"time"` // Unix ms
+}
+
+const (
+	taskConfigFile = ".mt/tasks.json"
+	// taskLogLines is how many output lines are kept per task.
+	taskLogLines = 5000
+	// maxTaskLineBytes splits overlong lines (progress bars without
+	// newlines) so they can't grow without bound.
+	maxTaskLineBytes = 16 * 1024
+	taskKillGrace    = 5 * time.Second
+	// A task that ran at least this long before crashing is restarted
+	// without backoff.
+	taskStableRun       = 10 * time.Second
+	taskRestartDelay    = time.Second
+	maxTaskRestartDelay = 30 * time.Second
+	taskReadyProbe      = 500 * time.Millisecond
+)
+
+// --- Definitions ---
+
+// taskWorkspace validates a workspace directory and returns it cleaned.
+func taskWorkspace(workspace string) (string, error) {
+	if workspace == "" {
+		return "", fmt.Errorf("workspace required")
+	}
+	if strings.HasPrefix(workspace, "~") {
+		home, _ := os.UserHomeDir()
+		workspace = filepath.Join(home, workspace[1:])
+	}
+	workspace = filepath.Clean(workspace)
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("workspace is not a directory: %s", workspace)
+	}
+	return workspace, nil
+}
+
+// loadTaskDefs returns a workspace's configured tasks followed by the
+// detected ones not shadowed by a configured name. The error reports a
+// malformed config file; detected tasks are still returned.
+func loadTaskDefs(workspace string) ([]TaskDef, error) {
+	var defs []TaskDef
+	seen := make(map[string]bool)
+	var configErr error
+
+	if data, err := os.ReadFile(filepath.Join(workspace, taskConfigFile)); err == nil {
+		var config TaskConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			configErr = fmt.Errorf("%s: %w", taskConfigFile, err)
+		}
+		for i, def := range config.Tasks {
+			switch {
+			case def.Name == "" || strings.TrimSpace(def.Command) == "":
+				configErr = fmt.Errorf("%s: tasks[%d]: name and command are required", taskConfigFile, i)
+				continue
+			case seen[def.Name]:
+				configErr = fmt.Errorf("%s: duplicate task %q", taskConfigFile, def.Name)
+				continue
+			}
+			if def.ReadyPattern != "" {
+				if _, err := regexp.Compile(def.ReadyPattern); err != nil {
+					configErr = fmt.Errorf("%s: task %q: readyPattern: %w", taskConfigFile, def.Name, err)
+					continue
+				}
+			}
+			def.Source = TaskSourceConfig
+			seen[def.Name] = true
+			defs = append(defs, def)
+		}
+	}
+
+	for _, def := range append(packageScripts(workspace), makeTargets(workspace)...) {
+		if !seen[def.Name] {
+			seen[def.Name] = true
+			defs = append(defs, def)
+		}
+	}
+	return defs, configErr
+}
+
+// packageScripts returns a task ("npm:{script}") for each package.json
+// script, run with the package manager whose lock file is present.
+func packageScripts(workspace string) []TaskDef {
+	data, err := os.ReadFile(filepath.Join(workspace, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || len(pkg.Scripts) == 0 {
+		return nil
+	}
+
+	manager := "npm"
+	for _, lock := range []struct{ file, manager string }{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"bun.lockb", "bun"},
+		{"bun.lock", "bun"},
+	} {
+		if _, err := os.Stat(filepath.Join(workspace, lock.file)); err == nil {
+			manager = lock.manager
+			break
+		}
+	}
+
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defs := make([]TaskDef, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, TaskDef{
+			Name:    "npm:" + name,
+			Command: manager + " run " + name,
+			Source:  TaskSourcePackage,
+		})
+	}
+	return defs
+}
+
+// makeTargetPattern matches a rule's targets, but not variable assignments
+// (FOO := bar, FOO ::= bar).
+var makeTargetPattern = regexp.MustCompile(`^([A-Za-z0-9_./-][A-Za-z0-9_./ -]*?)\s*::?(?:[^=]|$)`)
+
+// makeTargets returns a task ("make:{target}") for each explicit target of
+// the workspace's Makefile, in file order.
+func makeTargets(workspace string) []TaskDef {
+	var data []byte
+	for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+		if d, err := os.ReadFile(filepath.Join(workspace, name)); err == nil {
+			data = d
+			break
+		}
+	}
+	if data == nil {
+		return nil
+	}
+	return parseMakeTargets(data)
+}
+
+// parseMakeTargets lists the explicit targets defined in a Makefile,
+// skipping special (.PHONY), pattern (%.o) and file (foo.o, dir/x)
+// targets.
+func parseMakeTargets(data []byte) []TaskDef {
+	var defs []TaskDef
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		m := makeTargetPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, target := range strings.Fields(m[1]) {
+			if strings.ContainsAny(target, "./%$") || seen[target] {
+				continue
+			}
+			seen[target] = true
+			defs = append(defs, TaskDef{
+				Name:    "make:" + target,
+				Command: "make " + target,
+				Source:  TaskSourceMakefile,
+			})
+		}
+	}
+	return defs
+}
+
+// --- Output buffer ---
+
+// logRing keeps the last lines of a task's output.
+type logRing struct {
+	lines []TaskLogLine
+	start int // index of the oldest line
+	count int
+	next  int64 // sequence number of the next line
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]TaskLogLine, size), next: 1}
+}
+
+// add appends a line, overwriting the oldest when full.
+func (r *logRing) add(stream, text string, at int64) TaskLogLine {
+	line := TaskLogLine{Seq: r.next, Stream: stream, Text: text, Time: at}
+	r.next++
+	if r.count < len(r.lines) {
+		r.lines[(r.start+r.count)%len(r.lines)] = line
+		r.count++
+	} else {
+		r.lines[r.start] = line
+		r.start = (r.start + 1) % len(r.lines)
+	}
+	return line
+}
+
+// after returns the lines with sequence numbers greater than seq, oldest
+// first; with limit > 0, only the newest limit of them.
+func (r *logRing) after(seq int64, limit int) []TaskLogLine {
+	result := []TaskLogLine{}
+	for i := 0; i < r.count; i++ {
+		if line := r.lines[(r.start+i)%len(r.lines)]; line.Seq > seq {
+			result = append(result, line)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// --- Runtime ---
+
+// task is a task's process state. A task exists from its first start
+// until the backend exits.
+type task struct {
+	workspace string
+	def       TaskDef
+	info      TaskStatus
+	logs      *logRing
+	readyRe   *regexp.Regexp
+	cmd       *exec.Cmd
+	done      chan struct{} // closed when the current process has exited
+	// stopping is set when the process was asked to stop, so its exit is
+	// neither a crash nor restarted
+	stopping bool
+	// crashes counts consecutive quick crashes, for restart backoff
+	crashes      int
+	restartTimer *time.Timer
+	mu           sync.Mutex
+}
+
+var (
+	tasks   = make(map[string]map[string]*task) // workspace → name → task
+	tasksMu sync.Mutex
+)
+
+// taskEventKey is the event key a workspace's task events are published
+// under.
+func taskEventKey(workspace string) string {
+	return "tasks:" + workspace
+}
+
+func (t *task) snapshot() TaskStatus {
+	info := t.info
+	info.TaskDef = t.def
+	info.Workspace = t.workspace
+	return info
+}
+
+// publishStatus sends a task-status event. Called without t.mu held.
+func (t *task) publishStatus() {
+	t.mu.Lock()
+	info := t.snapshot()
+	t.mu.Unlock()
+	publishEvent(taskEventKey(t.workspace), map[string]interface{}{
+		"type": "task-status",
+		"task": info,
+	})
+}
+
+// launch starts the task's process. Called with t.mu held.
+func (t *task) launch() error {
+	t.readyRe = nil
+	if t.def.ReadyPattern != "" {
+		re, err := regexp.Compile(t.def.ReadyPattern)
+		if err != nil {
+			return fmt.Errorf("invalid readyPattern: %w", err)
+		}
+		t.readyRe = re
+	}
+
+	cwd := t.workspace
+	if t.def.Cwd != "" {
+		cwd = filepath.Join(t.workspace, t.def.Cwd)
+	}
+	// Own process group so stopping reaches children (npm → node, make → cc)
+	cmd := processCommand(ProcTask, getShell(), "-c", t.def.Command)
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), "MDT_TASK="+t.def.Name)
+	for k, v := range t.def.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// Don't wait forever for grandchildren holding the pipes open
+	cmd.WaitDelay = taskKillGrace + time.Second
+	stdout := &taskOutputWriter{task: t, stream: "stdout"}
+	stderr := &taskOutputWriter{task: t, stream: "stderr"}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		t.info.Status = "crashed"
+		t.info.Error = err.Error()
+		t.info.PID = 0
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	done := make(chan struct{})
+	t.cmd = cmd.Cmd
+	t.done = done
+	t.stopping = false
+	t.info.Status = "running"
+	t.info.Ready = t.readyRe == nil && t.def.ReadyPort == 0
+	t.info.PID = cmd.Process.Pid
+	t.info.ExitCode = nil
+	t.info.Error = ""
+	t.info.StartedAt = time.Now().UnixMilli()
+	t.info.EndedAt = 0
+	t.info.RestartAt = 0
+	log.Printf("[Tasks] Started %s in %s: %s (pid %d)", t.def.Name, cwd, t.def.Command, cmd.Process.Pid)
+
+	if t.def.ReadyPort > 0 {
+		go t.probeReady(t.def.ReadyPort, done)
+	}
+	go func() {
+		err := cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+		t.exited(cmd, err)
+		close(done)
+	}()
+	return nil
+}
+
+// exited records the process's exit and schedules a restart if it crashed
+// and the task restarts automatically.
+func (t *task) exited(cmd *managedCmd, waitErr error) {
+	t.mu.Lock()
+	now := time.Now()
+	t.info.EndedAt = now.UnixMilli()
+	t.info.PID = 0
+	t.info.Ready = false
+	code := -1
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+		if code >= 0 {
+			t.info.ExitCode = &code
+		}
+	}
+	var exitErr *exec.ExitError
+	if cmd.TimedOut() {
+		t.info.Error = "timed out"
+	} else if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		t.info.Error = waitErr.Error()
+	}
+
+	crashed := !t.stopping && (waitErr != nil || code != 0)
+	if crashed {
+		t.info.Status = "crashed"
+		if now.Sub(time.UnixMilli(t.info.StartedAt)) >= taskStableRun {
+			t.crashes = 0
+		}
+		t.crashes++
+	} else {
+		t.info.Status = "exited"
+		t.crashes = 0
+	}
+
+	if crashed && t.def.AutoRestart {
+		delay := taskRestartDelay << (t.crashes - 1)
+		if delay > maxTaskRestartDelay || delay <= 0 {
+			delay = maxTaskRestartDelay
+		}
+		t.info.RestartAt = now.Add(delay).UnixMilli()
+		var timer *time.Timer
+		timer = time.AfterFunc(delay, func() {
+			t.mu.Lock()
+			if t.restartTimer != timer {
+				t.mu.Unlock()
+				return // stopped or started meanwhile
+			}
+			t.restartTimer = nil
+			t.info.Restarts++
+			if err := t.launch(); err != nil {
+				log.Printf("[Tasks] Failed to restart %s: %v", t.def.Name, err)
+			}
+			t.mu.Unlock()
+			t.publishStatus()
+		})
+		t.restartTimer = timer
+	}
+	name, status := t.def.Name, t.info.Status
+	t.mu.Unlock()
+
+	log.Printf("[Tasks] %s %s (exit %d)", name, status, code)
+	t.publishStatus()
+}
+
+// probeReady marks the task ready once its port accepts connections.
+func (t *task) probeReady(port int, done chan struct{}) {
+	ticker := time.NewTicker(taskReadyProbe)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)), taskReadyProbe)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			t.setReady(done)
+			return
+		}
+	}
+}
+
+// setReady marks the process that done belongs to as ready.
+func (t *task) setReady(done chan struct{}) {
+	t.mu.Lock()
+	if t.done != done || t.info.Status != "running" || t.info.Ready {
+		t.mu.Unlock()
+		return
+	}
+	t.info.Ready = true
+	name := t.def.Name
+	t.mu.Unlock()
+	log.Printf("[Tasks] %s ready", name)
+	t.publishStatus()
+}
+
+// stop asks the running process to exit (SIGTERM to its process group,
+// SIGKILL after a grace period) and cancels a pending restart. It returns
+// the channel closed when the process has exited, or nil if none was
+// running.
+func (t *task) stop() chan struct{} {
+	t.mu.Lock()
+	if t.restartTimer != nil {
+		t.restartTimer.Stop()
+		t.restartTimer = nil
+		t.info.RestartAt = 0
+	}
+	if t.info.Status != "running" && t.info.Status != "stopping" {
+		t.mu.Unlock()
+		return nil
+	}
+	done := t.done
+	if t.info.Status == "running" {
+		t.stopping = true
+		t.info.Status = "stopping"
+		pid := t.cmd.Process.Pid
+		syscall.Kill(-pid, syscall.SIGTERM)
+		go func() {
+			select {
+			case <-done:
+			case <-time.After(taskKillGrace):
+				syscall.Kill(-pid, syscall.SIGKILL)
+			}
+		}()
+		log.Printf("[Tasks] Stopping %s", t.def.Name)
+	}
+	t.mu.Unlock()
+	t.publishStatus()
+	return done
+}
+
+// taskOutputWriter turns one output stream into log lines, holding back a
+// partial line until its newline (or the end of the output).
+type taskOutputWriter struct {
+	task    *task
+	stream  string
+	pending []byte
+}
+
+func (w *taskOutputWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			if len(w.pending) < maxTaskLineBytes {
+				break
+			}
+			i = utf8CompletePrefix(w.pending[:maxTaskLineBytes])
+			lines = append(lines, string(w.pending[:i]))
+			w.pending = w.pending[i:]
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(string(w.pending[:i]), "\r"))
+		w.pending = w.pending[i+1:]
+	}
+	w.pending = append([]byte(nil), w.pending...)
+	w.task.appendOutput(w.stream, lines)
+	return len(p), nil
+}
+
+func (w *taskOutputWriter) flush() {
+	if len(w.pending) > 0 {
+		w.task.appendOutput(w.stream, []string{string(w.pending)})
+		w.pending = nil
+	}
+}
+
+// appendOutput buffers output lines, checks them for the ready pattern and
+// publishes them as a task-output event.
+func (t *task) appendOutput(stream string, texts []string) {
+	if len(texts) == 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	lines := make([]TaskLogLine, 0, len(texts))
+	t.mu.Lock()
+	becameReady := false
+	for _, text := range texts {
+		lines = append(lines, t.logs.add(stream, text, now))
+		if t.readyRe != nil && !t.info.Ready && t.info.Status == "running" && t.readyRe.MatchString(text) {
+			t.info.Ready = true
+			becameReady = true
+		}
+	}
+	name := t.def.Name
+	t.mu.Unlock()
+
+	publishEvent(taskEventKey(t.workspace), map[string]interface{}{
+		"type":      "task-output",
+		"workspace": t.workspace,
+		"name":      name,
+		"lines":     lines,
+	})
+	if becameReady {
+		log.Printf("[Tasks] %s ready", name)
+		t.publishStatus()
+	}
+}
+
+// lookupTask returns a task's runtime state, if it was ever started.
+func lookupTask(workspace, name string) *task {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	return tasks[workspace][name]
+}
+
+// StartTask starts a task that isn't running, with its current definition.
+func StartTask(workspace, name string) (*TaskStatus, error) {
+	workspace, err := taskWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	defs, _ := loadTaskDefs(workspace)
+	var def *TaskDef
+	for i := range defs {
+		if defs[i].Name == name {
+			def = &defs[i]
+			break
+		}
+	}
+	if def == nil {
+		return nil, fmt.Errorf("task %s not found", name)
+	}
+
+	tasksMu.Lock()
+	if tasks[workspace] == nil {
+		tasks[workspace] = make(map[string]*task)
+	}
+	t := tasks[workspace][name]
+	if t == nil {
+		t = &task{workspace: workspace, logs: newLogRing(taskLogLines)}
+		tasks[workspace][name] = t
+	}
+	tasksMu.Unlock()
+
+	t.mu.Lock()
+	if t.info.Status == "running" || t.info.Status == "stopping" {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("task %s is already running", name)
+	}
+	if t.restartTimer != nil {
+		t.restartTimer.Stop()
+		t.restartTimer = nil
+	}
+	t.def = *def
+	t.crashes = 0
+	t.info.Restarts = 0
+	err = t.launch()
+	info := t.snapshot()
+	t.mu.Unlock()
+	t.publishStatus()
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// StopTask stops a running task, or cancels the pending restart of a
+// crashed one.
+func StopTask(workspace, name string) (*TaskStatus, error) {
+	workspace, err := taskWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	t := lookupTask(workspace, name)
+	if t == nil {
+		return nil, fmt.Errorf("task %s is not running", name)
+	}
+	t.mu.Lock()
+	active := t.info.Status == "running" || t.info.Status == "stopping" || t.restartTimer != nil
+	t.mu.Unlock()
+	if !active {
+		return nil, fmt.Errorf("task %s is not running", name)
+	}
+
+	t.stop()
+	t.mu.Lock()
+	info := t.snapshot()
+	t.mu.Unlock()
+	return &info, nil
+}
+
+// RestartTask stops a task if it is running, waits for it to exit and
+// starts it again.
+func RestartTask(workspace, name string) (*TaskStatus, error) {
+	ws, err := taskWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	if t := lookupTask(ws, name); t != nil {
+		if done := t.stop(); done != nil {
+			select {
+			case <-done:
+			case <-time.After(taskKillGrace + 2*time.Second):
+				return nil, fmt.Errorf("task %s did not stop", name)
+			}
+		}
+	}
+	return StartTask(ws, name)
+}
+
+// ListTasks returns a workspace's tasks with their state: defined ones in
+// order, then any still running whose definition has gone. The error
+// reports a malformed config file.
+func ListTasks(workspace string) ([]TaskStatus, error) {
+	defs, configErr := loadTaskDefs(workspace)
+
+	tasksMu.Lock()
+	running := make(map[string]*task, len(tasks[workspace]))
+	for name, t := range tasks[workspace] {
+		running[name] = t
+	}
+	tasksMu.Unlock()
+
+	result := make([]TaskStatus, 0, len(defs))
+	for _, def := range defs {
+		if t, ok := running[def.Name]; ok {
+			delete(running, def.Name)
+			t.mu.Lock()
+			info := t.snapshot()
+			t.mu.Unlock()
+			// Show the current definition unless the process is using
+			// an older one
+			if info.Status != "running" && info.Status != "stopping" {
+				info.TaskDef = def
+			}
+			result = append(result, info)
+			continue
+		}
+		result = append(result, TaskStatus{TaskDef: def, Workspace: workspace, Status: "idle"})
+	}
+
+	var orphans []TaskStatus
+	for _, t := range running {
+		t.mu.Lock()
+		info := t.snapshot()
+		t.mu.Unlock()
+		if info.Status == "running" || info.Status == "stopping" {
+			orphans = append(orphans, info)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Name < orphans[j].Name })
+	return append(result, orphans...), configErr
+}
+
+// TaskWorkspaceEvents returns the initial event for a "tasks:{workspace}"
+// subscriber: the workspace's task list.
+func TaskWorkspaceEvents(workspace string) (map[string]interface{}, error) {
+	workspace, err := taskWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	list, configErr := ListTasks(workspace)
+	event := map[string]interface{}{
+		"type":      "task-list",
+		"workspace": workspace,
+		"tasks":     list,
+	}
+	if configErr != nil {
+		event["configError"] = configErr.Error()
+	}
+	return event, nil
+}
+
+// SubscribeTaskEvents registers fn for a workspace's task events.
+func SubscribeTaskEvents(workspace string, fn func(data interface{})) (func(), error) {
+	workspace, err := taskWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return SubscribeEvents(taskEventKey(workspace), fn), nil
+}
+
+// StopAllTasks stops every running task and waits (up to the kill grace
+// period) for them to exit. Called on shutdown.
+func StopAllTasks() {
+	tasksMu.Lock()
+	var all []*task
+	for _, byName := range tasks {
+		for _, t := range byName {
+			all = append(all, t)
+		}
+	}
+	tasksMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range all {
+		if done := t.stop(); done != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-done
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// --- HTTP Handlers ---
+
+// TasksList handles GET /api/tasks?workspace=... - the workspace's tasks
+// and their status
+func TasksList(w http.ResponseWriter, r *http.Request) {
+	workspace, err := taskWorkspace(r.URL.Query().Get("workspace"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, configErr := ListTasks(workspace)
+	resp := map[string]interface{}{
+		"workspace": workspace,
+		"tasks":     list,
+	}
+	if configErr != nil {
+		resp["configError"] = configErr.Error()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// taskAction runs start, stop or restart for a task named in the URL.
+func taskAction(w http.ResponseWriter, r *http.Request, action func(workspace, name string) (*TaskStatus, error)) {
+	info, err := action(r.URL.Query().Get("workspace"), chi.URLParam(r, "name"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+// TaskStart handles POST /api/tasks/{name}/start?workspace=...
+func TaskStart(w http.ResponseWriter, r *http.Request) {
+	taskAction(w, r, StartTask)
+}
+
+// TaskStop handles POST /api/tasks/{name}/stop?workspace=...
+func TaskStop(w http.ResponseWriter, r *http.Request) {
+	taskAction(w, r, StopTask)
+}
+
+// TaskRestart handles POST /api/tasks/{name}/restart?workspace=...
+func TaskRestart(w http.ResponseWriter, r *http.Request) {
+	taskAction(w, r, RestartTask)
+}
+
+// TaskLogs handles GET /api/tasks/{name}/logs?workspace=...&after=&limit= -
+// buffered output lines after the given sequence number (default: the
+// last 500)
+func TaskLogs(w http.ResponseWriter, r *http.Request) {
+	workspace, err := taskWorkspace(r.URL.Query().Get("workspace"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 500
+	}
+	if limit > taskLogLines {
+		limit = taskLogLines
+	}
+
+	lines := []TaskLogLine{}
+	if t := lookupTask(workspace, chi.URLParam(r, "name")); t != nil {
+		t.mu.Lock()
+		lines = t.logs.after(after, limit)
+		t.mu.Unlock()
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lines": lines,
+	})
+}
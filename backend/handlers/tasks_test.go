@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ---- Task runner tests ----
+
+func TestLogRing_KeepsNewestLines(t *testing.T) {
+	r := newLogRing(3)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		r.add("stdout", text, 0)
+	}
+	texts := func(lines []TaskLogLine) string {
+		var out []string
+		for _, l := range lines {
+			out = append(out, fmt.Sprintf("%d:%s", l.Seq, l.Text))
+		}
+		return strings.Join(out, " ")
+	}
+	if got := texts(r.after(0, 0)); got != "3:c 4:d 5:e" {
+		t.Errorf("after(0) = %q", got)
+	}
+	if got := texts(r.after(4, 0)); got != "5:e" {
+		t.Errorf("after(4) = %q", got)
+	}
+	if got := texts(r.after(0, 2)); got != "4:d 5:e" {
+		t.Errorf("after(0, 2) = %q", got)
+	}
+	if got := r.after(5, 0); len(got) != 0 {
+		t.Errorf("after(5) = %v", got)
+	}
+}
+
+func TestParseMakeTargets_SkipsVariablesAndSpecialTargets(t *testing.T) {
+	makefile := `# Build everything
+CFLAGS := -O2
+PREFIX ?= /usr/local
+VERSION = $(shell git describe)
+.PHONY: all build test
+all: build
+build test: deps
+	go build ./...
+%.o: %.c
+	cc -c $<
+dist/app: main.go
+lint::
+deps:
+build:
+`
+	var names []string
+	for _, def := range parseMakeTargets([]byte(makefile)) {
+		names = append(names, def.Name)
+		if def.Command != "make "+strings.TrimPrefix(def.Name, "make:") {
+			t.Errorf("%s: command = %q", def.Name, def.Command)
+		}
+	}
+	want := "make:all make:build make:test make:lint make:deps"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("targets = %q, want %q", got, want)
+	}
+}
@@ -17,22 +17,44 @@ import (
 	"github.com/creack/pty"
 )
 
-// TerminalSession represents an active terminal with a PTY attached to a tmux session
+// TerminalSession represents an active terminal with a PTY attached to a
+// tmux session or, on the plain PTY backend, directly to the shell
 type TerminalSession struct {
 	ID          string    `json:"id"`
-	TmuxSession string    `json:"tmuxSession"` // tmux session name (same as ID for mt-* terminals)
+	TmuxSession string    `json:"tmuxSession"` // tmux session name (same as ID for mt-* terminals, empty on the pty backend)
+	Backend     string    `json:"backend"`     // "tmux" or "pty" (see terminal_backend.go)
 	Cwd         string    `json:"cwd"`
 	Cols        uint16    `json:"cols"`
 	Rows        uint16    `json:"rows"`
 	CreatedAt   time.Time `json:"createdAt"`
 
+	// Metadata persisted in the terminal_sessions table so it survives a
+	// backend restart (see terminal_persist.go)
+	ProfileID      string     `json:"profileId,omitempty"`
+	ProfileName    string     `json:"profileName,omitempty"`
+	Command        string     `json:"command,omitempty"`
+	Title          string     `json:"title,omitempty"`
+	TabOrder       int        `json:"tabOrder"`
+	LastAttachedAt *time.Time `json:"lastAttachedAt,omitempty"`
+
 	ptmx *os.File
 	cmd  *exec.Cmd
 
-	// Subscribed WebSocket clients (managed via interface to avoid import cycle)
-	clients map[interface{}]bool
+	// Recent output, kept by the pty backend for replay on reconnect, and
+	// closed when its shell exits
+	scrollback *outputBuffer
+	exited     chan struct{}
+
+	// Subscribed WebSocket clients (managed via interface to avoid import
+	// cycle) and their roles; see terminal_roles.go
+	clients map[interface{}]*terminalSubscriber
+	subSeq  uint64
 	mu      sync.Mutex
 
+	// Held while output is buffered and broadcast, so a client can be
+	// subscribed and sent the history without missing output in between
+	outputMu sync.Mutex
+
 	// Stop signal for the read goroutine
 	done chan struct{}
 
@@ -61,6 +83,35 @@ type TerminalManager struct {
 	closedFunc func(sessionID string)
 	// Callback to broadcast a message to ALL connected WebSocket clients
 	broadcastAllFunc func(message interface{})
+	// Callback to send a message to a session's subscribed clients
+	sessionEventFunc func(sessionID string, message interface{})
+
+	// Active asciicast recordings (by session ID) and playbacks (by playback ID)
+	recorders map[string]*recorder
+	playbacks map[string]*playback
+	recMu     sync.Mutex
+
+	// Shell integration state (cwd, command history) by session ID
+	shells  map[string]*shellTracker
+	shellMu sync.Mutex
+
+	// Activity monitoring state by session ID
+	activity   map[string]*activityState
+	activityMu sync.Mutex
+
+	// CPU samples for process inspection
+	procSampler *processSampler
+
+	// Input groups by name
+	groups   map[string]*InputGroup
+	groupsMu sync.Mutex
+
+	// Command audit log writer
+	audit *auditLog
+
+	// Listening ports of terminal processes, by port
+	ports   map[int]OpenPort
+	portsMu sync.RWMutex
 }
 
 var (
@@ -79,9 +130,22 @@ func GetTerminalManager() *TerminalManager {
 			disconnectTimers:    make(map[string]*time.Timer),
 			recentSpawnRequests: make(map[string]time.Time),
 			recentSpawnKeys:     make(map[string]time.Time),
+			recorders:           make(map[string]*recorder),
+			playbacks:           make(map[string]*playback),
+			shells:              make(map[string]*shellTracker),
+			activity:            make(map[string]*activityState),
+			procSampler:         &processSampler{samples: make(map[int]cpuSample)},
+			groups:              make(map[string]*InputGroup),
+			audit:               newAuditLog(),
+			ports:               make(map[int]OpenPort),
 		}
 		// Background goroutine prunes stale dedup entries every 10 seconds.
 		go termManager.pruneSpawnDedup()
+		go termManager.monitorActivity()
+		go termManager.monitorProcesses()
+		go termManager.monitorPorts()
+		go termManager.audit.run()
+		go termManager.pruneAuditLog()
 	})
 	return termManager
 }
@@ -152,6 +216,19 @@ func (tm *TerminalManager) SetBroadcastAllFunc(fn func(message interface{})) {
 	tm.broadcastAllFunc = fn
 }
 
+// SetSessionEventFunc sets the callback for sending a message to the
+// clients subscribed to one session
+func (tm *TerminalManager) SetSessionEventFunc(fn func(sessionID string, message interface{})) {
+	tm.sessionEventFunc = fn
+}
+
+// sendSessionEvent sends a message to the clients subscribed to a session.
+func (tm *TerminalManager) sendSessionEvent(sessionID string, message interface{}) {
+	if tm.sessionEventFunc != nil {
+		tm.sessionEventFunc(sessionID, message)
+	}
+}
+
 // getShell returns the user's default shell
 func getShell() string {
 	shell := os.Getenv("SHELL")
@@ -283,19 +360,114 @@ func buildPTYEnv(sessionID string, cols, rows uint16) []string {
 	return env
 }
 
-// SpawnSession creates a new terminal session backed by a tmux session.
-// It first creates a detached tmux session, force-reloads the config, then
-// attaches a PTY to the tmux session. The tmux session survives PTY/WebSocket
-// disconnects so clients can reconnect later.
+// SpawnOptions configures a new terminal session.
+type SpawnOptions struct {
+	ID          string
+	Cwd         string
+	Cols        uint16
+	Rows        uint16
+	Command     string            // run instead of an interactive shell
+	Shell       string            // overrides $SHELL
+	Login       bool              // run the shell as a login shell
+	PreCommand  string            // run before Command or the interactive prompt
+	Env         map[string]string // extra environment variables
+	TmuxOptions map[string]string // tmux session options (history-limit, status-style, ...)
+	// ShellIntegration loads the OSC 133/7 snippet into interactive shells
+	ShellIntegration bool
+	// Backend is "tmux", "pty" or "" for tmux when it's installed
+	Backend string
+
+	// Metadata stored with the session record
+	ProfileID   string
+	ProfileName string
+	Title       string
+	TabOrder    int
+}
+
+// shellQuote quotes s for a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellCommand builds the command tmux runs in the session's first pane.
+// A pre-command runs in the same shell as the command; for an interactive
+// session the shell then execs a fresh interactive shell, which keeps the
+// environment and cwd set up by the pre-command.
+func (o SpawnOptions) shellCommand() string {
+	shell := o.Shell
+	if shell == "" {
+		shell = getShell()
+	}
+	invoke := shellQuote(shell)
+	integrated := false
+	if o.ShellIntegration && o.Command == "" {
+		var args string
+		args, _, integrated = shellIntegrationInvoke(shell, o.Login, o.Env)
+		invoke += args
+	}
+	if o.Login && !integrated {
+		invoke += " -l"
+	}
+
+	script := o.Command
+	if o.PreCommand != "" {
+		if script == "" {
+			script = o.PreCommand + "\nexec " + invoke
+		} else {
+			script = o.PreCommand + "\n" + script
+		}
+	}
+	if script == "" {
+		return invoke
+	}
+	return invoke + " -c " + shellQuote(script)
+}
+
+// shellEnv returns the session's environment variables: the configured
+// ones plus those the shell integration scripts need.
+func (o SpawnOptions) shellEnv() map[string]string {
+	env := make(map[string]string, len(o.Env))
+	for k, v := range o.Env {
+		env[k] = v
+	}
+	if o.ShellIntegration && o.Command == "" {
+		shell := o.Shell
+		if shell == "" {
+			shell = getShell()
+		}
+		if _, extra, ok := shellIntegrationInvoke(shell, o.Login, o.Env); ok {
+			for k, v := range extra {
+				env[k] = v
+			}
+		}
+	}
+	return env
+}
+
+// SpawnSession creates a new terminal session running the user's login
+// shell (or command) in cwd. See Spawn.
 func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, command string) (*TerminalSession, error) {
+	return tm.Spawn(SpawnOptions{ID: id, Cwd: cwd, Cols: cols, Rows: rows, Command: command, Login: true})
+}
+
+// Spawn creates a new terminal session on the backend chosen by
+// opts.Backend (tmux when installed, see selectBackend).
+func (tm *TerminalManager) Spawn(opts SpawnOptions) (*TerminalSession, error) {
+	backend, err := selectBackend(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	id := opts.ID
 	if _, exists := tm.sessions[id]; exists {
 		return nil, fmt.Errorf("session %s already exists", id)
 	}
 
 	// Validate/default cwd
+	cwd := opts.Cwd
 	if cwd == "" {
 		cwd, _ = os.UserHomeDir()
 	}
@@ -303,6 +475,7 @@ func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, comma
 		cwd, _ = os.UserHomeDir()
 	}
 
+	cols, rows := opts.Cols, opts.Rows
 	if cols == 0 {
 		cols = 80
 	}
@@ -310,6 +483,33 @@ func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, comma
 		rows = 24
 	}
 
+	session, err := backend.Spawn(tm, opts, cwd, cols, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	session.ProfileID = opts.ProfileID
+	session.ProfileName = opts.ProfileName
+	session.Command = opts.Command
+	session.Title = opts.Title
+	session.TabOrder = opts.TabOrder
+	session.LastAttachedAt = &session.CreatedAt
+	persistSession(session)
+
+	log.Printf("[Terminal] Session %s spawned (%s, cwd: %s, %dx%d)", id, session.Backend, cwd, cols, rows)
+	return session, nil
+}
+
+// tmuxHistoryLimitMu serializes spawns that change the global history-limit
+// so each restores the value it found.
+var tmuxHistoryLimitMu sync.Mutex
+
+// Spawn creates a detached tmux session, force-reloads the config, then
+// attaches a PTY to the tmux session. The tmux session survives PTY/WebSocket
+// disconnects so clients can reconnect later. Caller holds tm.mu.
+func (tmuxBackend) Spawn(tm *TerminalManager, opts SpawnOptions, cwd string, cols, rows uint16) (*TerminalSession, error) {
+	id := opts.ID
+
 	// The tmux session name matches the terminal ID (mt-{profile}-{uuid}).
 	tmuxSessionName := id
 	configPath := tmuxConfigPath()
@@ -317,30 +517,54 @@ func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, comma
 	// Build clean env for the tmux session.
 	env := buildPTYEnv(id, cols, rows)
 
-	// Step 1: Create detached tmux session.
-	// If a command was specified, wrap it in a login shell invocation.
-	shell := getShell()
-	var shellCmd string
-	if command != "" {
-		shellCmd = shell + " -l -c " + command
-	} else {
-		shellCmd = shell + " -l"
+	// Step 1: Create detached tmux session running the shell (or command).
+	createArgs := []string{"-f", configPath}
+
+	// history-limit only applies to panes created after it is set, so it is
+	// set globally around new-session and restored in the same tmux
+	// invocation: tmux runs the command list without interleaving other
+	// clients' commands, so no other pane picks up the profile's limit.
+	var restoreHistoryLimit []string
+	if historyLimit, ok := opts.TmuxOptions["history-limit"]; ok {
+		tmuxHistoryLimitMu.Lock()
+		tmuxCmd("start-server").Run()
+		previous := "2000"
+		if out, err := tmuxCmd("show-options", "-gv", "history-limit").Output(); err == nil && len(strings.TrimSpace(string(out))) > 0 {
+			previous = strings.TrimSpace(string(out))
+		}
+		createArgs = append(createArgs, "set-option", "-g", "history-limit", historyLimit, ";")
+		restoreHistoryLimit = []string{"set-option", "-g", "history-limit", previous}
 	}
 
-	createArgs := []string{
-		"-f", configPath,
+	createArgs = append(createArgs,
 		"new-session", "-d",
 		"-s", tmuxSessionName,
 		"-c", cwd,
 		"-x", fmt.Sprintf("%d", cols),
 		"-y", fmt.Sprintf("%d", rows),
-		shellCmd,
+	)
+	// Profile env vars go to the session's processes, not just the tmux client
+	for k, v := range opts.shellEnv() {
+		createArgs = append(createArgs, "-e", k+"="+v)
 	}
+	createArgs = append(createArgs, opts.shellCommand())
+	if restoreHistoryLimit != nil {
+		createArgs = append(append(createArgs, ";"), restoreHistoryLimit...)
+	}
+
 	createCmd := exec.Command("tmux", createArgs...)
 	createCmd.Env = env
-	if out, err := createCmd.CombinedOutput(); err != nil {
+	out, err := createCmd.CombinedOutput()
+	if restoreHistoryLimit != nil {
+		if err != nil {
+			tmuxCmd(restoreHistoryLimit...).Run() // the command list stops at a failed new-session
+		}
+		tmuxHistoryLimitMu.Unlock()
+	}
+	if err != nil {
 		return nil, fmt.Errorf("tmux new-session failed: %w (output: %s)", err, strings.TrimSpace(string(out)))
 	}
+	limitTmuxPanes(tmuxSessionName)
 
 	// Step 2: Force-reload config to handle pre-existing tmux server with different settings.
 	reloadCmd := tmuxCmd("source-file", configPath)
@@ -348,6 +572,30 @@ func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, comma
 		log.Printf("[Terminal] tmux source-file warning: %v (output: %s)", err, strings.TrimSpace(string(out)))
 	}
 
+	// Colors from the app theme; profile options below take precedence
+	applyStoredTheme(tmuxSessionName)
+
+	// Per-session tmux options from the profile
+	for key, value := range opts.TmuxOptions {
+		if out, err := tmuxCmd("set-option", "-t", tmuxSessionName, key, value).CombinedOutput(); err != nil {
+			log.Printf("[Terminal] tmux set-option %s warning: %v (output: %s)", key, err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// New windows and panes start the same interactive shell
+	if opts.Command == "" {
+		if out, err := tmuxCmd("set-option", "-t", tmuxSessionName, paneShellOption, opts.shellCommand()).CombinedOutput(); err != nil {
+			log.Printf("[Terminal] tmux set-option %s warning: %v (output: %s)", paneShellOption, err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// Shell integration marks reach us through tmux's passthrough escape
+	if _, set := opts.TmuxOptions["allow-passthrough"]; opts.ShellIntegration && !set {
+		if out, err := tmuxCmd("set-option", "-t", tmuxSessionName, "allow-passthrough", "on").CombinedOutput(); err != nil {
+			log.Printf("[Terminal] tmux allow-passthrough unavailable (shell integration disabled): %v (output: %s)", err, strings.TrimSpace(string(out)))
+		}
+	}
+
 	// Step 3: Attach PTY to the tmux session.
 	session, err := tm.attachToTmux(id, tmuxSessionName, cwd, cols, rows, env)
 	if err != nil {
@@ -355,8 +603,6 @@ func (tm *TerminalManager) SpawnSession(id, cwd string, cols, rows uint16, comma
 		tmuxKillSession(tmuxSessionName)
 		return nil, err
 	}
-
-	log.Printf("[Terminal] Session %s spawned (tmux: %s, cwd: %s, %dx%d)", id, tmuxSessionName, cwd, cols, rows)
 	return session, nil
 }
 
@@ -368,10 +614,18 @@ func (tm *TerminalManager) ReconnectSession(id, tmuxSessionName string, cols, ro
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	// A plain PTY session keeps its PTY while it runs; reconnecting is
+	// just subscribing again (history comes from its output buffer)
+	if existing, ok := tm.sessions[id]; ok && !existing.backend().Persistent() {
+		touchSession(existing)
+		return existing, nil
+	}
+
 	// If we already have a session entry (either a live PTY or a recovery
 	// placeholder), supersede it so its output reader stops broadcasting
 	// and the new PTY takes over.
-	if oldSession, exists := tm.sessions[id]; exists {
+	oldSession, hadSession := tm.sessions[id]
+	if hadSession {
 		log.Printf("[Terminal] ReconnectSession %s: superseding old session entry", id)
 		oldSession.supersededMu.Lock()
 		oldSession.superseded = true
@@ -410,6 +664,22 @@ func (tm *TerminalManager) ReconnectSession(id, tmuxSessionName string, cols, ro
 		return nil, err
 	}
 
+	// Carry the metadata over from the superseded entry, or from the
+	// persisted record when this process has never seen the session
+	if hadSession {
+		copySessionMeta(session, oldSession)
+		// Other windows stay subscribed, with their roles
+		oldSession.mu.Lock()
+		for c, sub := range oldSession.clients {
+			session.clients[c] = sub
+		}
+		session.subSeq = oldSession.subSeq
+		oldSession.mu.Unlock()
+	} else {
+		restoreSessionMeta(session)
+	}
+	touchSession(session)
+
 	log.Printf("[Terminal] Session %s reconnected to tmux session %s", id, tmuxSessionName)
 	return session, nil
 }
@@ -435,13 +705,14 @@ func (tm *TerminalManager) attachToTmux(id, tmuxSessionName, cwd string, cols, r
 	session := &TerminalSession{
 		ID:          id,
 		TmuxSession: tmuxSessionName,
+		Backend:     BackendTmux,
 		Cwd:         cwd,
 		Cols:        cols,
 		Rows:        rows,
 		CreatedAt:   time.Now(),
 		ptmx:        ptmx,
 		cmd:         cmd,
-		clients:     make(map[interface{}]bool),
+		clients:     make(map[interface{}]*terminalSubscriber),
 		done:        make(chan struct{}),
 	}
 
@@ -480,6 +751,10 @@ func (tm *TerminalManager) attachToTmux(id, tmuxSessionName, cwd string, cols, r
 			// but the session is alive for reconnection.
 			if !tmuxHasSession(tmuxSessionName) {
 				log.Printf("[Terminal] Session %s tmux session exited", id)
+				forgetSession(id)
+				tm.forgetShell(id)
+				tm.forgetActivity(id)
+				tm.forgetGroupMember(id)
 				if tm.closedFunc != nil {
 					tm.closedFunc(id)
 				}
@@ -524,11 +799,18 @@ func (tm *TerminalManager) readPTY(session *TerminalSession) {
 				log.Printf("[Terminal] readPTY for %s: superseded after read, dropping %d bytes", session.ID, n)
 				return
 			}
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			session.outputMu.Lock()
+			if session.scrollback != nil {
+				session.scrollback.Write(data)
+			}
 			if tm.broadcastFunc != nil {
-				data := make([]byte, n)
-				copy(data, buf[:n])
 				tm.broadcastFunc(session.ID, data)
 			}
+			session.outputMu.Unlock()
+			tm.recordOutput(session.ID, data)
+			tm.trackShell(session.ID, data)
 		}
 		if err != nil {
 			if err != io.EOF {
@@ -545,8 +827,10 @@ func (tm *TerminalManager) readPTY(session *TerminalSession) {
 	}
 }
 
-// WriteToSession writes input data to a terminal session's PTY
-func (tm *TerminalManager) WriteToSession(id string, data []byte) error {
+// WriteToSession writes input data to a terminal session's PTY on behalf
+// of client, which must be the owner or a writer. A nil client is the
+// server itself and may always write.
+func (tm *TerminalManager) WriteToSession(id string, client interface{}, data []byte) error {
 	tm.mu.RLock()
 	session, ok := tm.sessions[id]
 	tm.mu.RUnlock()
@@ -555,6 +839,11 @@ func (tm *TerminalManager) WriteToSession(id string, data []byte) error {
 		return fmt.Errorf("session %s not found", id)
 	}
 
+	if err := session.checkWriter(client); err != nil {
+		return err
+	}
+	tm.auditInput(session, data)
+
 	_, err := session.ptmx.Write(data)
 	return err
 }
@@ -578,6 +867,7 @@ func (tm *TerminalManager) ResizeSession(id string, cols, rows uint16) error {
 	session.Rows = rows
 	session.mu.Unlock()
 
+	tm.recordResize(id, cols, rows)
 	return nil
 }
 
@@ -595,7 +885,6 @@ func (tm *TerminalManager) CloseSession(id string) error {
 		timer.Stop()
 		delete(tm.disconnectTimers, id)
 	}
-	tmuxName := session.TmuxSession
 	tm.mu.Unlock()
 
 	// Signal read goroutine to stop
@@ -607,8 +896,9 @@ func (tm *TerminalManager) CloseSession(id string) error {
 		session.ptmx.Close()
 	}
 
-	// Wait for process to exit (with timeout)
-	if session.cmd != nil {
+	// Wait for process to exit (with timeout). A plain PTY shell is
+	// reaped by waitPTY instead.
+	if session.cmd != nil && session.exited == nil {
 		doneCh := make(chan error, 1)
 		go func() { doneCh <- session.cmd.Wait() }()
 		select {
@@ -618,12 +908,17 @@ func (tm *TerminalManager) CloseSession(id string) error {
 		}
 	}
 
-	// Kill the tmux session so it doesn't linger
-	if tmuxName != "" {
-		tmuxKillSession(tmuxName)
-	}
+	// Kill the tmux session (or the shell's process group) so it doesn't linger
+	session.backend().Kill(session)
+
+	// Finish any recording (the session can't produce more output)
+	tm.StopRecording(id)
+	forgetSession(id)
+	tm.forgetShell(id)
+	tm.forgetActivity(id)
+	tm.forgetGroupMember(id)
 
-	log.Printf("[Terminal] Session %s closed (tmux %s killed)", id, tmuxName)
+	log.Printf("[Terminal] Session %s closed (%s shell killed)", id, session.Backend)
 	return nil
 }
 
@@ -666,40 +961,47 @@ func (tm *TerminalManager) DisconnectSession(id string) error {
 	return nil
 }
 
-// AddClient subscribes a client to a session's output.
+// AddClient subscribes a client to a session's output and returns its role
+// (see addSubscriber for how requestedRole is used).
 // If a grace-period timer is pending (no subscribers), it is cancelled.
-func (tm *TerminalManager) AddClient(sessionID string, client interface{}) {
+func (tm *TerminalManager) AddClient(sessionID string, client interface{}, requestedRole string) string {
 	tm.mu.RLock()
 	session, ok := tm.sessions[sessionID]
 	tm.mu.RUnlock()
 	if !ok {
-		return
+		return ""
 	}
 	session.mu.Lock()
-	session.clients[client] = true
+	role := session.addSubscriber(client, requestedRole)
 	session.mu.Unlock()
 
 	tm.cancelGraceTimer(sessionID)
+	tm.notifySubscribers(sessionID)
+	return role
 }
 
-// RemoveClient unsubscribes a client from a session's output.
+// RemoveClient unsubscribes a client from a session's output and returns
+// how many clients remain subscribed.
 // If the session has zero subscribers after removal, a 30-second grace timer
 // starts. If no one reconnects before it fires, the PTY is killed.
-func (tm *TerminalManager) RemoveClient(sessionID string, client interface{}) {
+func (tm *TerminalManager) RemoveClient(sessionID string, client interface{}) int {
 	tm.mu.RLock()
 	session, ok := tm.sessions[sessionID]
 	tm.mu.RUnlock()
 	if !ok {
-		return
+		return 0
 	}
 	session.mu.Lock()
-	delete(session.clients, client)
-	remaining := len(session.clients)
+	_, subscribed := session.clients[client]
+	remaining := session.removeSubscriber(client)
 	session.mu.Unlock()
 
 	if remaining == 0 {
 		tm.startGraceTimer(sessionID)
+	} else if subscribed {
+		tm.notifySubscribers(sessionID)
 	}
+	return remaining
 }
 
 // GetClients returns all subscribed clients for a session
@@ -735,22 +1037,27 @@ func (tm *TerminalManager) RemoveAllClientSessions(client interface{}) {
 
 	for _, info := range infos {
 		info.session.mu.Lock()
-		delete(info.session.clients, client)
-		remaining := len(info.session.clients)
+		_, subscribed := info.session.clients[client]
+		remaining := info.session.removeSubscriber(client)
 		info.session.mu.Unlock()
 
 		if remaining == 0 {
 			tm.startGraceTimer(info.id)
+		} else if subscribed {
+			tm.notifySubscribers(info.id)
 		}
 	}
+
+	tm.stopClientPlaybacks(client)
 }
 
 // gracePeriod is the time to wait before killing a PTY with no subscribers.
 const gracePeriod = 30 * time.Second
 
 // startGraceTimer begins a countdown for a session with zero subscribers.
-// When the timer fires, if the session still has zero subscribers, CloseSession
-// is called. The caller must NOT hold tm.mu.
+// When the timer fires, if the session still has zero subscribers, its PTY
+// is disconnected (tmux) or the session is closed (pty backend, after its
+// longer grace period). The caller must NOT hold tm.mu.
 func (tm *TerminalManager) startGraceTimer(sessionID string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
@@ -760,9 +1067,16 @@ func (tm *TerminalManager) startGraceTimer(sessionID string) {
 		return
 	}
 
-	log.Printf("[Terminal] Session %s has 0 subscribers, starting %v grace timer", sessionID, gracePeriod)
+	grace := gracePeriod
+	persistent := true
+	if session, ok := tm.sessions[sessionID]; ok {
+		grace = session.backend().GracePeriod()
+		persistent = session.backend().Persistent()
+	}
+
+	log.Printf("[Terminal] Session %s has 0 subscribers, starting %v grace timer", sessionID, grace)
 
-	tm.disconnectTimers[sessionID] = time.AfterFunc(gracePeriod, func() {
+	tm.disconnectTimers[sessionID] = time.AfterFunc(grace, func() {
 		// Timer fired -- check if the session still has zero subscribers.
 		tm.mu.RLock()
 		session, ok := tm.sessions[sessionID]
@@ -792,6 +1106,15 @@ func (tm *TerminalManager) startGraceTimer(sessionID string) {
 		delete(tm.disconnectTimers, sessionID)
 		tm.mu.Unlock()
 
+		if !persistent {
+			// The shell can't outlive its PTY: nobody came back, so end it
+			log.Printf("[Terminal] Grace period expired for session %s, closing plain PTY session", sessionID)
+			if err := tm.CloseSession(sessionID); err != nil {
+				log.Printf("[Terminal] Failed to close session %s after grace period: %v", sessionID, err)
+			}
+			return
+		}
+
 		log.Printf("[Terminal] Grace period expired for session %s, disconnecting PTY (tmux stays alive)", sessionID)
 		if err := tm.DisconnectSession(sessionID); err != nil {
 			log.Printf("[Terminal] Failed to disconnect session %s after grace period: %v", sessionID, err)
@@ -864,6 +1187,7 @@ func (tm *TerminalManager) ScanOrphanedSessions() {
 func (tm *TerminalManager) RecoverOrphanedSessions() {
 	orphans := tm.ListOrphanedTmuxSessions()
 	if len(orphans) == 0 {
+		loadSessionRecords() // prunes records of sessions that died meanwhile
 		log.Printf("[Terminal] Recovery: no orphaned tmux sessions found")
 		// Still broadcast so the frontend knows recovery ran and can prune stale tabs
 		if tm.broadcastAllFunc != nil {
@@ -877,11 +1201,8 @@ func (tm *TerminalManager) RecoverOrphanedSessions() {
 
 	log.Printf("[Terminal] Recovery: found %d orphaned mt-* tmux sessions: %v", len(orphans), orphans)
 
-	type recoveredInfo struct {
-		ID  string `json:"id"`
-		Cwd string `json:"cwd"`
-	}
-	var recovered []recoveredInfo
+	records := loadSessionRecords()
+	var recovered []TerminalSession
 
 	tm.mu.Lock()
 	for _, name := range orphans {
@@ -890,29 +1211,33 @@ func (tm *TerminalManager) RecoverOrphanedSessions() {
 			continue
 		}
 
-		// Get the working directory from the tmux session's active pane
-		cwd := ""
-		cwdCmd := tmuxCmd("display-message", "-p", "-t", name, "#{pane_current_path}")
-		if out, err := cwdCmd.Output(); err == nil {
-			cwd = strings.TrimSpace(string(out))
-		}
-
 		// Register a placeholder session (no PTY, no cmd) so it appears in
 		// ListSessions. The frontend will trigger a reconnect which attaches a PTY.
 		session := &TerminalSession{
 			ID:          name,
 			TmuxSession: name,
-			Cwd:         cwd,
-			CreatedAt:   time.Now(),
-			clients:     make(map[interface{}]bool),
+			Backend:     BackendTmux,
+			clients:     make(map[interface{}]*terminalSubscriber),
 			done:        make(chan struct{}),
 		}
+		if rec, ok := records[name]; ok {
+			applySessionRecord(session, rec)
+		} else {
+			// No record (e.g. spawned by an older backend): fall back to
+			// what tmux knows about the session
+			cwdCmd := tmuxCmd("display-message", "-p", "-t", name, "#{pane_current_path}")
+			if out, err := cwdCmd.Output(); err == nil {
+				session.Cwd = strings.TrimSpace(string(out))
+			}
+			session.CreatedAt = tmuxSessionCreated(name)
+		}
 		tm.sessions[name] = session
 
-		recovered = append(recovered, recoveredInfo{ID: name, Cwd: cwd})
-		log.Printf("[Terminal] Recovery: registered orphaned session %s (cwd: %s)", name, cwd)
+		recovered = append(recovered, session.snapshot())
+		log.Printf("[Terminal] Recovery: registered orphaned session %s (cwd: %s, profile: %s)", name, session.Cwd, session.ProfileName)
 	}
 	tm.mu.Unlock()
+	sortSessions(recovered)
 
 	// Broadcast to all connected clients so the frontend can reconcile
 	if tm.broadcastAllFunc != nil {
@@ -931,15 +1256,9 @@ func (tm *TerminalManager) ListSessions() []TerminalSession {
 
 	result := make([]TerminalSession, 0, len(tm.sessions))
 	for _, s := range tm.sessions {
-		result = append(result, TerminalSession{
-			ID:          s.ID,
-			TmuxSession: s.TmuxSession,
-			Cwd:         s.Cwd,
-			Cols:        s.Cols,
-			Rows:        s.Rows,
-			CreatedAt:   s.CreatedAt,
-		})
+		result = append(result, s.snapshot())
 	}
+	sortSessions(result)
 	return result
 }
 
@@ -975,54 +1294,79 @@ func (tm *TerminalManager) ListOrphanedTmuxSessions() []string {
 	return orphans
 }
 
-// --- Profile management ---
-
-// TerminalProfile represents a saved terminal profile
-type TerminalProfile struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Command string `json:"command,omitempty"`
-	Cwd     string `json:"cwd,omitempty"`
-}
-
-func profilesPath() string {
-	dataDir := os.Getenv("XDG_DATA_HOME")
-	if dataDir == "" {
-		home, _ := os.UserHomeDir()
-		dataDir = filepath.Join(home, ".local", "share")
-	}
-	return filepath.Join(dataDir, "markdown-themes", "terminal-profiles.json")
+// spawnRequest is a client's request for a new terminal, over the WebSocket
+// or the automation API.
+type spawnRequest struct {
+	ID          string
+	ProfileID   string
+	ProfileName string
+	Cwd         string
+	Command     string
+	Workspace   string // value of {{workspace}} (defaults to Cwd)
+	File        string // value of {{file}}
+	Title       string
+	Cols        uint16
+	Rows        uint16
+	TabOrder    int
+	Backend     string // overrides the profile's backend
+	// ShellIntegration overrides the profile's setting (default off)
+	ShellIntegration *bool
 }
 
-// LoadProfiles reads saved terminal profiles
-func LoadProfiles() ([]TerminalProfile, error) {
-	data, err := os.ReadFile(profilesPath())
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []TerminalProfile{
-				{ID: "default-shell", Name: "Shell", Cwd: "{{workspace}}"},
-			}, nil
+// spawnOptions resolves the request's profile (if any) and expands
+// placeholders server-side. Explicit cwd/command/size override the profile.
+func (req spawnRequest) spawnOptions() (SpawnOptions, error) {
+	workspace := req.Workspace
+	if workspace == "" && !strings.Contains(req.Cwd, "{{") {
+		workspace = req.Cwd
+	}
+	vars := NewTemplateVars(workspace, req.File)
+	opts := SpawnOptions{ID: req.ID, Login: true}
+	profileName := req.ProfileName
+	if req.ProfileID != "" {
+		profile, err := FindProfile(req.ProfileID)
+		if err != nil {
+			return SpawnOptions{}, err
+		}
+		opts = profile.SpawnOptions(req.ID, vars)
+		if profileName == "" {
+			profileName = profile.Name
 		}
-		return nil, err
 	}
-	var profiles []TerminalProfile
-	if err := json.Unmarshal(data, &profiles); err != nil {
-		return nil, err
+	if req.Cwd != "" {
+		opts.Cwd = vars.Expand(req.Cwd)
+	}
+	if req.Command != "" {
+		opts.Command = vars.ExpandShell(req.Command)
+	}
+	if req.Cols != 0 {
+		opts.Cols = req.Cols
+	}
+	if req.Rows != 0 {
+		opts.Rows = req.Rows
 	}
-	return profiles, nil
+	opts.ProfileID = req.ProfileID
+	opts.ProfileName = profileName
+	opts.Title = req.Title
+	opts.TabOrder = req.TabOrder
+	if req.Backend != "" {
+		opts.Backend = req.Backend
+	}
+	if req.ShellIntegration != nil {
+		opts.ShellIntegration = *req.ShellIntegration
+	}
+	return opts, nil
 }
 
-// SaveProfiles writes terminal profiles to disk
-func SaveProfiles(profiles []TerminalProfile) error {
-	path := profilesPath()
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
+// tagProfile sets the @profile tmux option so the status bar can display
+// the profile name.
+func tagProfile(tmuxSession, profileName string) {
+	if profileName == "" || tmuxSession == "" {
+		return
 	}
-	data, err := json.MarshalIndent(profiles, "", "  ")
-	if err != nil {
-		return err
+	if out, err := tmuxCmd("set-option", "-t", tmuxSession, "@profile", profileName).CombinedOutput(); err != nil {
+		log.Printf("[Terminal] tmux set @profile warning: %v (output: %s)", err, strings.TrimSpace(string(out)))
 	}
-	return os.WriteFile(path, data, 0644)
 }
 
 // --- HTTP Handlers ---
@@ -1038,30 +1382,6 @@ func TerminalList(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// TerminalProfiles returns saved profiles
-func TerminalProfiles(w http.ResponseWriter, r *http.Request) {
-	profiles, err := LoadProfiles()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	json.NewEncoder(w).Encode(profiles)
-}
-
-// SaveTerminalProfile saves terminal profiles
-func SaveTerminalProfile(w http.ResponseWriter, r *http.Request) {
-	var profiles []TerminalProfile
-	if err := json.NewDecoder(r.Body).Decode(&profiles); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	if err := SaveProfiles(profiles); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-}
-
 // HandleTerminalMessage processes WebSocket terminal messages
 func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(interface{}), client interface{}) {
 	tm := GetTerminalManager()
@@ -1075,6 +1395,28 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 		Rows        int    `json:"rows,omitempty"`
 		RequestID   string `json:"requestId,omitempty"`
 		ProfileName string `json:"profileName,omitempty"`
+		// Server-side profile resolution: profile to spawn and the values
+		// for its {{workspace}} / {{file}} placeholders
+		ProfileID string `json:"profileId,omitempty"`
+		Workspace string `json:"workspace,omitempty"`
+		File      string `json:"file,omitempty"`
+		// Lines of history to replay on reconnect (0 = default, -1 = none)
+		ScrollbackLines int `json:"scrollbackLines,omitempty"`
+		// Input group to send terminal-input to instead of one terminal
+		Group string `json:"group,omitempty"`
+		// Initial tab position, persisted with the session
+		TabOrder int `json:"tabOrder,omitempty"`
+		// Load the shell integration snippet (overrides the profile)
+		ShellIntegration *bool `json:"shellIntegration,omitempty"`
+		// Role requested when attaching: "viewer" joins read-only even
+		// when nobody owns the session
+		Role string `json:"role,omitempty"`
+		// Recording and playback
+		Title      string  `json:"title,omitempty"`
+		Recording  string  `json:"recording,omitempty"`
+		PlaybackID string  `json:"playbackId,omitempty"`
+		Speed      float64 `json:"speed,omitempty"`
+		MaxIdle    float64 `json:"maxIdle,omitempty"`
 	}
 	if err := json.Unmarshal(raw, &msg); err != nil {
 		log.Printf("[Terminal] Failed to parse message: %v", err)
@@ -1100,11 +1442,36 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			return
 		}
 
-		session, err := tm.SpawnSession(msg.TerminalID, msg.Cwd, cols, rows, msg.Command)
+		opts, err := spawnRequest{
+			ID:          msg.TerminalID,
+			ProfileID:   msg.ProfileID,
+			ProfileName: msg.ProfileName,
+			Cwd:         msg.Cwd,
+			Command:     msg.Command,
+			Workspace:   msg.Workspace,
+			File:        msg.File,
+			Title:       msg.Title,
+			Cols:        cols,
+			Rows:        rows,
+			TabOrder:    msg.TabOrder,
+
+			ShellIntegration: msg.ShellIntegration,
+		}.spawnOptions()
 		if err != nil {
-			// If spawn failed because the tmux session already exists (e.g., after
-			// backend restart with orphaned sessions), fall back to reconnect
-			if tmuxHasSession(msg.TerminalID) {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-error",
+				"terminalId": msg.TerminalID,
+				"error":      err.Error(),
+			})
+			return
+		}
+
+		reconnected := false
+		session, err := tm.Spawn(opts)
+		if err != nil {
+			// If spawn failed because the session already exists (e.g., after
+			// backend restart with orphaned tmux sessions), fall back to reconnect
+			if tm.sessionAlive(msg.TerminalID) {
 				log.Printf("[Terminal] Spawn failed but tmux session exists, falling back to reconnect: %s", msg.TerminalID)
 				session, err = tm.ReconnectSession(msg.TerminalID, msg.TerminalID, cols, rows)
 				if err != nil {
@@ -1115,6 +1482,7 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 					})
 					return
 				}
+				reconnected = true
 			} else {
 				clientSend(map[string]interface{}{
 					"type":       "terminal-error",
@@ -1125,15 +1493,14 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			}
 		}
 
-		// Set @profile tmux option so the status bar can display the profile name
-		if msg.ProfileName != "" {
-			setProfileCmd := tmuxCmd("set-option", "-t", session.TmuxSession, "@profile", msg.ProfileName)
-			if out, err := setProfileCmd.CombinedOutput(); err != nil {
-				log.Printf("[Terminal] tmux set @profile warning: %v (output: %s)", err, strings.TrimSpace(string(out)))
-			}
-		}
+		tagProfile(session.TmuxSession, opts.ProfileName)
 
-		tm.AddClient(session.ID, client)
+		var role string
+		if reconnected {
+			role = tm.addClientWithScrollback(clientSend, session, client, msg.Role, msg.ScrollbackLines)
+		} else {
+			role = tm.AddClient(session.ID, client, msg.Role)
+		}
 
 		clientSend(map[string]interface{}{
 			"type":        "terminal-spawned",
@@ -1142,7 +1509,11 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			"cwd":         session.Cwd,
 			"cols":        session.Cols,
 			"rows":        session.Rows,
+			"role":        role,
 		})
+		if reconnected {
+			tm.sendGroupIndicator(clientSend, session.ID)
+		}
 
 	case "terminal-reconnect":
 		// Reconnect to an existing tmux session. The tmux session name is the
@@ -1157,8 +1528,8 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			return
 		}
 
-		// Verify the tmux session exists
-		if !tmuxHasSession(tmuxName) {
+		// Verify the tmux session (or plain PTY session) exists
+		if !tm.sessionAlive(tmuxName) {
 			clientSend(map[string]interface{}{
 				"type":       "terminal-error",
 				"terminalId": msg.TerminalID,
@@ -1179,7 +1550,8 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			return
 		}
 
-		tm.AddClient(session.ID, client)
+		// Replay history before live output resumes
+		role := tm.addClientWithScrollback(clientSend, session, client, msg.Role, msg.ScrollbackLines)
 
 		clientSend(map[string]interface{}{
 			"type":        "terminal-spawned",
@@ -1189,11 +1561,17 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			"cols":        session.Cols,
 			"rows":        session.Rows,
 			"reconnected": true,
+			"role":        role,
 		})
+		tm.sendGroupIndicator(clientSend, session.ID)
 
 	case "terminal-disconnect":
 		// Graceful disconnect: close PTY but keep tmux session alive.
-		tm.RemoveClient(msg.TerminalID, client)
+		// A plain PTY session instead keeps running for its grace period,
+		// as does any session other clients are still attached to.
+		if remaining := tm.RemoveClient(msg.TerminalID, client); remaining > 0 || !tm.persistent(msg.TerminalID) {
+			return
+		}
 		if err := tm.DisconnectSession(msg.TerminalID); err != nil {
 			// Not an error if session doesn't exist (already disconnected)
 			log.Printf("[Terminal] Disconnect note: %v", err)
@@ -1205,22 +1583,131 @@ func HandleTerminalMessage(msgType string, raw json.RawMessage, clientSend func(
 			log.Printf("[Terminal] Failed to decode input: %v", err)
 			return
 		}
-		if err := tm.WriteToSession(msg.TerminalID, data); err != nil {
+		if msg.Group != "" {
+			results, err := tm.WriteToGroup(msg.Group, client, data)
+			if err != nil {
+				clientSend(map[string]interface{}{
+					"type":  "terminal-group-error",
+					"group": msg.Group,
+					"error": err.Error(),
+				})
+				return
+			}
+			for _, r := range results {
+				if r.Error != "" {
+					clientSend(map[string]interface{}{
+						"type":       "terminal-input-rejected",
+						"terminalId": r.TerminalID,
+						"group":      msg.Group,
+						"error":      r.Error,
+					})
+				}
+			}
+			return
+		}
+		if err := tm.WriteToSession(msg.TerminalID, client, data); err != nil {
+			if err == ErrReadOnly {
+				clientSend(map[string]interface{}{
+					"type":       "terminal-input-rejected",
+					"terminalId": msg.TerminalID,
+					"error":      err.Error(),
+				})
+				return
+			}
 			log.Printf("[Terminal] Write error: %v", err)
 		}
 
 	case "terminal-resize":
+		// The PTY size is shared; viewers follow the writers' size
+		if !canWrite(tm.ClientRole(msg.TerminalID, client)) {
+			return
+		}
 		if err := tm.ResizeSession(msg.TerminalID, uint16(msg.Cols), uint16(msg.Rows)); err != nil {
 			log.Printf("[Terminal] Resize error: %v", err)
 		}
 
 	case "terminal-close":
 		// DESTRUCTIVE: kills PTY AND tmux session
+		if !canWrite(tm.ClientRole(msg.TerminalID, client)) {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-error",
+				"terminalId": msg.TerminalID,
+				"error":      "only the owner or a writer can close the session; disconnect instead",
+			})
+			return
+		}
 		tm.RemoveClient(msg.TerminalID, client)
 		if err := tm.CloseSession(msg.TerminalID); err != nil {
 			log.Printf("[Terminal] Close error: %v", err)
 		}
 
+	case "terminal-record-start":
+		info, err := tm.StartRecording(msg.TerminalID, msg.Title)
+		if err != nil {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-error",
+				"terminalId": msg.TerminalID,
+				"error":      err.Error(),
+			})
+			return
+		}
+		clientSend(map[string]interface{}{
+			"type":       "terminal-record-started",
+			"terminalId": msg.TerminalID,
+			"recording":  info,
+		})
+
+	case "terminal-record-stop":
+		info, err := tm.StopRecording(msg.TerminalID)
+		if err != nil {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-error",
+				"terminalId": msg.TerminalID,
+				"error":      err.Error(),
+			})
+			return
+		}
+		clientSend(map[string]interface{}{
+			"type":       "terminal-record-stopped",
+			"terminalId": msg.TerminalID,
+			"recording":  info,
+		})
+
+	case "terminal-playback":
+		// Stream a recording; maxIdle caps pauses (seconds), speed scales time
+		if err := tm.StartPlayback(msg.PlaybackID, msg.Recording, msg.Speed, msg.MaxIdle, clientSend, client); err != nil {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-playback-error",
+				"playbackId": msg.PlaybackID,
+				"error":      err.Error(),
+			})
+		}
+
+	case "terminal-playback-speed", "terminal-playback-pause", "terminal-playback-resume", "terminal-playback-stop":
+		action := strings.TrimPrefix(msgType, "terminal-playback-")
+		if err := tm.ControlPlayback(msg.PlaybackID, action, msg.Speed); err != nil {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-playback-error",
+				"playbackId": msg.PlaybackID,
+				"error":      err.Error(),
+			})
+		}
+
+	case "terminal-group-set", "terminal-group-member", "terminal-group-delete", "terminal-group-list":
+		handleTerminalGroupMessage(msgType, raw, clientSend)
+
+	case "terminal-pane-input":
+		handleTerminalPaneMessage(raw, clientSend, client)
+
+	case "terminal-resolve-link":
+		handleTerminalLinkMessage(raw, clientSend)
+
+	case "terminal-take-control", "terminal-request-control", "terminal-handoff", "terminal-set-role", "terminal-subscribers":
+		handleTerminalRoleMessage(msgType, raw, clientSend, client)
+
+	case "terminal-meta", "terminal-reorder":
+		handleTerminalMetaMessage(msgType, raw, clientSend)
+
 	case "terminal-list":
 		active := tm.ListSessions()
 		orphans := tm.ListOrphanedTmuxSessions()
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Activity monitoring ---
+//
+// Background terminals report four kinds of terminal-activity events to
+// every client: a bell, output after a period of silence, silence after a
+// period of output, and (with shell integration) a finished command. Bells
+// and commands come from the PTY stream via trackShell. Activity and
+// silence come from tmux's per-window activity timestamps, since the
+// attached PTY also carries tmux's own redraws (status line, clock).
+
+// Kinds of terminal-activity events
+const (
+	ActivityBell            = "bell"
+	ActivityOutput          = "activity"
+	ActivitySilence         = "silence"
+	ActivityCommandFinished = "command-finished"
+)
+
+const (
+	// activityPollInterval is how often tmux is asked for window activity.
+	activityPollInterval = time.Second
+	// bellCooldown rate-limits bell events per session.
+	bellCooldown = 3 * time.Second
+)
+
+// NotificationRules selects which activity events a profile's terminals
+// emit. Durations are in seconds; zero means the default.
+type NotificationRules struct {
+	Bell bool `json:"bell"`
+	// Activity: output after at least ActivityAfter seconds of silence
+	Activity      bool `json:"activity"`
+	ActivityAfter int  `json:"activityAfter,omitempty"`
+	// Silence: no output for SilenceAfter seconds after some output
+	Silence      bool `json:"silence"`
+	SilenceAfter int  `json:"silenceAfter,omitempty"`
+	// CommandFinished: a command that ran at least CommandMinDuration
+	// seconds finished (needs shell integration)
+	CommandFinished    bool `json:"commandFinished"`
+	CommandMinDuration int  `json:"commandMinDuration,omitempty"`
+}
+
+// defaultNotificationRules apply to terminals without a profile or whose
+// profile has no rules.
+var defaultNotificationRules = NotificationRules{Bell: true, CommandFinished: true}
+
+func (r NotificationRules) activityAfter() time.Duration {
+	if r.ActivityAfter <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(r.ActivityAfter) * time.Second
+}
+
+func (r NotificationRules) silenceAfter() time.Duration {
+	if r.SilenceAfter <= 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(r.SilenceAfter) * time.Second
+}
+
+func (r NotificationRules) commandMinDuration() time.Duration {
+	if r.CommandMinDuration <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(r.CommandMinDuration) * time.Second
+}
+
+// Validate rejects negative durations.
+func (r *NotificationRules) Validate() error {
+	if r.ActivityAfter < 0 || r.SilenceAfter < 0 || r.CommandMinDuration < 0 {
+		return fmt.Errorf("notifications: durations can't be negative")
+	}
+	return nil
+}
+
+// activityState tracks one session's activity between polls.
+type activityState struct {
+	rules        NotificationRules
+	lastActivity time.Time // latest tmux window activity seen
+	active       bool      // output seen since the last silence event
+	lastBell     time.Time
+	mu           sync.Mutex
+}
+
+// observe takes the session's latest activity time and returns the event
+// it triggers ("" for none) and, for activity, how long it had been silent.
+func (a *activityState) observe(activity, now time.Time) (string, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// The first observation is only a baseline
+	if a.lastActivity.IsZero() {
+		a.lastActivity = activity
+		return "", 0
+	}
+
+	if activity.After(a.lastActivity) {
+		gap := activity.Sub(a.lastActivity)
+		a.lastActivity = activity
+		a.active = true
+		if a.rules.Activity && gap >= a.rules.activityAfter() {
+			return ActivityOutput, gap
+		}
+		return "", 0
+	}
+
+	if a.active && now.Sub(a.lastActivity) >= a.rules.silenceAfter() {
+		a.active = false
+		if a.rules.Silence {
+			return ActivitySilence, 0
+		}
+	}
+	return "", 0
+}
+
+// activityFor returns the activity state of a session, resolving its
+// notification rules from its profile the first time.
+func (tm *TerminalManager) activityFor(sessionID string) *activityState {
+	tm.activityMu.Lock()
+	st, ok := tm.activity[sessionID]
+	tm.activityMu.Unlock()
+	if ok {
+		return st
+	}
+
+	st = &activityState{rules: tm.notificationRules(sessionID)}
+	tm.activityMu.Lock()
+	if existing, ok := tm.activity[sessionID]; ok {
+		st = existing
+	} else {
+		tm.activity[sessionID] = st
+	}
+	tm.activityMu.Unlock()
+	return st
+}
+
+// notificationRules returns the rules of the session's profile, or the
+// defaults.
+func (tm *TerminalManager) notificationRules(sessionID string) NotificationRules {
+	tm.mu.RLock()
+	profileID := ""
+	if s, ok := tm.sessions[sessionID]; ok {
+		profileID = s.ProfileID
+	}
+	tm.mu.RUnlock()
+
+	if profileID != "" {
+		if p, err := FindProfile(profileID); err == nil && p.Notifications != nil {
+			return *p.Notifications
+		}
+	}
+	return defaultNotificationRules
+}
+
+// forgetActivity drops the activity state of a closed session.
+func (tm *TerminalManager) forgetActivity(sessionID string) {
+	tm.activityMu.Lock()
+	delete(tm.activity, sessionID)
+	tm.activityMu.Unlock()
+}
+
+// noteBell handles a BEL in a session's output.
+func (tm *TerminalManager) noteBell(sessionID string) {
+	st := tm.activityFor(sessionID)
+	now := time.Now()
+	st.mu.Lock()
+	fire := st.rules.Bell && now.Sub(st.lastBell) >= bellCooldown
+	if fire {
+		st.lastBell = now
+	}
+	st.mu.Unlock()
+
+	if fire {
+		tm.emitActivity(sessionID, ActivityBell, nil)
+	}
+}
+
+// noteCommandFinished handles a command completion reported by shell
+// integration.
+func (tm *TerminalManager) noteCommandFinished(sessionID string, rec *CommandRecord) {
+	rules := tm.activityFor(sessionID).rules
+	if !rules.CommandFinished || time.Duration(rec.DurationMs)*time.Millisecond < rules.commandMinDuration() {
+		return
+	}
+	tm.emitActivity(sessionID, ActivityCommandFinished, map[string]interface{}{"command": rec})
+}
+
+// emitActivity broadcasts a terminal-activity event to all clients, so a
+// window can notify about a terminal it isn't showing.
+func (tm *TerminalManager) emitActivity(sessionID, kind string, extra map[string]interface{}) {
+	msg := map[string]interface{}{
+		"type":       "terminal-activity",
+		"terminalId": sessionID,
+		"kind":       kind,
+		"at":         time.Now().UnixMilli(),
+	}
+	tm.mu.RLock()
+	if s, ok := tm.sessions[sessionID]; ok {
+		msg["title"] = s.Title
+		msg["profileName"] = s.ProfileName
+	}
+	tm.mu.RUnlock()
+	for k, v := range extra {
+		msg[k] = v
+	}
+
+	if tm.broadcastAllFunc != nil {
+		tm.broadcastAllFunc(msg)
+	}
+}
+
+// monitorActivity polls tmux for window activity while sessions with
+// activity or silence rules exist.
+func (tm *TerminalManager) monitorActivity() {
+	ticker := time.NewTicker(activityPollInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		tm.pollActivity(now)
+	}
+}
+
+func (tm *TerminalManager) pollActivity(now time.Time) {
+	tm.mu.RLock()
+	ids := make([]string, 0, len(tm.sessions))
+	for id := range tm.sessions {
+		ids = append(ids, id)
+	}
+	tm.mu.RUnlock()
+
+	// Drop state of sessions that are gone
+	live := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		live[id] = true
+	}
+	tm.activityMu.Lock()
+	for id := range tm.activity {
+		if !live[id] {
+			delete(tm.activity, id)
+		}
+	}
+	tm.activityMu.Unlock()
+
+	states := make(map[string]*activityState)
+	for _, id := range ids {
+		if st := tm.activityFor(id); st.rules.Activity || st.rules.Silence {
+			states[id] = st
+		}
+	}
+	if len(states) == 0 {
+		return
+	}
+
+	// tmux tracks activity per window; plain PTY sessions by their buffer
+	latest := make(map[string]time.Time)
+	tmuxSessions := false
+	tm.mu.RLock()
+	for id := range states {
+		if session, ok := tm.sessions[id]; ok && session.scrollback != nil {
+			if t := session.scrollback.LastWrite(); !t.IsZero() {
+				latest[id] = t
+			}
+		} else {
+			tmuxSessions = true
+		}
+	}
+	tm.mu.RUnlock()
+	if tmuxSessions {
+		out, err := tmuxCmd("list-windows", "-a", "-F", "#{session_name} #{window_activity}").Output()
+		if err != nil {
+			log.Printf("[Terminal] Activity poll failed: %v", err)
+		}
+		for id, t := range parseWindowActivity(string(out)) {
+			latest[id] = t
+		}
+	}
+
+	for id, st := range states {
+		activity, ok := latest[id]
+		if !ok {
+			continue
+		}
+		switch kind, gap := st.observe(activity, now); kind {
+		case ActivityOutput:
+			tm.emitActivity(id, kind, map[string]interface{}{"idleSeconds": int(gap.Seconds())})
+		case ActivitySilence:
+			tm.emitActivity(id, kind, map[string]interface{}{"silentSeconds": int(now.Sub(activity).Seconds())})
+		}
+	}
+}
+
+// parseWindowActivity reads "session unix-time" lines into the latest
+// activity time per session. (tmux replaces tabs in formats, so the
+// separator is a space; mt-* session names have none.)
+func parseWindowActivity(out string) map[string]time.Time {
+	latest := make(map[string]time.Time)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		name, ts, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		secs, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(secs, 0); t.After(latest[name]) {
+			latest[name] = t
+		}
+	}
+	return latest
+}
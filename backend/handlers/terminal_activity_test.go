@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// ---- Activity monitor tests ----
+
+func TestActivityState_ActivityAndSilence(t *testing.T) {
+	st := &activityState{rules: NotificationRules{Activity: true, ActivityAfter: 30, Silence: true, SilenceAfter: 10}}
+	t0 := time.Unix(1000, 0)
+
+	if kind, _ := st.observe(t0, t0); kind != "" {
+		t.Errorf("first observation should be a baseline, got %q", kind)
+	}
+	// Output 5s later: not silent long enough to count as activity
+	if kind, _ := st.observe(t0.Add(5*time.Second), t0.Add(5*time.Second)); kind != "" {
+		t.Errorf("expected no event, got %q", kind)
+	}
+	// No output for 10s after it: silence, once
+	now := t0.Add(15 * time.Second)
+	if kind, _ := st.observe(t0.Add(5*time.Second), now); kind != ActivitySilence {
+		t.Errorf("expected silence, got %q", kind)
+	}
+	if kind, _ := st.observe(t0.Add(5*time.Second), now.Add(time.Second)); kind != "" {
+		t.Errorf("silence should fire once, got %q", kind)
+	}
+	// Output after 60s of silence: activity
+	later := t0.Add(65 * time.Second)
+	kind, gap := st.observe(later, later)
+	if kind != ActivityOutput || gap != 60*time.Second {
+		t.Errorf("expected activity after 60s, got %q after %v", kind, gap)
+	}
+}
+
+func TestParseWindowActivity(t *testing.T) {
+	got := parseWindowActivity("mt-a 100\nmt-a 250\nmt-b 7\nbad\n")
+	if !got["mt-a"].Equal(time.Unix(250, 0)) || !got["mt-b"].Equal(time.Unix(7, 0)) || len(got) != 2 {
+		t.Errorf("unexpected result %v", got)
+	}
+}
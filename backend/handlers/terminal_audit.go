@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"markdown-themes-backend/db"
+	"markdown-themes-backend/utils"
+)
+
+// --- Command audit log ---
+//
+// When enabled, commands run in app terminals are written to the
+// terminal_audit table. Shells with integration report each command's
+// text, start, end and exit code through OSC 133 (terminal_shell.go).
+// Other sessions fall back to the lines typed into them: input is followed
+// as a line editor would, and a line is recorded when Enter is pressed at
+// the shell prompt, i.e. while the shell itself owns the terminal. Nothing
+// is recorded while the terminal has echo turned off, as it does for
+// password prompts. Entries older than the retention period, or beyond the
+// entry limit, are pruned hourly.
+
+const (
+	// auditQueueSize bounds pending audit writes; more are dropped rather
+	// than holding up terminal output.
+	auditQueueSize = 256
+	// auditInputOverlap is how soon after a typed line the shell must
+	// report the same command for the typed entry to be replaced.
+	auditInputOverlap = 5 * time.Second
+	// maxAuditLine bounds a typed line.
+	maxAuditLine = 4096
+)
+
+// AuditSettings configures the command audit log.
+type AuditSettings struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays is how long entries are kept (0 to keep them forever)
+	RetentionDays int `json:"retentionDays"`
+	// MaxEntries caps the number of entries kept (0 for no cap)
+	MaxEntries int `json:"maxEntries"`
+}
+
+var defaultAuditSettings = AuditSettings{RetentionDays: 30, MaxEntries: 100000}
+
+func auditSettingsPath() string {
+	return filepath.Join(utils.DataDir(), "terminal-audit.json")
+}
+
+// LoadAuditSettings reads the audit settings (defaults if never saved)
+func LoadAuditSettings() (AuditSettings, error) {
+	data, err := os.ReadFile(auditSettingsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defaultAuditSettings, nil
+		}
+		return AuditSettings{}, err
+	}
+	settings := defaultAuditSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return AuditSettings{}, err
+	}
+	return settings, nil
+}
+
+// SaveAuditSettings writes the audit settings to disk
+func SaveAuditSettings(settings AuditSettings) error {
+	path := auditSettingsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	auditSettingsMu.Lock()
+	auditSettingsCache = &settings
+	auditSettingsMu.Unlock()
+	return nil
+}
+
+var (
+	auditSettingsCache *AuditSettings
+	auditSettingsMu    sync.Mutex
+)
+
+// currentAuditSettings returns the audit settings, read from disk once.
+func currentAuditSettings() AuditSettings {
+	auditSettingsMu.Lock()
+	defer auditSettingsMu.Unlock()
+	if auditSettingsCache == nil {
+		settings, err := LoadAuditSettings()
+		if err != nil {
+			log.Printf("[Terminal] Failed to load audit settings, audit log off: %v", err)
+			settings = defaultAuditSettings
+		}
+		auditSettingsCache = &settings
+	}
+	return *auditSettingsCache
+}
+
+// auditEvent is a pending audit write: a new entry, the end of a session's
+// running command, or a closed session to forget.
+type auditEvent struct {
+	terminalID string
+	entry      *db.AuditEntry
+	finishedAt int64
+	exitCode   *int
+	forget     bool
+}
+
+// auditLog records commands in the background, in order.
+type auditLog struct {
+	events chan auditEvent
+	// running maps a session to the entry of its running command, and
+	// typed to its last typed line (both owned by the run goroutine)
+	running map[string]int64
+	typed   map[string]db.AuditEntry
+	// lines holds each session's partly typed line
+	lines map[string]*inputLine
+	mu    sync.Mutex
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{
+		events:  make(chan auditEvent, auditQueueSize),
+		running: make(map[string]int64),
+		typed:   make(map[string]db.AuditEntry),
+		lines:   make(map[string]*inputLine),
+	}
+}
+
+// run writes audit events to the database. A shell that turns out to
+// have integration reports its first command after it was already taken
+// from the typed line; the typed entry gives way to the shell's.
+func (a *auditLog) run() {
+	for ev := range a.events {
+		switch {
+		case ev.forget:
+			delete(a.running, ev.terminalID)
+			delete(a.typed, ev.terminalID)
+		case ev.entry != nil:
+			if ev.entry.Source == db.AuditSourceShell {
+				typed, ok := a.typed[ev.terminalID]
+				if ok && typed.Command == ev.entry.Command && ev.entry.StartedAt-typed.StartedAt < auditInputOverlap.Milliseconds() {
+					if err := db.DeleteAuditEntry(typed.ID); err != nil {
+						log.Printf("[Terminal] Audit: %v", err)
+					}
+				}
+				delete(a.typed, ev.terminalID)
+			}
+			if err := db.InsertAuditEntry(ev.entry); err != nil {
+				log.Printf("[Terminal] Audit: %v", err)
+				continue
+			}
+			if ev.entry.Source == db.AuditSourceShell {
+				a.running[ev.terminalID] = ev.entry.ID
+			} else {
+				a.typed[ev.terminalID] = *ev.entry
+			}
+		default:
+			id, ok := a.running[ev.terminalID]
+			if !ok {
+				continue
+			}
+			delete(a.running, ev.terminalID)
+			if err := db.FinishAuditEntry(id, ev.finishedAt, ev.exitCode); err != nil {
+				log.Printf("[Terminal] Audit: %v", err)
+			}
+		}
+	}
+}
+
+// queue hands an event to the writer without blocking.
+func (a *auditLog) queue(ev auditEvent) {
+	select {
+	case a.events <- ev:
+	default:
+		log.Printf("[Terminal] Audit queue full, dropping entry for %s", ev.terminalID)
+	}
+}
+
+// auditEntry starts an entry with the session's profile.
+func (tm *TerminalManager) auditEntry(terminalID, source, command, cwd string, startedAt time.Time) *db.AuditEntry {
+	entry := &db.AuditEntry{
+		TerminalID: terminalID,
+		Command:    command,
+		Cwd:        cwd,
+		Source:     source,
+		StartedAt:  startedAt.UnixMilli(),
+	}
+	tm.mu.RLock()
+	if session, ok := tm.sessions[terminalID]; ok {
+		entry.ProfileID = session.ProfileID
+		entry.ProfileName = session.ProfileName
+	}
+	tm.mu.RUnlock()
+	return entry
+}
+
+// auditCommandStarted records a command reported by shell integration.
+func (tm *TerminalManager) auditCommandStarted(terminalID string, rec *CommandRecord) {
+	if !currentAuditSettings().Enabled || rec.Command == "" {
+		return
+	}
+	tm.audit.queue(auditEvent{
+		terminalID: terminalID,
+		entry:      tm.auditEntry(terminalID, db.AuditSourceShell, rec.Command, rec.Cwd, rec.StartedAt),
+	})
+}
+
+// auditCommandFinished records the end of a shell integration command.
+func (tm *TerminalManager) auditCommandFinished(terminalID string, rec *CommandRecord) {
+	if !currentAuditSettings().Enabled || rec.FinishedAt == nil {
+		return
+	}
+	tm.audit.queue(auditEvent{terminalID: terminalID, finishedAt: rec.FinishedAt.UnixMilli(), exitCode: rec.ExitCode})
+}
+
+// auditInput follows input written to a session and records the lines
+// entered at its shell prompt. Sessions whose shell reports commands
+// itself, or that run a command rather than a shell, are left alone.
+func (tm *TerminalManager) auditInput(session *TerminalSession, data []byte) {
+	if !currentAuditSettings().Enabled || session.Command != "" {
+		return
+	}
+	if _, _, _, integrated := tm.CommandHistory(session.ID); integrated {
+		return
+	}
+
+	tm.audit.mu.Lock()
+	line, ok := tm.audit.lines[session.ID]
+	if !ok {
+		line = &inputLine{}
+		tm.audit.lines[session.ID] = line
+	}
+	entered := line.Feed(data)
+	tm.audit.mu.Unlock()
+	if len(entered) == 0 {
+		return
+	}
+
+	// Checked before the input reaches the shell, while the prompt (or
+	// whatever else is reading) still owns the terminal
+	cwd, atPrompt, err := shellPromptState(session)
+	if err != nil {
+		log.Printf("[Terminal] Audit: not recording input to %s: %v", session.ID, err)
+	}
+	if !atPrompt {
+		return
+	}
+	now := time.Now()
+	for _, command := range entered {
+		tm.audit.queue(auditEvent{
+			terminalID: session.ID,
+			entry:      tm.auditEntry(session.ID, db.AuditSourceInput, command, cwd, now),
+		})
+	}
+}
+
+// auditKeys follows tmux key names sent to a session (Enter, C-u, ...).
+func (tm *TerminalManager) auditKeys(session *TerminalSession, keys []string) {
+	var input []byte
+	for _, key := range keys {
+		input = append(input, ptyKeyBytes(key)...)
+	}
+	tm.auditInput(session, input)
+}
+
+// forgetAudit drops the audit state of a closed session.
+func (tm *TerminalManager) forgetAudit(terminalID string) {
+	tm.audit.mu.Lock()
+	delete(tm.audit.lines, terminalID)
+	tm.audit.mu.Unlock()
+	tm.audit.queue(auditEvent{terminalID: terminalID, forget: true})
+}
+
+// pruneAuditLog applies the retention settings every hour.
+func (tm *TerminalManager) pruneAuditLog() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		pruneAuditEntries(currentAuditSettings())
+	}
+}
+
+// pruneAuditEntries deletes the entries the settings don't keep.
+func pruneAuditEntries(settings AuditSettings) {
+	var olderThan int64
+	if settings.RetentionDays > 0 {
+		olderThan = time.Now().AddDate(0, 0, -settings.RetentionDays).UnixMilli()
+	}
+	n, err := db.PruneAuditEntries(olderThan, settings.MaxEntries)
+	if err != nil {
+		log.Printf("[Terminal] Audit: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[Terminal] Audit: pruned %d entries", n)
+	}
+}
+
+// --- Typed lines ---
+
+const (
+	lineGround = iota
+	lineEscape
+	lineCSI
+	lineSS3
+)
+
+// inputLine rebuilds the line being typed from terminal input, handling
+// the editing keys a shell prompt understands. Cursor movement and other
+// escape sequences are ignored, so a line edited in the middle or recalled
+// from history comes out approximate.
+type inputLine struct {
+	buf   []byte
+	state int
+}
+
+// Feed processes input and returns the non-empty lines it completed.
+func (l *inputLine) Feed(data []byte) []string {
+	var lines []string
+	for _, c := range data {
+		switch l.state {
+		case lineEscape:
+			switch c {
+			case '[':
+				l.state = lineCSI
+			case 'O':
+				l.state = lineSS3
+			default:
+				l.state = lineGround // Alt-key: dropped
+			}
+			continue
+		case lineCSI:
+			if c >= 0x40 && c <= 0x7e {
+				l.state = lineGround
+			}
+			continue
+		case lineSS3:
+			l.state = lineGround
+			continue
+		}
+
+		switch {
+		case c == 0x1b:
+			l.state = lineEscape
+		case c == '\r' || c == '\n':
+			if line := strings.TrimSpace(string(l.buf)); line != "" {
+				lines = append(lines, line)
+			}
+			l.buf = l.buf[:0]
+		case c == 0x7f || c == '\b':
+			if _, size := utf8.DecodeLastRune(l.buf); size > 0 {
+				l.buf = l.buf[:len(l.buf)-size]
+			}
+		case c == 0x03 || c == 0x15: // C-c, C-u
+			l.buf = l.buf[:0]
+		case c == 0x17: // C-w
+			end := len(l.buf)
+			for end > 0 && l.buf[end-1] == ' ' {
+				end--
+			}
+			for end > 0 && l.buf[end-1] != ' ' {
+				end--
+			}
+			l.buf = l.buf[:end]
+		case c == '\t' || c >= 0x20:
+			if len(l.buf) < maxAuditLine {
+				l.buf = append(l.buf, c)
+			}
+		}
+	}
+	return lines
+}
+
+// --- Prompt detection ---
+
+// shellPromptState reports whether typed input is going to the session's
+// shell prompt, and the shell's directory. It isn't while a program other
+// than the shell owns the terminal, or while echo is off with line editing
+// left to the terminal, which is how password prompts (read -s, getpass)
+// read input; readline turns echo off too, but also canonical mode.
+func shellPromptState(session *TerminalSession) (cwd string, atPrompt bool, err error) {
+	var tty *os.File
+	var shellPID int
+	if session.Backend == BackendPTY {
+		if session.cmd == nil || session.cmd.Process == nil {
+			return "", false, fmt.Errorf("no shell process")
+		}
+		tty = session.ptmx
+		shellPID = session.cmd.Process.Pid
+		cwd, _ = os.Readlink(filepath.Join("/proc", strconv.Itoa(shellPID), "cwd"))
+	} else {
+		out, err := runTmux("display-message", "-p", "-t", session.TmuxSession, "#{pane_tty} #{pane_pid} #{pane_current_path}")
+		if err != nil {
+			return "", false, err
+		}
+		fields := strings.SplitN(out, " ", 3)
+		if len(fields) < 2 {
+			return "", false, fmt.Errorf("unexpected pane info %q", out)
+		}
+		shellPID, _ = strconv.Atoi(fields[1])
+		if len(fields) == 3 {
+			cwd = fields[2]
+		}
+		if tty, err = os.OpenFile(fields[0], os.O_RDONLY|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0); err != nil {
+			return "", false, err
+		}
+		defer tty.Close()
+	}
+
+	termios, err := ttyMode(tty)
+	if err != nil {
+		return "", false, err
+	}
+	if termios.Lflag&syscall.ECHO == 0 && termios.Lflag&syscall.ICANON != 0 {
+		return "", false, nil
+	}
+	// The pane's tty isn't ours, so its foreground process group comes
+	// from the shell's stat rather than TIOCGPGRP
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(shellPID), "stat"))
+	if err != nil {
+		return "", false, err
+	}
+	stat, ok := parseProcStat(string(data))
+	if !ok {
+		return "", false, fmt.Errorf("unexpected stat for process %d", shellPID)
+	}
+	if stat.tpgid != shellPID {
+		return "", false, nil
+	}
+	return cwd, true, nil
+}
+
+// ttyMode reads a terminal's termios. (Fd would switch the file to
+// blocking mode, and the PTY is being read concurrently.)
+func ttyMode(f *os.File) (syscall.Termios, error) {
+	var termios syscall.Termios
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return termios, err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	})
+	if err == nil && errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		return termios, fmt.Errorf("reading terminal mode: %w", err)
+	}
+	return termios, nil
+}
+
+// --- HTTP Handlers ---
+
+// TerminalAudit handles GET /api/terminal/audit - search the command audit
+// log. Filters: q (command or cwd text), terminalId, profile, since and
+// until (ms), failed=true, and before (an entry ID, for paging); limit
+// defaults to 100.
+func TerminalAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := db.AuditQuery{
+		Text:       query.Get("q"),
+		TerminalID: query.Get("terminalId"),
+		Profile:    query.Get("profile"),
+		Failed:     query.Get("failed") == "true",
+	}
+	q.Since, _ = strconv.ParseInt(query.Get("since"), 10, 64)
+	q.Until, _ = strconv.ParseInt(query.Get("until"), 10, 64)
+	q.Before, _ = strconv.ParseInt(query.Get("before"), 10, 64)
+	q.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+
+	entries, err := db.SearchAuditEntries(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": currentAuditSettings().Enabled,
+		"entries": entries,
+	})
+}
+
+// TerminalAuditSettings handles GET /api/terminal/audit/settings
+func TerminalAuditSettings(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(currentAuditSettings())
+}
+
+// SaveTerminalAuditSettings handles POST /api/terminal/audit/settings -
+// turn the audit log on or off and set its retention. Entries past the new
+// retention are pruned right away.
+func SaveTerminalAuditSettings(w http.ResponseWriter, r *http.Request) {
+	settings := currentAuditSettings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if settings.RetentionDays < 0 || settings.MaxEntries < 0 {
+		http.Error(w, `{"error": "retentionDays and maxEntries must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+	if err := SaveAuditSettings(settings); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Terminal] Audit log enabled=%v, retention %d days, max %d entries", settings.Enabled, settings.RetentionDays, settings.MaxEntries)
+	pruneAuditEntries(settings)
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---- Audit log tests ----
+
+func TestInputLine_EditingKeys(t *testing.T) {
+	var l inputLine
+	// Typed in pieces, with a typo fixed by backspace and an arrow key
+	if got := l.Feed([]byte("git statsu")); got != nil {
+		t.Fatalf("no line before Enter, got %q", got)
+	}
+	got := l.Feed([]byte("\x7f\x7fus\x1b[D\r"))
+	if len(got) != 1 || got[0] != "git status" {
+		t.Errorf("lines = %q", got)
+	}
+
+	// C-c and C-u discard, C-w deletes a word, blank lines are skipped,
+	// and a pasted block yields one command per line
+	got = l.Feed([]byte("rm -rf /\x03\r\nls -la \x17-l\roops\x15\r  \recho a\necho b\n"))
+	want := []string{"ls -l", "echo a", "echo b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+
+	// An escape sequence split across writes is still skipped
+	l.Feed([]byte("make\x1b"))
+	if got := l.Feed([]byte("OA test\r")); len(got) != 1 || got[0] != "make test" {
+		t.Errorf("lines = %q", got)
+	}
+}
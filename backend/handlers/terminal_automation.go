@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Automation API ---
+//
+// REST endpoints for scripts and integration tests that drive terminals
+// without a browser: spawn from a profile, type text or tmux key names,
+// wait for the screen to match a pattern, and read the screen. Routes are
+// registered behind auth.RequireToken.
+
+const (
+	// defaultWaitTimeout applies when a wait request has no timeout.
+	defaultWaitTimeout = 10 * time.Second
+	// maxWaitTimeout caps how long one request can block.
+	maxWaitTimeout = 5 * time.Minute
+	// waitPollInterval is how often the screen is captured while waiting.
+	waitPollInterval = 100 * time.Millisecond
+)
+
+// Screen is the captured contents of a terminal's pane.
+type Screen struct {
+	TerminalID string   `json:"terminalId"`
+	Lines      []string `json:"lines"`
+	Cols       int      `json:"cols"`
+	Rows       int      `json:"rows"`
+	CursorX    int      `json:"cursorX"`
+	CursorY    int      `json:"cursorY"`
+}
+
+// CaptureScreen returns the visible screen of a tmux session, preceded by
+// up to history lines of scrollback. With ansi, SGR sequences are kept.
+func CaptureScreen(tmuxSession string, history int, ansi bool) (*Screen, error) {
+	args := []string{"capture-pane", "-p", "-t", tmuxSession}
+	if ansi {
+		args = append(args, "-e")
+	}
+	if history > 0 {
+		args = append(args, "-S", strconv.Itoa(-history))
+	}
+	out, err := tmuxCmd(args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screen of %s: %w", tmuxSession, err)
+	}
+
+	screen := &Screen{
+		TerminalID: tmuxSession,
+		Lines:      strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"),
+	}
+	info, err := tmuxCmd("display-message", "-p", "-t", tmuxSession, "#{pane_width} #{pane_height} #{cursor_x} #{cursor_y}").Output()
+	if err == nil {
+		fmt.Sscanf(string(info), "%d %d %d %d", &screen.Cols, &screen.Rows, &screen.CursorX, &screen.CursorY)
+	}
+	return screen, nil
+}
+
+// SendKeys types text into a session through its PTY, then sends tmux key
+// names (Enter, C-c, Up, F5, ...) through its backend.
+func (tm *TerminalManager) SendKeys(session *TerminalSession, text string, keys []string) error {
+	if text != "" {
+		if err := tm.WriteToSession(session.ID, nil, []byte(text)); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		tm.auditKeys(session, keys)
+		return session.backend().SendKeys(session, keys)
+	}
+	return nil
+}
+
+// WaitForScreen captures the screen (plus history lines of scrollback)
+// until pattern matches or ctx is done. It returns the submatches and the
+// last screen captured.
+func WaitForScreen(ctx context.Context, session *TerminalSession, pattern *regexp.Regexp, history int) ([]string, *Screen, error) {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		screen, err := session.backend().Screen(session, history, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if match := pattern.FindStringSubmatch(strings.Join(screen.Lines, "\n")); match != nil {
+			return match, screen, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, screen, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// newAutomationID returns a terminal ID for sessions spawned by the API.
+func newAutomationID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "mt-api-" + hex.EncodeToString(b)
+}
+
+// automationTarget returns the session a request names if it's a live
+// mt-* terminal, writing a 404 otherwise.
+func automationTarget(w http.ResponseWriter, r *http.Request) (*TerminalSession, bool) {
+	id := chi.URLParam(r, "id")
+	session, ok := GetTerminalManager().findSession(id)
+	if !strings.HasPrefix(id, "mt-") || !ok {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return session, true
+}
+
+// --- HTTP Handlers ---
+
+// TerminalAPISpawn handles POST /api/terminal/sessions - spawn a terminal,
+// optionally from a profile and on a chosen backend ("tmux" or "pty"). The
+// ID is generated unless given.
+func TerminalAPISpawn(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID        string `json:"id"`
+		ProfileID string `json:"profileId"`
+		Cwd       string `json:"cwd"`
+		Command   string `json:"command"`
+		Workspace string `json:"workspace"`
+		File      string `json:"file"`
+		Title     string `json:"title"`
+		Backend   string `json:"backend"`
+		Cols      uint16 `json:"cols"`
+		Rows      uint16 `json:"rows"`
+
+		ShellIntegration *bool `json:"shellIntegration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		req.ID = newAutomationID()
+	} else if !strings.HasPrefix(req.ID, "mt-") {
+		http.Error(w, `{"error": "id must start with mt-"}`, http.StatusBadRequest)
+		return
+	}
+
+	tm := GetTerminalManager()
+	opts, err := spawnRequest{
+		ID:        req.ID,
+		ProfileID: req.ProfileID,
+		Cwd:       req.Cwd,
+		Command:   req.Command,
+		Workspace: req.Workspace,
+		File:      req.File,
+		Title:     req.Title,
+		Backend:   req.Backend,
+		Cols:      req.Cols,
+		Rows:      req.Rows,
+		TabOrder:  len(tm.ListSessions()),
+
+		ShellIntegration: req.ShellIntegration,
+	}.spawnOptions()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	session, err := tm.Spawn(opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	tagProfile(session.TmuxSession, opts.ProfileName)
+	log.Printf("[Terminal] Session %s spawned via automation API", session.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session.snapshot())
+}
+
+// TerminalAPISend handles POST /api/terminal/{id}/send - type text and/or
+// send tmux key names: {"text": "ls", "keys": ["Enter"]}.
+func TerminalAPISend(w http.ResponseWriter, r *http.Request) {
+	session, ok := automationTarget(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Text string   `json:"text"`
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Text == "" && len(req.Keys) == 0 {
+		http.Error(w, `{"error": "text or keys is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := GetTerminalManager().SendKeys(session, req.Text, req.Keys); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// TerminalAPIWait handles POST /api/terminal/{id}/wait - block until the
+// screen matches a regular expression:
+// {"pattern": "\\$ $", "timeout": 5000, "history": 0}. Timeout is in
+// milliseconds; history includes that many lines of scrollback. Responds
+// 408 with the last screen if the timeout passes first.
+func TerminalAPIWait(w http.ResponseWriter, r *http.Request) {
+	session, ok := automationTarget(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Pattern string `json:"pattern"`
+		Timeout int    `json:"timeout"`
+		History int    `json:"history"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	pattern, err := regexp.Compile(req.Pattern)
+	if err != nil || req.Pattern == "" {
+		http.Error(w, `{"error": "pattern must be a valid regular expression"}`, http.StatusBadRequest)
+		return
+	}
+	timeout := defaultWaitTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Millisecond
+	}
+	if timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	match, screen, err := WaitForScreen(ctx, session, pattern, req.History)
+	elapsed := time.Since(start).Milliseconds()
+	if err != nil && screen == nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusRequestTimeout)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"matched":   false,
+			"error":     fmt.Sprintf("no match for %q after %v", req.Pattern, timeout),
+			"elapsedMs": elapsed,
+			"screen":    screen,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matched":   true,
+		"match":     match[0],
+		"groups":    match[1:],
+		"elapsedMs": elapsed,
+		"screen":    screen,
+	})
+}
+
+// TerminalAPIScreen handles GET /api/terminal/{id}/screen - the visible
+// screen and cursor. ?history=N prepends scrollback; ?ansi=true keeps
+// colors.
+func TerminalAPIScreen(w http.ResponseWriter, r *http.Request) {
+	session, ok := automationTarget(w, r)
+	if !ok {
+		return
+	}
+	history, _ := strconv.Atoi(r.URL.Query().Get("history"))
+	screen, err := session.backend().Screen(session, history, r.URL.Query().Get("ansi") == "true")
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(screen)
+}
+
+// TerminalAPIClose handles DELETE /api/terminal/{id} - kill the terminal
+// and its shell.
+func TerminalAPIClose(w http.ResponseWriter, r *http.Request) {
+	session, ok := automationTarget(w, r)
+	if !ok {
+		return
+	}
+	tm := GetTerminalManager()
+	// Tell attached windows first; the subscribers go with the session
+	if tm.closedFunc != nil {
+		tm.closedFunc(session.ID)
+	}
+	if err := tm.CloseSession(session.ID); err != nil {
+		// A tmux session nobody is attached to: just end it
+		session.backend().Kill(session)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
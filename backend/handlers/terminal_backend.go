@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Session backends ---
+//
+// A session's shell runs either inside tmux, which keeps it alive across
+// PTY detaches and backend restarts, or directly on a PTY (terminal_pty.go)
+// for machines without tmux. Sessions record their backend by name; the
+// WebSocket message contract is the same for both.
+
+// Terminal backends
+const (
+	BackendTmux = "tmux"
+	BackendPTY  = "pty"
+)
+
+// terminalBackend runs the shells behind terminal sessions.
+type terminalBackend interface {
+	// Spawn starts a session's shell (or command) with a PTY attached and
+	// registers it in tm.sessions. Caller holds tm.mu.
+	Spawn(tm *TerminalManager, opts SpawnOptions, cwd string, cols, rows uint16) (*TerminalSession, error)
+	// Persistent reports whether shells outlive their PTY and this
+	// process, so sessions can be detached, reattached and recovered.
+	Persistent() bool
+	// GracePeriod is how long a session with no subscribers keeps its PTY.
+	GracePeriod() time.Duration
+	// Kill ends the session's shell and what it started.
+	Kill(session *TerminalSession)
+	// Replay returns up to lines of history to write to a reconnecting
+	// client's terminal, and how many lines that is.
+	Replay(session *TerminalSession, lines int) ([]byte, int, error)
+	// Scrollback returns up to lines of history as text (all if lines <=
+	// 0), keeping SGR colors with ansi.
+	Scrollback(session *TerminalSession, lines int, ansi bool) (string, error)
+	// Screen returns the visible screen, preceded by history lines.
+	Screen(session *TerminalSession, history int, ansi bool) (*Screen, error)
+	// SendKeys sends tmux key names (Enter, C-c, Up, ...).
+	SendKeys(session *TerminalSession, keys []string) error
+}
+
+var (
+	tmuxOnce  sync.Once
+	tmuxFound bool
+)
+
+// tmuxAvailable reports whether tmux is installed.
+func tmuxAvailable() bool {
+	tmuxOnce.Do(func() {
+		_, err := exec.LookPath("tmux")
+		tmuxFound = err == nil
+		if !tmuxFound {
+			log.Printf("[Terminal] tmux not found, terminals will use plain PTYs")
+		}
+	})
+	return tmuxFound
+}
+
+// selectBackend returns the named backend; "" picks tmux when it's
+// installed and plain PTYs otherwise.
+func selectBackend(name string) (terminalBackend, error) {
+	switch name {
+	case "":
+		if tmuxAvailable() {
+			return tmuxBackend{}, nil
+		}
+		return ptyBackend{}, nil
+	case BackendTmux:
+		if !tmuxAvailable() {
+			return nil, fmt.Errorf("tmux is not installed")
+		}
+		return tmuxBackend{}, nil
+	case BackendPTY:
+		return ptyBackend{}, nil
+	}
+	return nil, fmt.Errorf("unknown terminal backend %q (use tmux or pty)", name)
+}
+
+// backend returns the session's backend.
+func (s *TerminalSession) backend() terminalBackend {
+	if s.Backend == BackendPTY {
+		return ptyBackend{}
+	}
+	return tmuxBackend{}
+}
+
+// sessionAlive reports whether a terminal can be reconnected to: a running
+// plain PTY session or an existing tmux session.
+func (tm *TerminalManager) sessionAlive(id string) bool {
+	tm.mu.RLock()
+	session, ok := tm.sessions[id]
+	tm.mu.RUnlock()
+	if ok && !session.backend().Persistent() {
+		return true
+	}
+	return tmuxHasSession(id)
+}
+
+// persistent reports whether a session outlives its PTY. Unknown sessions
+// can only be tmux ones.
+func (tm *TerminalManager) persistent(id string) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if session, ok := tm.sessions[id]; ok {
+		return session.backend().Persistent()
+	}
+	return true
+}
+
+// findSession returns a registered session or, for an mt-* tmux session
+// this process isn't attached to, a stand-in good for reading its screen
+// and history and sending it keys.
+func (tm *TerminalManager) findSession(id string) (*TerminalSession, bool) {
+	tm.mu.RLock()
+	session, ok := tm.sessions[id]
+	tm.mu.RUnlock()
+	if ok {
+		return session, true
+	}
+	if strings.HasPrefix(id, "mt-") && tmuxHasSession(id) {
+		return &TerminalSession{ID: id, TmuxSession: id, Backend: BackendTmux}, true
+	}
+	return nil, false
+}
+
+// --- tmux backend ---
+
+// tmuxBackend runs shells in mt-* tmux sessions. Spawn is in terminal.go.
+type tmuxBackend struct{}
+
+func (tmuxBackend) Persistent() bool { return true }
+
+func (tmuxBackend) GracePeriod() time.Duration { return gracePeriod }
+
+func (tmuxBackend) Kill(session *TerminalSession) {
+	if session.TmuxSession != "" {
+		tmuxKillSession(session.TmuxSession)
+	}
+}
+
+// Replay leaves out the visible screen, which tmux redraws on attach.
+func (tmuxBackend) Replay(session *TerminalSession, lines int) ([]byte, int, error) {
+	history, err := CaptureScrollback(session.TmuxSession, lines, true, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return scrollbackForTerminal(history), strings.Count(history, "\n") + 1, nil
+}
+
+func (tmuxBackend) Scrollback(session *TerminalSession, lines int, ansi bool) (string, error) {
+	return CaptureScrollback(session.TmuxSession, lines, ansi, false)
+}
+
+func (tmuxBackend) Screen(session *TerminalSession, history int, ansi bool) (*Screen, error) {
+	return CaptureScreen(session.TmuxSession, history, ansi)
+}
+
+func (tmuxBackend) SendKeys(session *TerminalSession, keys []string) error {
+	args := append([]string{"send-keys", "-t", session.TmuxSession}, keys...)
+	if out, err := tmuxCmd(args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("tmux send-keys failed: %w (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
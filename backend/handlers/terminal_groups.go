@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// --- Input groups ---
+//
+// An input group is a named set of sessions that receive the same input:
+// terminal-input sent with a group instead of a terminalId fans out to
+// every enabled member through WriteToSession, so each member still
+// enforces the sender's role. Members can be disabled without leaving the
+// group. Whenever a group changes, each affected session's subscribers get
+// a terminal-group-indicator listing the groups it is in, so a terminal
+// that is being typed into from elsewhere is always marked as such. Groups
+// live in memory; closed sessions leave their groups.
+
+// GroupMember is a session in an input group.
+type GroupMember struct {
+	TerminalID string `json:"terminalId"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// InputGroup is a named set of sessions that receive the same input.
+type InputGroup struct {
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+// GroupMembership is a group a session belongs to, as shown on its
+// indicator.
+type GroupMembership struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Members int    `json:"members"` // enabled members, this one included
+}
+
+// GroupWriteResult is the outcome of group input for one member.
+type GroupWriteResult struct {
+	TerminalID string `json:"terminalId"`
+	Error      string `json:"error,omitempty"`
+}
+
+// enabledCount returns how many members receive the group's input.
+func (g *InputGroup) enabledCount() int {
+	n := 0
+	for _, m := range g.Members {
+		if m.Enabled {
+			n++
+		}
+	}
+	return n
+}
+
+// copyGroup returns a copy of a group safe to hand out.
+func copyGroup(g *InputGroup) InputGroup {
+	return InputGroup{Name: g.Name, Members: append([]GroupMember(nil), g.Members...)}
+}
+
+// SetGroup creates or replaces a group with the given sessions, all
+// enabled. Unknown sessions are rejected.
+func (tm *TerminalManager) SetGroup(name string, terminalIDs []string) (InputGroup, error) {
+	if name == "" {
+		return InputGroup{}, fmt.Errorf("group name is required")
+	}
+	group := &InputGroup{Name: name, Members: []GroupMember{}}
+	seen := make(map[string]bool)
+	tm.mu.RLock()
+	for _, id := range terminalIDs {
+		if seen[id] {
+			continue
+		}
+		if _, ok := tm.sessions[id]; !ok {
+			tm.mu.RUnlock()
+			return InputGroup{}, fmt.Errorf("session %s not found", id)
+		}
+		seen[id] = true
+		group.Members = append(group.Members, GroupMember{TerminalID: id, Enabled: true})
+	}
+	tm.mu.RUnlock()
+
+	tm.groupsMu.Lock()
+	affected := seen
+	if old, ok := tm.groups[name]; ok {
+		for _, m := range old.Members {
+			affected[m.TerminalID] = true
+		}
+	}
+	tm.groups[name] = group
+	result := copyGroup(group)
+	tm.groupsMu.Unlock()
+
+	log.Printf("[Terminal] Input group %s: %d sessions", name, len(result.Members))
+	tm.groupsChanged(affected)
+	return result, nil
+}
+
+// SetGroupMember enables or disables a member of a group.
+func (tm *TerminalManager) SetGroupMember(name, terminalID string, enabled bool) error {
+	tm.groupsMu.Lock()
+	group, ok := tm.groups[name]
+	if !ok {
+		tm.groupsMu.Unlock()
+		return fmt.Errorf("group %s not found", name)
+	}
+	found := false
+	affected := make(map[string]bool)
+	for i := range group.Members {
+		if group.Members[i].TerminalID == terminalID {
+			group.Members[i].Enabled = enabled
+			found = true
+		}
+		affected[group.Members[i].TerminalID] = true
+	}
+	tm.groupsMu.Unlock()
+	if !found {
+		return fmt.Errorf("session %s is not in group %s", terminalID, name)
+	}
+	tm.groupsChanged(affected)
+	return nil
+}
+
+// DeleteGroup removes a group.
+func (tm *TerminalManager) DeleteGroup(name string) error {
+	tm.groupsMu.Lock()
+	group, ok := tm.groups[name]
+	delete(tm.groups, name)
+	tm.groupsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("group %s not found", name)
+	}
+
+	affected := make(map[string]bool)
+	for _, m := range group.Members {
+		affected[m.TerminalID] = true
+	}
+	tm.groupsChanged(affected)
+	return nil
+}
+
+// Groups returns every group, by name.
+func (tm *TerminalManager) Groups() []InputGroup {
+	tm.groupsMu.Lock()
+	defer tm.groupsMu.Unlock()
+	groups := make([]InputGroup, 0, len(tm.groups))
+	for _, g := range tm.groups {
+		groups = append(groups, copyGroup(g))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// sessionGroups returns the groups a session belongs to.
+func (tm *TerminalManager) sessionGroups(terminalID string) []GroupMembership {
+	tm.groupsMu.Lock()
+	defer tm.groupsMu.Unlock()
+	memberships := []GroupMembership{}
+	for _, g := range tm.groups {
+		for _, m := range g.Members {
+			if m.TerminalID == terminalID {
+				memberships = append(memberships, GroupMembership{Name: g.Name, Enabled: m.Enabled, Members: g.enabledCount()})
+			}
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].Name < memberships[j].Name })
+	return memberships
+}
+
+// sendGroupIndicator tells a client attaching to a session which input
+// groups the session is in, if any.
+func (tm *TerminalManager) sendGroupIndicator(clientSend func(interface{}), terminalID string) {
+	if groups := tm.sessionGroups(terminalID); len(groups) > 0 {
+		clientSend(map[string]interface{}{
+			"type":       "terminal-group-indicator",
+			"terminalId": terminalID,
+			"groups":     groups,
+		})
+	}
+}
+
+// WriteToGroup sends data to every enabled member of a group on behalf of
+// client, returning what happened for each member.
+func (tm *TerminalManager) WriteToGroup(name string, client interface{}, data []byte) ([]GroupWriteResult, error) {
+	tm.groupsMu.Lock()
+	group, ok := tm.groups[name]
+	var members []GroupMember
+	if ok {
+		members = append(members, group.Members...)
+	}
+	tm.groupsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("group %s not found", name)
+	}
+
+	var results []GroupWriteResult
+	for _, m := range members {
+		if !m.Enabled {
+			continue
+		}
+		result := GroupWriteResult{TerminalID: m.TerminalID}
+		if err := tm.WriteToSession(m.TerminalID, client, data); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// forgetGroupMember removes a closed session from its groups, dropping
+// groups left empty.
+func (tm *TerminalManager) forgetGroupMember(terminalID string) {
+	affected := make(map[string]bool)
+	changed := false
+	tm.groupsMu.Lock()
+	for name, g := range tm.groups {
+		kept := g.Members[:0]
+		for _, m := range g.Members {
+			if m.TerminalID != terminalID {
+				kept = append(kept, m)
+			}
+		}
+		if len(kept) == len(g.Members) {
+			continue
+		}
+		g.Members = kept
+		changed = true
+		for _, m := range kept {
+			affected[m.TerminalID] = true
+		}
+		if len(kept) == 0 {
+			delete(tm.groups, name)
+		}
+	}
+	tm.groupsMu.Unlock()
+	if changed {
+		tm.groupsChanged(affected)
+	}
+}
+
+// groupsChanged sends the affected sessions' subscribers their indicators
+// and all clients the group list.
+func (tm *TerminalManager) groupsChanged(affected map[string]bool) {
+	for id := range affected {
+		tm.sendSessionEvent(id, map[string]interface{}{
+			"type":       "terminal-group-indicator",
+			"terminalId": id,
+			"groups":     tm.sessionGroups(id),
+		})
+	}
+	if tm.broadcastAllFunc != nil {
+		tm.broadcastAllFunc(map[string]interface{}{
+			"type":   "terminal-groups",
+			"groups": tm.Groups(),
+		})
+	}
+}
+
+// handleTerminalGroupMessage handles the input group messages:
+// terminal-group-set ({group, terminalIds}), terminal-group-member
+// ({group, terminalId, enabled}), terminal-group-delete ({group}) and
+// terminal-group-list. Group input itself is terminal-input with a group.
+func handleTerminalGroupMessage(msgType string, raw json.RawMessage, clientSend func(interface{})) {
+	tm := GetTerminalManager()
+	var msg struct {
+		Group       string   `json:"group"`
+		TerminalID  string   `json:"terminalId"`
+		TerminalIDs []string `json:"terminalIds"`
+		Enabled     bool     `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Terminal] Failed to parse message: %v", err)
+		return
+	}
+
+	var err error
+	switch msgType {
+	case "terminal-group-set":
+		_, err = tm.SetGroup(msg.Group, msg.TerminalIDs)
+	case "terminal-group-member":
+		err = tm.SetGroupMember(msg.Group, msg.TerminalID, msg.Enabled)
+	case "terminal-group-delete":
+		err = tm.DeleteGroup(msg.Group)
+	case "terminal-group-list":
+		clientSend(map[string]interface{}{
+			"type":   "terminal-groups",
+			"groups": tm.Groups(),
+		})
+	}
+	if err != nil {
+		clientSend(map[string]interface{}{
+			"type":  "terminal-group-error",
+			"group": msg.Group,
+			"error": err.Error(),
+		})
+	}
+}
+
+// --- HTTP Handlers ---
+
+// TerminalGroups handles GET /api/terminal/groups - the input groups
+func TerminalGroups(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups": GetTerminalManager().Groups(),
+	})
+}
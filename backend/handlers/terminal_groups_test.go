@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+)
+
+// ---- Input group tests ----
+
+func TestWriteToGroup_FansOutToEnabledWriters(t *testing.T) {
+	tm := newTestManager()
+	tm.groups = make(map[string]*InputGroup)
+	client := &fakeTerminalClient{"me"}
+	outputs := make(map[string]*os.File)
+	for _, id := range []string{"mt-a", "mt-b", "mt-c"} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		defer w.Close()
+		s := &TerminalSession{ID: id, ptmx: w, clients: make(map[interface{}]*terminalSubscriber)}
+		if id == "mt-c" {
+			s.addSubscriber(&fakeTerminalClient{"owner"}, "")
+		}
+		s.addSubscriber(client, "") // owner of a and b, viewer of c
+		tm.sessions[id] = s
+		outputs[id] = r
+	}
+
+	if _, err := tm.SetGroup("services", []string{"mt-a", "mt-b", "mt-c"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tm.SetGroup("bad", []string{"mt-missing"}); err == nil {
+		t.Error("expected unknown sessions to be rejected")
+	}
+	if err := tm.SetGroupMember("services", "mt-b", false); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := tm.WriteToGroup("services", client, []byte("git pull\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].TerminalID != "mt-a" || results[0].Error != "" ||
+		results[1].TerminalID != "mt-c" || results[1].Error != ErrReadOnly.Error() {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	buf := make([]byte, 16)
+	if n, _ := outputs["mt-a"].Read(buf); string(buf[:n]) != "git pull\r" {
+		t.Errorf("mt-a got %q", buf[:n])
+	}
+
+	if groups := tm.sessionGroups("mt-b"); len(groups) != 1 || groups[0].Enabled || groups[0].Members != 2 {
+		t.Errorf("unexpected indicator for mt-b: %+v", groups)
+	}
+	tm.forgetGroupMember("mt-a")
+	tm.forgetGroupMember("mt-b")
+	tm.forgetGroupMember("mt-c")
+	if len(tm.Groups()) != 0 {
+		t.Errorf("expected the emptied group to be dropped, got %+v", tm.Groups())
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Link resolution ---
+//
+// Paths in terminal output (compiler errors, git status, stack traces) are
+// usually relative to wherever the shell was when the command ran, which
+// only the backend knows. The client sends a candidate link it detected
+// with the terminal (and pane) it came from; the path is resolved against
+// the pane's live working directory and checked to exist, and the client
+// gets an absolute path and line to open in the viewer. Web URLs are
+// passed back as they are.
+
+// Link kinds
+const (
+	LinkFile = "file"
+	LinkURL  = "url"
+)
+
+// ResolvedLink is a link from terminal output, ready to open.
+type ResolvedLink struct {
+	Kind   string `json:"kind"`
+	URL    string `json:"url,omitempty"`
+	Path   string `json:"path,omitempty"` // absolute
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	IsDir  bool   `json:"isDir,omitempty"`
+	Cwd    string `json:"cwd,omitempty"` // directory relative paths were resolved against
+}
+
+var (
+	// src/foo.ts:42:7, src/foo.ts:42
+	linkColonPattern = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:?$`)
+	// src/foo.ts(42,7) as printed by tsc and MSBuild
+	linkParenPattern = regexp.MustCompile(`^(.+?)\((\d+)(?:,\s*(\d+))?\):?$`)
+	// File "app.py", line 42 in Python tracebacks
+	linkPythonPattern = regexp.MustCompile(`^(?:File\s+)?"(.+)",\s+line\s+(\d+)`)
+)
+
+// parseLink splits a link candidate into a path (or web URL) and the line
+// and column it points at.
+func parseLink(text string) (path, webURL string, line, column int) {
+	text = strings.TrimSpace(text)
+	if m := linkPythonPattern.FindStringSubmatch(text); m != nil {
+		line, _ = strconv.Atoi(m[2])
+		return m[1], "", line, 0
+	}
+	// Quotes and brackets around the link, punctuation after it
+	text = strings.TrimRight(text, ".,;")
+	text = strings.Trim(text, `"'`+"`"+`<>[]{}`)
+	text = strings.TrimRight(text, ".,;")
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		text = text[1 : len(text)-1]
+	}
+
+	if u, err := url.Parse(text); err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			return "", text, 0, 0
+		case "file":
+			text = u.Path
+		}
+	}
+
+	for _, pattern := range []*regexp.Regexp{linkColonPattern, linkParenPattern} {
+		if m := pattern.FindStringSubmatch(text); m != nil {
+			line, _ = strconv.Atoi(m[2])
+			column, _ = strconv.Atoi(m[3])
+			return m[1], "", line, column
+		}
+	}
+	return text, "", 0, 0
+}
+
+// resolveLinkPath finds the file a path from terminal output refers to:
+// relative to cwd, or for paths git prints relative to the repository
+// (a/ and b/ in diffs, --stat), relative to the repository root. It
+// returns "" if nothing exists there.
+func resolveLinkPath(cwd, path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = append(candidates, path)
+	} else if cwd != "" {
+		candidates = append(candidates, filepath.Join(cwd, path))
+		if root := findGitRoot(cwd); root != "" {
+			if rest, ok := strings.CutPrefix(path, "a/"); ok {
+				candidates = append(candidates, filepath.Join(root, rest))
+			} else if rest, ok := strings.CutPrefix(path, "b/"); ok {
+				candidates = append(candidates, filepath.Join(root, rest))
+			}
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return filepath.Clean(candidate)
+		}
+	}
+	return ""
+}
+
+// liveCwd returns the working directory of a session's pane (its active
+// pane if paneID is ""), falling back to the last one reported.
+func liveCwd(session *TerminalSession, paneID string) (string, error) {
+	if session.TmuxSession != "" {
+		target := session.TmuxSession
+		if paneID != "" {
+			target = "%" + strings.TrimPrefix(paneID, "%")
+			if targetSession(target) != session.TmuxSession {
+				return "", fmt.Errorf("pane %s not found", paneID)
+			}
+		}
+		if out, err := runTmux("display-message", "-p", "-t", target, "#{pane_current_path}"); err == nil && out != "" {
+			return out, nil
+		}
+	} else if session.cmd != nil && session.cmd.Process != nil {
+		if cwd, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(session.cmd.Process.Pid), "cwd")); err == nil {
+			return cwd, nil
+		}
+	}
+	return session.Cwd, nil
+}
+
+// ResolveLink resolves a link candidate from a session's output.
+func ResolveLink(session *TerminalSession, paneID, link string) (*ResolvedLink, error) {
+	path, webURL, line, column := parseLink(link)
+	if webURL != "" {
+		return &ResolvedLink{Kind: LinkURL, URL: webURL}, nil
+	}
+	if path == "" {
+		return nil, fmt.Errorf("not a link: %q", link)
+	}
+
+	cwd, err := liveCwd(session, paneID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := resolveLinkPath(cwd, path)
+	if resolved == "" {
+		return nil, fmt.Errorf("no such file: %s", path)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolvedLink{
+		Kind:   LinkFile,
+		Path:   resolved,
+		Line:   line,
+		Column: column,
+		IsDir:  info.IsDir(),
+		Cwd:    cwd,
+	}, nil
+}
+
+// handleTerminalLinkMessage handles terminal-resolve-link ({terminalId,
+// paneId, link, requestId}), answering with terminal-link-resolved, which
+// carries either the link or an error.
+func handleTerminalLinkMessage(raw json.RawMessage, clientSend func(interface{})) {
+	var msg struct {
+		TerminalID string `json:"terminalId"`
+		PaneID     string `json:"paneId"`
+		Link       string `json:"link"`
+		RequestID  string `json:"requestId"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Terminal] Failed to parse message: %v", err)
+		return
+	}
+
+	reply := map[string]interface{}{
+		"type":       "terminal-link-resolved",
+		"terminalId": msg.TerminalID,
+		"requestId":  msg.RequestID,
+		"text":       msg.Link,
+	}
+	session, ok := GetTerminalManager().findSession(msg.TerminalID)
+	if !ok {
+		reply["error"] = "terminal session not found"
+		clientSend(reply)
+		return
+	}
+	if link, err := ResolveLink(session, msg.PaneID, msg.Link); err != nil {
+		reply["error"] = err.Error()
+	} else {
+		reply["link"] = link
+	}
+	clientSend(reply)
+}
+
+// --- HTTP Handlers ---
+
+// TerminalResolveLink handles POST /api/terminal/{id}/resolve-link - resolve
+// a path (or URL) from the terminal's output to a file to open
+func TerminalResolveLink(w http.ResponseWriter, r *http.Request) {
+	session, ok := GetTerminalManager().findSession(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Link   string `json:"link"`
+		PaneID string `json:"paneId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Link) == "" {
+		http.Error(w, `{"error": "link is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	link, err := ResolveLink(session, req.PaneID, req.Link)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(link)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ---- Link resolver tests ----
+
+func TestParseLink_Formats(t *testing.T) {
+	tests := []struct {
+		text, path, url string
+		line, column    int
+	}{
+		{"src/main.go:42:7", "src/main.go", "", 42, 7},
+		{"src/main.go:42:", "src/main.go", "", 42, 0},
+		{"(README.md)", "README.md", "", 0, 0},
+		{"src/app.ts(12,3):", "src/app.ts", "", 12, 3},
+		{`File "/srv/app.py", line 9, in main`, "/srv/app.py", "", 9, 0},
+		{"file:///tmp/a%20b.txt", "/tmp/a b.txt", "", 0, 0},
+		{"https://example.com/x:80.", "", "https://example.com/x:80", 0, 0},
+		{"'./notes.md',", "./notes.md", "", 0, 0},
+	}
+	for _, tt := range tests {
+		path, url, line, column := parseLink(tt.text)
+		if path != tt.path || url != tt.url || line != tt.line || column != tt.column {
+			t.Errorf("parseLink(%q) = %q, %q, %d, %d", tt.text, path, url, line, column)
+		}
+	}
+}
+
+func TestResolveLinkPath_CwdAndGitRoot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".git"), 0755)
+	os.MkdirAll(filepath.Join(root, "pkg", "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "pkg", "a.go"), nil, 0644)
+	cwd := filepath.Join(root, "pkg", "sub")
+
+	tests := map[string]string{
+		"../a.go":                  filepath.Join(root, "pkg", "a.go"),
+		"b/pkg/a.go":               filepath.Join(root, "pkg", "a.go"),
+		"pkg/a.go":                 filepath.Join(root, "pkg", "a.go"),
+		filepath.Join(root, "pkg"): filepath.Join(root, "pkg"),
+		"missing.go":               "",
+	}
+	for path, want := range tests {
+		if got := resolveLinkPath(cwd, path); got != want {
+			t.Errorf("resolveLinkPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,726 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Windows and panes ---
+//
+// A tmux-backed terminal can hold several windows, each split into panes.
+// They are managed here rather than through tmux key bindings so the
+// frontend can render native splits: the layout tree is parsed from tmux,
+// every change is pushed to the session's subscribers as terminal-layout,
+// and each pane can be streamed on its own through the "terminal-pane"
+// topic (tmux pipe-pane into a FIFO) and typed into with
+// terminal-pane-input. The state lives in the tmux server, so it survives
+// backend restarts with the session.
+
+const (
+	// SplitHorizontal places panes side by side (tmux split-window -h);
+	// SplitVertical stacks them (split-window -v).
+	SplitHorizontal = "horizontal"
+	SplitVertical   = "vertical"
+
+	// paneShellOption stores the shell command of a session's interactive
+	// shell, so new windows and panes start the same shell.
+	paneShellOption = "@pane-shell"
+	// paneInputChunk is how many bytes go into one send-keys -H call.
+	paneInputChunk = 512
+)
+
+// LayoutNode is a cell of a window's layout: a pane, or a split whose
+// children are laid out side by side (horizontal) or stacked (vertical).
+type LayoutNode struct {
+	Split    string        `json:"split,omitempty"`
+	PaneID   string        `json:"paneId,omitempty"`
+	Cols     int           `json:"cols"`
+	Rows     int           `json:"rows"`
+	Left     int           `json:"left"`
+	Top      int           `json:"top"`
+	Children []*LayoutNode `json:"children,omitempty"`
+}
+
+// TerminalPane is a tmux pane.
+type TerminalPane struct {
+	ID             string `json:"id"` // tmux pane ID, e.g. "%3"
+	WindowID       string `json:"windowId"`
+	Index          int    `json:"index"`
+	Active         bool   `json:"active"`
+	Cols           int    `json:"cols"`
+	Rows           int    `json:"rows"`
+	Left           int    `json:"left"`
+	Top            int    `json:"top"`
+	PID            int    `json:"pid"`
+	CurrentCommand string `json:"currentCommand"`
+	CurrentPath    string `json:"currentPath"`
+}
+
+// TerminalWindow is a tmux window with its layout and panes.
+type TerminalWindow struct {
+	ID     string         `json:"id"` // tmux window ID, e.g. "@1"
+	Index  int            `json:"index"`
+	Name   string         `json:"name"`
+	Active bool           `json:"active"`
+	Zoomed bool           `json:"zoomed"`
+	Layout *LayoutNode    `json:"layout"`
+	Panes  []TerminalPane `json:"panes"`
+}
+
+// layoutParser reads the window_layout format:
+// cell = WxH,X,Y followed by ,paneNumber or {cells} (side by side) or
+// [cells] (stacked), with cells separated by commas.
+type layoutParser struct {
+	s   string
+	pos int
+}
+
+// parseLayout parses a tmux window_layout string such as
+// "bb62,159x48,0,0{79x48,0,0,1,79x48,80,0[79x24,80,0,2,79x23,80,25,3]}".
+func parseLayout(layout string) (*LayoutNode, error) {
+	_, cells, ok := strings.Cut(layout, ",") // drop the checksum
+	if !ok {
+		return nil, fmt.Errorf("invalid layout %q", layout)
+	}
+	p := &layoutParser{s: cells}
+	node, err := p.cell()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at %d in layout", p.s[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+func (p *layoutParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *layoutParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at %d in layout", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *layoutParser) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("expected a number at %d in layout", start)
+	}
+	return strconv.Atoi(p.s[start:p.pos])
+}
+
+func (p *layoutParser) cell() (*LayoutNode, error) {
+	node := &LayoutNode{}
+	var err error
+	for _, f := range []struct {
+		into *int
+		sep  byte
+	}{{&node.Cols, 'x'}, {&node.Rows, ','}, {&node.Left, ','}, {&node.Top, 0}} {
+		if *f.into, err = p.number(); err != nil {
+			return nil, err
+		}
+		if f.sep != 0 {
+			if err := p.expect(f.sep); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch p.peek() {
+	case ',':
+		p.pos++
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		node.PaneID = "%" + strconv.Itoa(n)
+	case '{', '[':
+		end := byte('}')
+		node.Split = SplitHorizontal
+		if p.peek() == '[' {
+			end = ']'
+			node.Split = SplitVertical
+		}
+		p.pos++
+		for {
+			child, err := p.cell()
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected end of cell at %d in layout", p.pos)
+	}
+	return node, nil
+}
+
+// ListWindows returns the windows of a tmux session with their layouts and
+// panes. (tmux replaces tabs in formats, so fields are separated by spaces
+// and the free-form one comes last.)
+func ListWindows(tmuxSession string) ([]TerminalWindow, error) {
+	out, err := tmuxCmd("list-windows", "-t", tmuxSession, "-F",
+		"#{window_id} #{window_index} #{window_active} #{window_zoomed_flag} #{window_layout} #{window_name}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list windows of %s: %w", tmuxSession, err)
+	}
+	var windows []TerminalWindow
+	byID := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		index, _ := strconv.Atoi(fields[1])
+		layout, err := parseLayout(fields[4])
+		if err != nil {
+			log.Printf("[Terminal] Layout of %s %s: %v", tmuxSession, fields[0], err)
+		}
+		byID[fields[0]] = len(windows)
+		windows = append(windows, TerminalWindow{
+			ID:     fields[0],
+			Index:  index,
+			Name:   fields[5],
+			Active: fields[2] == "1",
+			Zoomed: fields[3] == "1",
+			Layout: layout,
+			Panes:  []TerminalPane{},
+		})
+	}
+
+	out, err = tmuxCmd("list-panes", "-s", "-t", tmuxSession, "-F",
+		"#{window_id} #{pane_id} #{pane_index} #{pane_active} #{pane_width} #{pane_height} #{pane_left} #{pane_top} #{pane_pid} #{s/ /_/:pane_current_command} #{pane_current_path}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list panes of %s: %w", tmuxSession, err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, " ", 11)
+		if len(fields) < 11 {
+			continue
+		}
+		w, ok := byID[fields[0]]
+		if !ok {
+			continue
+		}
+		n := make([]int, 6)
+		for i := range n {
+			n[i], _ = strconv.Atoi(fields[i+2])
+		}
+		pane := TerminalPane{ID: fields[1], WindowID: fields[0], Index: n[0], Active: fields[3] == "1", CurrentCommand: fields[9], CurrentPath: fields[10]}
+		pane.Cols, pane.Rows, pane.Left, pane.Top = n[2], n[3], n[4], n[5]
+		pane.PID, _ = strconv.Atoi(fields[8])
+		windows[w].Panes = append(windows[w].Panes, pane)
+	}
+	return windows, nil
+}
+
+// targetSession returns the tmux session a pane ("%3") or window ("@1")
+// belongs to.
+func targetSession(target string) string {
+	out, err := tmuxCmd("display-message", "-p", "-t", target, "#{session_name}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// paneShell returns the command new panes of a session start with, or ""
+// for tmux's default shell.
+func paneShell(tmuxSession string) string {
+	out, err := tmuxCmd("show-options", "-qv", "-t", tmuxSession, paneShellOption).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// runTmux runs a tmux command, returning its trimmed output.
+func runTmux(args ...string) (string, error) {
+	out, err := tmuxCmd(args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tmux %s failed: %w (output: %s)", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// NewWindow opens a window in the session and returns its ID. cwd defaults
+// to the active pane's directory.
+func NewWindow(tmuxSession, name, cwd string) (string, error) {
+	if cwd == "" {
+		cwd = "#{pane_current_path}"
+	}
+	args := []string{"new-window", "-t", tmuxSession + ":", "-P", "-F", "#{window_id}", "-c", cwd}
+	if name != "" {
+		args = append(args, "-n", name)
+	}
+	if shell := paneShell(tmuxSession); shell != "" {
+		args = append(args, shell)
+	}
+	windowID, err := runTmux(args...)
+	if err == nil {
+		limitTmuxPanes(windowID)
+	}
+	return windowID, err
+}
+
+// SplitPane splits a pane and returns the new pane's ID. size is a
+// percentage of the pane (0 for half); before puts the new pane left of
+// or above the old one. cwd defaults to the split pane's directory.
+func SplitPane(tmuxSession, paneID, direction string, size int, before bool, cwd string) (string, error) {
+	args := []string{"split-window", "-t", paneID, "-P", "-F", "#{pane_id}"}
+	switch direction {
+	case SplitHorizontal:
+		args = append(args, "-h")
+	case SplitVertical, "":
+		args = append(args, "-v")
+	default:
+		return "", fmt.Errorf("direction must be %s or %s", SplitHorizontal, SplitVertical)
+	}
+	if size < 0 || size >= 100 {
+		return "", fmt.Errorf("size must be a percentage between 1 and 99")
+	}
+	if size > 0 {
+		args = append(args, "-l", strconv.Itoa(size)+"%")
+	}
+	if before {
+		args = append(args, "-b")
+	}
+	if cwd == "" {
+		cwd = "#{pane_current_path}"
+	}
+	args = append(args, "-c", cwd)
+	if shell := paneShell(tmuxSession); shell != "" {
+		args = append(args, shell)
+	}
+	newPaneID, err := runTmux(args...)
+	if err == nil {
+		limitTmuxPanes(newPaneID)
+	}
+	return newPaneID, err
+}
+
+// SelectPane makes a pane, and its window, active.
+func SelectPane(paneID string) error {
+	if _, err := runTmux("select-window", "-t", paneID); err != nil {
+		return err
+	}
+	_, err := runTmux("select-pane", "-t", paneID)
+	return err
+}
+
+// ResizePane sets a pane's size (0 leaves a dimension alone), or toggles
+// its zoom.
+func ResizePane(paneID string, cols, rows int, zoom bool) error {
+	args := []string{"resize-pane", "-t", paneID}
+	if zoom {
+		args = append(args, "-Z")
+	}
+	if cols > 0 {
+		args = append(args, "-x", strconv.Itoa(cols))
+	}
+	if rows > 0 {
+		args = append(args, "-y", strconv.Itoa(rows))
+	}
+	_, err := runTmux(args...)
+	return err
+}
+
+// KillPane closes a pane. The session's last pane is closed with the
+// session itself, not here.
+func KillPane(tmuxSession, paneID string) error {
+	out, err := runTmux("list-panes", "-s", "-t", tmuxSession, "-F", "#{pane_id}")
+	if err != nil {
+		return err
+	}
+	if len(strings.Fields(out)) <= 1 {
+		return fmt.Errorf("can't kill the last pane; close the terminal instead")
+	}
+	_, err = runTmux("kill-pane", "-t", paneID)
+	return err
+}
+
+// KillWindow closes a window and its panes, unless it is the last one.
+func KillWindow(tmuxSession, windowID string) error {
+	out, err := runTmux("list-windows", "-t", tmuxSession, "-F", "#{window_id}")
+	if err != nil {
+		return err
+	}
+	if len(strings.Fields(out)) <= 1 {
+		return fmt.Errorf("can't kill the last window; close the terminal instead")
+	}
+	_, err = runTmux("kill-window", "-t", windowID)
+	return err
+}
+
+// WritePane types data into one pane of a session. Like WriteToSession,
+// the client must be subscribed with a role that can write.
+func (tm *TerminalManager) WritePane(id string, client interface{}, paneID string, data []byte) error {
+	tm.mu.RLock()
+	session, ok := tm.sessions[id]
+	tm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+	if err := session.checkWriter(client); err != nil {
+		return err
+	}
+	if session.TmuxSession == "" || targetSession(paneID) != session.TmuxSession {
+		return fmt.Errorf("pane %s not found in session %s", paneID, id)
+	}
+	for len(data) > 0 {
+		n := min(len(data), paneInputChunk)
+		args := []string{"send-keys", "-H", "-t", paneID}
+		for _, b := range data[:n] {
+			args = append(args, hex.EncodeToString([]byte{b}))
+		}
+		if _, err := runTmux(args...); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// StreamPane pipes a pane's output to publish for the terminal-pane topic:
+// first a terminal-pane-snapshot of its screen, then terminal-pane-output
+// as it is written. The returned function stops the stream.
+func StreamPane(paneID string, publish func(data interface{})) (func(), error) {
+	if !strings.HasPrefix(paneID, "%") || !strings.HasPrefix(targetSession(paneID), "mt-") {
+		return nil, fmt.Errorf("pane %s not found", paneID)
+	}
+
+	dir, err := os.MkdirTemp("", "mt-pane-")
+	if err != nil {
+		return nil, err
+	}
+	fifo := filepath.Join(dir, "output")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create pane FIFO: %w", err)
+	}
+	// Opened read-write so it neither blocks nor sees EOF when cat exits
+	f, err := os.OpenFile(fifo, os.O_RDWR, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if _, err := runTmux("pipe-pane", "-O", "-t", paneID, "cat > "+shellQuote(fifo)); err != nil {
+		f.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	go func() {
+		// The screen as it is now, then live output; output written in
+		// between may show up in both
+		if screen, err := CaptureScreen(paneID, 0, true); err == nil {
+			data := "\x1b[H\x1b[2J" + strings.Join(screen.Lines, "\r\n") +
+				fmt.Sprintf("\x1b[%d;%dH", screen.CursorY+1, screen.CursorX+1)
+			publish(map[string]interface{}{
+				"type":   "terminal-pane-snapshot",
+				"paneId": paneID,
+				"cols":   screen.Cols,
+				"rows":   screen.Rows,
+				"data":   base64.StdEncoding.EncodeToString([]byte(data)),
+			})
+		}
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				publish(map[string]interface{}{
+					"type":   "terminal-pane-output",
+					"paneId": paneID,
+					"data":   base64.StdEncoding.EncodeToString(buf[:n]),
+				})
+			}
+			if err != nil {
+				if err != io.EOF && !os.IsNotExist(err) && !strings.Contains(err.Error(), "file already closed") {
+					log.Printf("[Terminal] Pane %s stream: %v", paneID, err)
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		tmuxCmd("pipe-pane", "-t", paneID).Run() // no command closes the pipe
+		f.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+// handleTerminalPaneMessage handles terminal-pane-input: base64 data typed
+// into one pane of a session.
+func handleTerminalPaneMessage(raw json.RawMessage, clientSend func(interface{}), client interface{}) {
+	var msg struct {
+		TerminalID string `json:"terminalId"`
+		PaneID     string `json:"paneId"`
+		Data       string `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Terminal] Failed to parse message: %v", err)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(msg.Data)
+	if err != nil {
+		log.Printf("[Terminal] Failed to decode pane input: %v", err)
+		return
+	}
+	if err := GetTerminalManager().WritePane(msg.TerminalID, client, msg.PaneID, data); err != nil {
+		clientSend(map[string]interface{}{
+			"type":       "terminal-input-rejected",
+			"terminalId": msg.TerminalID,
+			"paneId":     msg.PaneID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// --- HTTP Handlers ---
+
+// tmuxTarget returns the session a request names and writes an error
+// unless it is a live tmux-backed terminal.
+func tmuxTarget(w http.ResponseWriter, r *http.Request) (*TerminalSession, bool) {
+	session, ok := GetTerminalManager().findSession(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	if session.TmuxSession == "" {
+		http.Error(w, `{"error": "windows and panes need the tmux backend"}`, http.StatusConflict)
+		return nil, false
+	}
+	return session, true
+}
+
+// paneTarget resolves a {pane} ("3" or "%3") or {window} ("1" or "@1")
+// URL parameter to a tmux ID in the session, writing a 404 otherwise.
+func paneTarget(w http.ResponseWriter, r *http.Request, session *TerminalSession, param string, prefix string) (string, bool) {
+	target := strings.TrimPrefix(chi.URLParam(r, param), prefix)
+	if _, err := strconv.Atoi(target); err != nil || targetSession(prefix+target) != session.TmuxSession {
+		http.Error(w, fmt.Sprintf(`{"error": "%s not found"}`, param), http.StatusNotFound)
+		return "", false
+	}
+	return prefix + target, true
+}
+
+// writeLayout responds with the session's windows (plus extra fields) and
+// pushes them to its subscribers.
+func writeLayout(w http.ResponseWriter, session *TerminalSession, status int, extra map[string]interface{}) {
+	windows, err := ListWindows(session.TmuxSession)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	GetTerminalManager().sendSessionEvent(session.ID, map[string]interface{}{
+		"type":       "terminal-layout",
+		"terminalId": session.ID,
+		"windows":    windows,
+	})
+	resp := map[string]interface{}{"terminalId": session.ID, "windows": windows}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// TerminalWindows handles GET /api/terminal/{id}/windows - windows, their
+// layout trees and panes
+func TerminalWindows(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	windows, err := ListWindows(session.TmuxSession)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"terminalId": session.ID, "windows": windows})
+}
+
+// TerminalWindowCreate handles POST /api/terminal/{id}/windows - open a
+// window: {"name": "logs", "cwd": "/path"}
+func TerminalWindowCreate(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+		Cwd  string `json:"cwd"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	windowID, err := NewWindow(session.TmuxSession, req.Name, req.Cwd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeLayout(w, session, http.StatusCreated, map[string]interface{}{"windowId": windowID})
+}
+
+// TerminalWindowSelect handles POST /api/terminal/{id}/windows/{window}/select
+func TerminalWindowSelect(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	windowID, ok := paneTarget(w, r, session, "window", "@")
+	if !ok {
+		return
+	}
+	if _, err := runTmux("select-window", "-t", windowID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeLayout(w, session, http.StatusOK, nil)
+}
+
+// TerminalWindowKill handles DELETE /api/terminal/{id}/windows/{window}
+func TerminalWindowKill(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	windowID, ok := paneTarget(w, r, session, "window", "@")
+	if !ok {
+		return
+	}
+	if err := KillWindow(session.TmuxSession, windowID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusConflict)
+		return
+	}
+	writeLayout(w, session, http.StatusOK, nil)
+}
+
+// TerminalPaneSplit handles POST /api/terminal/{id}/panes/{pane}/split -
+// {"direction": "horizontal", "size": 30, "before": false, "cwd": ""}
+func TerminalPaneSplit(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	paneID, ok := paneTarget(w, r, session, "pane", "%")
+	if !ok {
+		return
+	}
+	var req struct {
+		Direction string `json:"direction"`
+		Size      int    `json:"size"`
+		Before    bool   `json:"before"`
+		Cwd       string `json:"cwd"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	newPane, err := SplitPane(session.TmuxSession, paneID, req.Direction, req.Size, req.Before, req.Cwd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	writeLayout(w, session, http.StatusCreated, map[string]interface{}{"paneId": newPane})
+}
+
+// TerminalPaneSelect handles POST /api/terminal/{id}/panes/{pane}/select
+func TerminalPaneSelect(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	paneID, ok := paneTarget(w, r, session, "pane", "%")
+	if !ok {
+		return
+	}
+	if err := SelectPane(paneID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeLayout(w, session, http.StatusOK, nil)
+}
+
+// TerminalPaneResize handles POST /api/terminal/{id}/panes/{pane}/resize -
+// {"cols": 80, "rows": 20} or {"zoom": true} to toggle zoom
+func TerminalPaneResize(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	paneID, ok := paneTarget(w, r, session, "pane", "%")
+	if !ok {
+		return
+	}
+	var req struct {
+		Cols int  `json:"cols"`
+		Rows int  `json:"rows"`
+		Zoom bool `json:"zoom"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Cols <= 0 && req.Rows <= 0 && !req.Zoom {
+		http.Error(w, `{"error": "cols, rows or zoom is required"}`, http.StatusBadRequest)
+		return
+	}
+	if err := ResizePane(paneID, req.Cols, req.Rows, req.Zoom); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeLayout(w, session, http.StatusOK, nil)
+}
+
+// TerminalPaneKill handles DELETE /api/terminal/{id}/panes/{pane}
+func TerminalPaneKill(w http.ResponseWriter, r *http.Request) {
+	session, ok := tmuxTarget(w, r)
+	if !ok {
+		return
+	}
+	paneID, ok := paneTarget(w, r, session, "pane", "%")
+	if !ok {
+		return
+	}
+	if err := KillPane(session.TmuxSession, paneID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusConflict)
+		return
+	}
+	writeLayout(w, session, http.StatusOK, nil)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// ---- Window layout tests ----
+
+func TestParseLayout_NestedSplits(t *testing.T) {
+	root, err := parseLayout("bb62,159x48,0,0{79x48,0,0,1,79x48,80,0[79x24,80,0,2,79x23,80,25,3]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Split != SplitHorizontal || root.Cols != 159 || root.Rows != 48 || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	if left := root.Children[0]; left.PaneID != "%1" || left.Cols != 79 {
+		t.Errorf("unexpected left pane: %+v", left)
+	}
+	right := root.Children[1]
+	if right.Split != SplitVertical || right.Left != 80 || len(right.Children) != 2 {
+		t.Fatalf("unexpected right split: %+v", right)
+	}
+	if bottom := right.Children[1]; bottom.PaneID != "%3" || bottom.Top != 25 || bottom.Rows != 23 {
+		t.Errorf("unexpected bottom pane: %+v", bottom)
+	}
+
+	single, err := parseLayout("c0d1,80x24,0,0,5")
+	if err != nil || single.PaneID != "%5" || single.Split != "" {
+		t.Errorf("single pane layout = %+v, %v", single, err)
+	}
+	for _, bad := range []string{"", "abcd,80x24,0,0", "abcd,80x24,0,0{80x24,0,0,1", "abcd,80x24,0,0,1]"} {
+		if _, err := parseLayout(bad); err == nil {
+			t.Errorf("parseLayout(%q) should fail", bad)
+		}
+	}
+}
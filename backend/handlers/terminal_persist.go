@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"markdown-themes-backend/db"
+)
+
+// --- Session metadata persistence ---
+//
+// tmux keeps the shell alive across backend restarts but knows nothing about
+// profiles, titles or tab order, so that metadata is written to the
+// terminal_sessions table when a session is spawned and read back when
+// orphaned tmux sessions are recovered. Database errors are logged and
+// otherwise ignored: a terminal must keep working without its metadata.
+
+// sessionRecord converts a session into its persisted form.
+func sessionRecord(s *TerminalSession) *db.TerminalSessionRecord {
+	rec := &db.TerminalSessionRecord{
+		ID:          s.ID,
+		TmuxSession: s.TmuxSession,
+		ProfileID:   s.ProfileID,
+		ProfileName: s.ProfileName,
+		Command:     s.Command,
+		Cwd:         s.Cwd,
+		Title:       s.Title,
+		TabOrder:    s.TabOrder,
+		CreatedAt:   s.CreatedAt.UnixMilli(),
+	}
+	if s.LastAttachedAt != nil {
+		ms := s.LastAttachedAt.UnixMilli()
+		rec.LastAttachedAt = &ms
+	}
+	return rec
+}
+
+// applySessionRecord restores persisted metadata onto a session.
+func applySessionRecord(s *TerminalSession, rec *db.TerminalSessionRecord) {
+	s.ProfileID = rec.ProfileID
+	s.ProfileName = rec.ProfileName
+	s.Command = rec.Command
+	s.Cwd = rec.Cwd
+	s.Title = rec.Title
+	s.TabOrder = rec.TabOrder
+	s.CreatedAt = time.UnixMilli(rec.CreatedAt)
+	if rec.LastAttachedAt != nil {
+		t := time.UnixMilli(*rec.LastAttachedAt)
+		s.LastAttachedAt = &t
+	}
+}
+
+// copySessionMeta carries metadata from a superseded session entry to the
+// entry that replaces it on reconnect.
+func copySessionMeta(dst, src *TerminalSession) {
+	dst.Cwd = src.Cwd
+	dst.CreatedAt = src.CreatedAt
+	dst.ProfileID = src.ProfileID
+	dst.ProfileName = src.ProfileName
+	dst.Command = src.Command
+	dst.Title = src.Title
+	dst.TabOrder = src.TabOrder
+	dst.LastAttachedAt = src.LastAttachedAt
+}
+
+// restoreSessionMeta loads the persisted record for a session, if any.
+func restoreSessionMeta(s *TerminalSession) {
+	rec, err := db.GetTerminalSession(s.ID)
+	if err != nil {
+		log.Printf("[Terminal] Failed to load metadata for %s: %v", s.ID, err)
+		return
+	}
+	if rec != nil {
+		applySessionRecord(s, rec)
+	}
+}
+
+// persistSession writes the session's metadata record. Plain PTY sessions
+// end with the process, so there is nothing to recover them from.
+func persistSession(s *TerminalSession) {
+	if !s.backend().Persistent() {
+		return
+	}
+	if err := db.SaveTerminalSession(sessionRecord(s)); err != nil {
+		log.Printf("[Terminal] Failed to persist metadata for %s: %v", s.ID, err)
+	}
+}
+
+// touchSession records a client attaching to the session.
+func touchSession(s *TerminalSession) {
+	now := time.Now()
+	s.LastAttachedAt = &now
+	if !s.backend().Persistent() {
+		return
+	}
+	if err := db.TouchTerminalSession(s.ID, now); err != nil {
+		log.Printf("[Terminal] Failed to update last-attached time for %s: %v", s.ID, err)
+	}
+}
+
+// forgetSession removes the metadata of a session whose tmux session is gone.
+func forgetSession(id string) {
+	if err := db.DeleteTerminalSession(id); err != nil {
+		log.Printf("[Terminal] Failed to delete metadata for %s: %v", id, err)
+	}
+}
+
+// loadSessionRecords returns the persisted records of sessions whose tmux
+// session still exists, keyed by ID. Records of dead sessions are pruned.
+func loadSessionRecords() map[string]*db.TerminalSessionRecord {
+	records, err := db.ListTerminalSessions()
+	if err != nil {
+		log.Printf("[Terminal] Failed to load session metadata: %v", err)
+		return nil
+	}
+	result := make(map[string]*db.TerminalSessionRecord, len(records))
+	for i := range records {
+		if !tmuxHasSession(records[i].TmuxSession) {
+			log.Printf("[Terminal] Pruning metadata of dead session %s", records[i].ID)
+			forgetSession(records[i].ID)
+			continue
+		}
+		result[records[i].ID] = &records[i]
+	}
+	return result
+}
+
+// tmuxSessionCreated returns when tmux created a session, or now if unknown.
+func tmuxSessionCreated(name string) time.Time {
+	out, err := tmuxCmd("display-message", "-p", "-t", name, "#{session_created}").Output()
+	if err != nil {
+		return time.Now()
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(secs, 0)
+}
+
+// snapshot returns a copy of the session's exported fields.
+func (s *TerminalSession) snapshot() TerminalSession {
+	return TerminalSession{
+		ID:             s.ID,
+		TmuxSession:    s.TmuxSession,
+		Backend:        s.Backend,
+		Cwd:            s.Cwd,
+		Cols:           s.Cols,
+		Rows:           s.Rows,
+		CreatedAt:      s.CreatedAt,
+		ProfileID:      s.ProfileID,
+		ProfileName:    s.ProfileName,
+		Command:        s.Command,
+		Title:          s.Title,
+		TabOrder:       s.TabOrder,
+		LastAttachedAt: s.LastAttachedAt,
+	}
+}
+
+// sortSessions orders sessions as the client's tabs were ordered.
+func sortSessions(sessions []TerminalSession) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].TabOrder != sessions[j].TabOrder {
+			return sessions[i].TabOrder < sessions[j].TabOrder
+		}
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+}
+
+// UpdateSessionMeta sets a session's title and/or tab order. Nil arguments
+// are left unchanged.
+func (tm *TerminalManager) UpdateSessionMeta(id string, title *string, tabOrder *int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	session, ok := tm.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+	if title != nil {
+		session.Title = *title
+	}
+	if tabOrder != nil {
+		session.TabOrder = *tabOrder
+	}
+	if err := db.UpdateTerminalSessionMeta(id, title, tabOrder); err != nil {
+		log.Printf("[Terminal] Failed to persist metadata for %s: %v", id, err)
+	}
+	return nil
+}
+
+// ReorderSessions assigns tab order from the position of each ID in order.
+// Unknown IDs are skipped.
+func (tm *TerminalManager) ReorderSessions(order []string) {
+	for i, id := range order {
+		if err := tm.UpdateSessionMeta(id, nil, &i); err != nil {
+			log.Printf("[Terminal] Reorder: %v", err)
+		}
+	}
+}
+
+// handleTerminalMetaMessage handles terminal-meta (title and/or tabOrder of
+// one terminal) and terminal-reorder (full tab order). The updated session
+// list is broadcast to every client so other windows stay in sync.
+func handleTerminalMetaMessage(msgType string, raw json.RawMessage, clientSend func(interface{})) {
+	tm := GetTerminalManager()
+
+	var msg struct {
+		TerminalID string   `json:"terminalId"`
+		Title      *string  `json:"title"`
+		TabOrder   *int     `json:"tabOrder"`
+		Order      []string `json:"order"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Terminal] Failed to parse message: %v", err)
+		return
+	}
+
+	switch msgType {
+	case "terminal-meta":
+		if err := tm.UpdateSessionMeta(msg.TerminalID, msg.Title, msg.TabOrder); err != nil {
+			clientSend(map[string]interface{}{
+				"type":       "terminal-error",
+				"terminalId": msg.TerminalID,
+				"error":      err.Error(),
+			})
+			return
+		}
+	case "terminal-reorder":
+		tm.ReorderSessions(msg.Order)
+	}
+
+	message := map[string]interface{}{
+		"type":     "terminal-meta-updated",
+		"sessions": tm.ListSessions(),
+	}
+	if tm.broadcastAllFunc != nil {
+		tm.broadcastAllFunc(message)
+	} else {
+		clientSend(message)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Port detection ---
+//
+// Dev servers started in a terminal (vite, go run, rails s) are found by
+// their listening sockets: every couple of seconds the process trees of
+// all panes are matched against /proc/net/tcp{,6}, and clients are told
+// when a port opens or closes so it can be previewed through
+// /preview/{port}/.
+
+// portPollInterval is how often listening ports are checked.
+const portPollInterval = 2 * time.Second
+
+// OpenPort is a TCP port listened on by a process in a terminal.
+type OpenPort struct {
+	TerminalID string `json:"terminalId"`
+	Port       int    `json:"port"`
+	PID        int    `json:"pid"`
+	Command    string `json:"command"`
+	PreviewURL string `json:"previewUrl"`
+}
+
+// panePIDs returns the shell PID of every pane of every tmux session.
+func panePIDs() map[string][]int {
+	out, err := runTmux("list-panes", "-a", "-F", "#{session_name} #{pane_pid}")
+	if err != nil {
+		return nil
+	}
+	pids := make(map[string][]int)
+	for _, line := range strings.Split(out, "\n") {
+		name, pidStr, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if pid, err := strconv.Atoi(pidStr); err == nil {
+			pids[name] = append(pids[name], pid)
+		}
+	}
+	return pids
+}
+
+// scanPorts finds the listening ports held by processes in terminals.
+func (tm *TerminalManager) scanPorts() map[int]OpenPort {
+	tm.mu.RLock()
+	roots := make(map[string][]int)
+	tmuxIDs := make(map[string]bool)
+	for id, session := range tm.sessions {
+		if session.Backend == BackendPTY {
+			if session.cmd != nil && session.cmd.Process != nil {
+				roots[id] = []int{session.cmd.Process.Pid}
+			}
+		} else {
+			tmuxIDs[id] = true
+		}
+	}
+	tm.mu.RUnlock()
+
+	ports := make(map[int]OpenPort)
+	listening := make(map[string]int)
+	for _, f := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if data, err := os.ReadFile(f); err == nil {
+			parseListeningSockets(string(data), listening)
+		}
+	}
+	if len(listening) == 0 {
+		return ports
+	}
+	if len(tmuxIDs) > 0 {
+		for name, pids := range panePIDs() {
+			if tmuxIDs[name] {
+				roots[name] = pids
+			}
+		}
+	}
+
+	table := scanProcs()
+	var walk func(id string, pid int)
+	walk = func(id string, pid int) {
+		held := make(map[int]bool)
+		processPorts(pid, listening, held)
+		for port := range held {
+			if _, ok := ports[port]; !ok {
+				ports[port] = OpenPort{
+					TerminalID: id,
+					Port:       port,
+					PID:        pid,
+					Command:    table.stats[pid].comm,
+					PreviewURL: previewPath(port) + "/",
+				}
+			}
+		}
+		for _, child := range table.children[pid] {
+			walk(id, child)
+		}
+	}
+	for id, pids := range roots {
+		for _, pid := range pids {
+			walk(id, pid)
+		}
+	}
+	return ports
+}
+
+// monitorPorts tracks terminals' listening ports, broadcasting
+// port-opened and port-closed events to all clients as they change. A
+// server restarting on the same port in the same terminal (a new PID)
+// isn't reported.
+func (tm *TerminalManager) monitorPorts() {
+	ticker := time.NewTicker(portPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		tm.mu.RLock()
+		count := len(tm.sessions)
+		tm.mu.RUnlock()
+		current := make(map[int]OpenPort)
+		if count > 0 {
+			current = tm.scanPorts()
+		}
+
+		tm.portsMu.Lock()
+		previous := tm.ports
+		tm.ports = current
+		tm.portsMu.Unlock()
+
+		var events []map[string]interface{}
+		for port, old := range previous {
+			if p, ok := current[port]; !ok || p.TerminalID != old.TerminalID {
+				events = append(events, portEvent("port-closed", old))
+			}
+		}
+		for port, p := range current {
+			if old, ok := previous[port]; !ok || old.TerminalID != p.TerminalID {
+				events = append(events, portEvent("port-opened", p))
+			}
+		}
+		if len(events) == 0 || tm.broadcastAllFunc == nil {
+			continue
+		}
+		// Closes before opens, by port
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i]["type"] != events[j]["type"] {
+				return events[i]["type"] == "port-closed"
+			}
+			return events[i]["port"].(int) < events[j]["port"].(int)
+		})
+		for _, event := range events {
+			tm.broadcastAllFunc(event)
+		}
+	}
+}
+
+func portEvent(eventType string, p OpenPort) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       eventType,
+		"terminalId": p.TerminalID,
+		"port":       p.Port,
+		"pid":        p.PID,
+		"command":    p.Command,
+		"previewUrl": p.PreviewURL,
+	}
+}
+
+// OpenPorts returns the ports terminals are listening on, by port.
+func (tm *TerminalManager) OpenPorts() []OpenPort {
+	tm.portsMu.RLock()
+	defer tm.portsMu.RUnlock()
+	ports := make([]OpenPort, 0, len(tm.ports))
+	for _, p := range tm.ports {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// portOpen reports whether a terminal is listening on port.
+func (tm *TerminalManager) portOpen(port int) bool {
+	tm.portsMu.RLock()
+	defer tm.portsMu.RUnlock()
+	_, ok := tm.ports[port]
+	return ok
+}
+
+// --- HTTP Handlers ---
+
+// TerminalPorts handles GET /api/terminal/ports - the ports terminals are
+// listening on, with their preview URLs
+func TerminalPorts(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ports": GetTerminalManager().OpenPorts(),
+	})
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Process inspection ---
+//
+// tmux tells us each pane's shell PID, foreground command and cwd; a walk
+// of /proc fills in the process tree under the shell with CPU, memory,
+// running time and listening TCP ports. A snapshot of every session is
+// broadcast periodically so tabs can show what they're running.
+
+const (
+	// processPollInterval is how often process snapshots are broadcast.
+	processPollInterval = 5 * time.Second
+	// clockTicks is USER_HZ, the unit of /proc CPU times (100 on Linux).
+	clockTicks = 100
+)
+
+// ProcessInfo describes a process and its descendants.
+type ProcessInfo struct {
+	PID        int            `json:"pid"`
+	Command    string         `json:"command"` // executable name
+	Args       string         `json:"args,omitempty"`
+	CPUPercent float64        `json:"cpu"`
+	RSS        int64          `json:"rss"` // bytes
+	StartedAt  time.Time      `json:"startedAt"`
+	Children   []*ProcessInfo `json:"children,omitempty"`
+}
+
+// SessionProcesses is what a terminal is running.
+type SessionProcesses struct {
+	TerminalID     string `json:"terminalId"`
+	CurrentCommand string `json:"currentCommand"` // tmux pane_current_command
+	CurrentPath    string `json:"currentPath"`    // tmux pane_current_path
+	// Idle is set when the shell itself is in the foreground (at a prompt)
+	Idle bool `json:"idle"`
+	// Foreground is the foreground job's leader, without children
+	Foreground *ProcessInfo `json:"foreground,omitempty"`
+	// RunningSeconds is how long the foreground job (or the shell, when
+	// idle) has been running
+	RunningSeconds int64 `json:"runningSeconds"`
+	// Tree is rooted at the pane's shell; CPU and RSS are its totals
+	Tree       *ProcessInfo `json:"tree,omitempty"`
+	CPUPercent float64      `json:"cpu"`
+	RSS        int64        `json:"rss"`
+	Ports      []int        `json:"ports,omitempty"`
+}
+
+// procStat holds the fields read from /proc/{pid}/stat.
+type procStat struct {
+	pid       int
+	comm      string
+	ppid      int
+	pgrp      int
+	tpgid     int    // foreground process group of the controlling tty
+	cpuTicks  uint64 // utime + stime
+	startTick uint64 // start time in ticks after boot
+	rssPages  int64
+}
+
+// parseProcStat parses a /proc/{pid}/stat line. The command name is in
+// parentheses and may itself contain spaces and parentheses.
+func parseProcStat(line string) (procStat, bool) {
+	lp := strings.IndexByte(line, '(')
+	rp := strings.LastIndexByte(line, ')')
+	if lp < 0 || rp < lp {
+		return procStat{}, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line[:lp]))
+	if err != nil {
+		return procStat{}, false
+	}
+	// fields[0] is field 3 (state) of proc(5)
+	fields := strings.Fields(line[rp+1:])
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	field := func(n int) int64 {
+		v, _ := strconv.ParseInt(fields[n-3], 10, 64)
+		return v
+	}
+	return procStat{
+		pid:       pid,
+		comm:      line[lp+1 : rp],
+		ppid:      int(field(4)),
+		pgrp:      int(field(5)),
+		tpgid:     int(field(8)),
+		cpuTicks:  uint64(field(14) + field(15)),
+		startTick: uint64(field(22)),
+		rssPages:  field(24),
+	}, true
+}
+
+// parseListeningSockets reads /proc/net/tcp{,6} content into a map from
+// socket inode to port, for sockets in the LISTEN state.
+func parseListeningSockets(content string, into map[string]int) {
+	for _, line := range strings.Split(content, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[3] != "0A" {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(portHex, 16, 32)
+		if err != nil {
+			continue
+		}
+		into[fields[9]] = int(port)
+	}
+}
+
+// bootTime returns when the system booted, from /proc/stat.
+func bootTime() time.Time {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			secs, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// cpuSample is a process's CPU time when last inspected.
+type cpuSample struct {
+	ticks uint64
+	at    time.Time
+}
+
+// processSampler turns cumulative CPU times into recent CPU percentages.
+type processSampler struct {
+	samples map[int]cpuSample
+	mu      sync.Mutex
+}
+
+// procTable is one scan of /proc.
+type procTable struct {
+	stats    map[int]procStat
+	children map[int][]int
+}
+
+func scanProcs() procTable {
+	table := procTable{stats: make(map[int]procStat), children: make(map[int][]int)}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return table
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue // exited meanwhile
+		}
+		if st, ok := parseProcStat(strings.TrimSpace(string(data))); ok {
+			table.stats[st.pid] = st
+			table.children[st.ppid] = append(table.children[st.ppid], st.pid)
+		}
+	}
+	for _, pids := range table.children {
+		sort.Ints(pids)
+	}
+	return table
+}
+
+// processArgs returns a process's command line, space-separated.
+func processArgs(pid int) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// processPorts adds the ports of the listening sockets a process holds.
+func processPorts(pid int, listening map[string]int, into map[int]bool) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(dir)
+	if err != nil {
+		return // not ours to inspect, or exited
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(dir, fd.Name()))
+		if err != nil || !strings.HasPrefix(target, "socket:[") {
+			continue
+		}
+		if port, ok := listening[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")]; ok {
+			into[port] = true
+		}
+	}
+}
+
+// tmuxPane is the active pane of a session as reported by tmux.
+type tmuxPane struct {
+	pid     int
+	command string
+	path    string
+}
+
+// activePanes returns the active pane of the active window of each tmux
+// session. (tmux replaces tabs in formats, so fields are separated by
+// spaces, spaces in the command are replaced and the path comes last.)
+func activePanes() map[string]tmuxPane {
+	out, err := tmuxCmd("list-panes", "-a", "-F",
+		"#{session_name} #{window_active}#{pane_active} #{pane_pid} #{s/ /_/:pane_current_command} #{pane_current_path}").Output()
+	if err != nil {
+		return nil
+	}
+	panes := make(map[string]tmuxPane)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) < 5 || fields[1] != "11" {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		panes[fields[0]] = tmuxPane{pid: pid, command: fields[3], path: fields[4]}
+	}
+	return panes
+}
+
+// ptyPane describes a plain PTY session's shell the way tmux would: the
+// foreground job's command and working directory.
+func ptyPane(pid int, table procTable) tmuxPane {
+	pane := tmuxPane{pid: pid}
+	fg := pid
+	if shell, ok := table.stats[pid]; ok {
+		if _, ok := table.stats[shell.tpgid]; ok {
+			fg = shell.tpgid
+		}
+	}
+	pane.command = table.stats[fg].comm
+	pane.path, _ = os.Readlink(filepath.Join("/proc", strconv.Itoa(fg), "cwd"))
+	return pane
+}
+
+// SessionProcesses inspects the processes of every terminal session.
+func (tm *TerminalManager) SessionProcesses() []SessionProcesses {
+	tm.mu.RLock()
+	ids := make([]string, 0, len(tm.sessions))
+	shells := make(map[string]int) // plain PTY sessions' shell PIDs
+	for id, session := range tm.sessions {
+		ids = append(ids, id)
+		if session.Backend == BackendPTY && session.cmd != nil && session.cmd.Process != nil {
+			shells[id] = session.cmd.Process.Pid
+		}
+	}
+	tm.mu.RUnlock()
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		return []SessionProcesses{}
+	}
+
+	var panes map[string]tmuxPane
+	if len(shells) < len(ids) {
+		panes = activePanes()
+	} else {
+		panes = make(map[string]tmuxPane)
+	}
+	table := scanProcs()
+	for id, pid := range shells {
+		panes[id] = ptyPane(pid, table)
+	}
+	listening := make(map[string]int)
+	for _, f := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if data, err := os.ReadFile(f); err == nil {
+			parseListeningSockets(string(data), listening)
+		}
+	}
+	now := time.Now()
+	boot := bootTime()
+
+	tm.procSampler.mu.Lock()
+	defer tm.procSampler.mu.Unlock()
+	seen := make(map[int]bool)
+
+	var build func(pid int) *ProcessInfo
+	build = func(pid int) *ProcessInfo {
+		st := table.stats[pid]
+		seen[pid] = true
+		info := &ProcessInfo{
+			PID:       pid,
+			Command:   st.comm,
+			Args:      processArgs(pid),
+			RSS:       st.rssPages * int64(os.Getpagesize()),
+			StartedAt: boot.Add(time.Duration(st.startTick) * time.Second / clockTicks),
+		}
+		// CPU since the last sample, or since the process started
+		prev, ok := tm.procSampler.samples[pid]
+		if !ok {
+			prev = cpuSample{at: info.StartedAt}
+		}
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 && st.cpuTicks >= prev.ticks {
+			info.CPUPercent = float64(st.cpuTicks-prev.ticks) / clockTicks / elapsed * 100
+		}
+		tm.procSampler.samples[pid] = cpuSample{ticks: st.cpuTicks, at: now}
+
+		for _, child := range table.children[pid] {
+			info.Children = append(info.Children, build(child))
+		}
+		return info
+	}
+
+	result := make([]SessionProcesses, 0, len(ids))
+	for _, id := range ids {
+		sp := SessionProcesses{TerminalID: id}
+		pane, ok := panes[id]
+		if !ok {
+			result = append(result, sp)
+			continue
+		}
+		sp.CurrentCommand = pane.command
+		sp.CurrentPath = pane.path
+		shell, ok := table.stats[pane.pid]
+		if !ok {
+			result = append(result, sp)
+			continue
+		}
+
+		sp.Tree = build(pane.pid)
+		ports := make(map[int]bool)
+		var walk func(p *ProcessInfo)
+		walk = func(p *ProcessInfo) {
+			sp.CPUPercent += p.CPUPercent
+			sp.RSS += p.RSS
+			processPorts(p.PID, listening, ports)
+			if table.stats[p.PID].pgrp == shell.tpgid && sp.Foreground == nil && p.PID != pane.pid {
+				fg := *p
+				fg.Children = nil
+				sp.Foreground = &fg
+			}
+			for _, c := range p.Children {
+				walk(c)
+			}
+		}
+		walk(sp.Tree)
+		for port := range ports {
+			sp.Ports = append(sp.Ports, port)
+		}
+		sort.Ints(sp.Ports)
+
+		sp.Idle = shell.tpgid == shell.pgrp
+		started := sp.Tree.StartedAt
+		if sp.Foreground != nil {
+			started = sp.Foreground.StartedAt
+		}
+		sp.RunningSeconds = int64(now.Sub(started).Seconds())
+		result = append(result, sp)
+	}
+
+	// Forget processes that have exited
+	for pid := range tm.procSampler.samples {
+		if !seen[pid] {
+			delete(tm.procSampler.samples, pid)
+		}
+	}
+	return result
+}
+
+// monitorProcesses broadcasts a process snapshot of every session to all
+// clients while sessions exist.
+func (tm *TerminalManager) monitorProcesses() {
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if tm.broadcastAllFunc == nil {
+			continue
+		}
+		tm.mu.RLock()
+		count := len(tm.sessions)
+		tm.mu.RUnlock()
+		if count == 0 {
+			continue
+		}
+		tm.broadcastAllFunc(map[string]interface{}{
+			"type":     "terminal-processes",
+			"sessions": tm.SessionProcesses(),
+		})
+	}
+}
+
+// --- HTTP Handlers ---
+
+// TerminalProcesses handles GET /api/terminal/processes - what each
+// terminal is running
+func TerminalProcesses(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": GetTerminalManager().SessionProcesses(),
+	})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// ---- Process inspection tests ----
+
+func TestParseProcStat_CommWithSpacesAndParens(t *testing.T) {
+	line := "4242 (node (dev) x) S 4100 4242 4100 34816 4242 4194304 100 0 0 0 250 50 0 0 20 0 11 0 123456 1000000 2048 18446744073709551615"
+	st, ok := parseProcStat(line)
+	if !ok {
+		t.Fatal("expected the line to parse")
+	}
+	if st.pid != 4242 || st.comm != "node (dev) x" || st.ppid != 4100 || st.pgrp != 4242 || st.tpgid != 4242 {
+		t.Errorf("unexpected identity fields: %+v", st)
+	}
+	if st.cpuTicks != 300 || st.startTick != 123456 || st.rssPages != 2048 {
+		t.Errorf("unexpected counters: %+v", st)
+	}
+
+	if _, ok := parseProcStat("4242 (truncated) S 1 2"); ok {
+		t.Error("a short line shouldn't parse")
+	}
+}
+
+func TestParseListeningSockets(t *testing.T) {
+	content := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1FC2 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 51234 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:D2F0 0100007F:1FC2 01 00000000:00000000 00:00000000 00000000     0        0 51300 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 60001 1 0000000000000000 100 0 0 10 0
+`
+	listening := make(map[string]int)
+	parseListeningSockets(content, listening)
+	if len(listening) != 2 || listening["51234"] != 8130 || listening["60001"] != 3000 {
+		t.Errorf("unexpected listening sockets: %v", listening)
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"markdown-themes-backend/utils"
+)
+
+// --- Profile management ---
+
+// TerminalProfile represents a saved terminal profile. String fields may
+// use the {{workspace}}, {{file}}, {{gitRoot}} and {{home}} placeholders,
+// which are expanded server-side when the profile is spawned. In Command
+// and PreCommand the values are shell-quoted, so write {{file}}, not
+// "{{file}}".
+type TerminalProfile struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"`
+	Cwd     string `json:"cwd,omitempty"`
+
+	// Environment variables added to the session
+	Env map[string]string `json:"env,omitempty"`
+	// Shell overrides $SHELL (path or name on PATH)
+	Shell string `json:"shell,omitempty"`
+	// Login runs the shell as a login shell (default true)
+	Login *bool `json:"login,omitempty"`
+	// PreCommand runs in the shell before Command or the interactive prompt
+	PreCommand string `json:"preCommand,omitempty"`
+	// Initial size, used when the client doesn't send one
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+	// TmuxOptions are tmux session options, e.g. "history-limit": "50000",
+	// "status-style": "bg=blue"
+	TmuxOptions map[string]string `json:"tmuxOptions,omitempty"`
+	// ShellIntegration reports command boundaries and cwd changes from
+	// bash, zsh and fish (default false)
+	ShellIntegration *bool `json:"shellIntegration,omitempty"`
+	// Notifications selects the terminal-activity events the profile's
+	// terminals emit (default: bell and long commands finishing)
+	Notifications *NotificationRules `json:"notifications,omitempty"`
+	// Backend runs the profile's terminals in "tmux" or on a plain "pty"
+	// (default: tmux when installed)
+	Backend string `json:"backend,omitempty"`
+}
+
+func profilesPath() string {
+	return filepath.Join(utils.DataDir(), "terminal-profiles.json")
+}
+
+// LoadProfiles reads saved terminal profiles
+func LoadProfiles() ([]TerminalProfile, error) {
+	data, err := os.ReadFile(profilesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TerminalProfile{
+				{ID: "default-shell", Name: "Shell", Cwd: "{{workspace}}"},
+			}, nil
+		}
+		return nil, err
+	}
+	var profiles []TerminalProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// SaveProfiles writes terminal profiles to disk
+func SaveProfiles(profiles []TerminalProfile) error {
+	path := profilesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// FindProfile returns the saved profile with the given ID.
+func FindProfile(id string) (*TerminalProfile, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		if profiles[i].ID == id {
+			return &profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("profile %s not found", id)
+}
+
+// --- Validation ---
+
+var (
+	templatePattern   = regexp.MustCompile(`\{\{\s*([A-Za-z]+)\s*\}\}`)
+	envKeyPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	tmuxOptionPattern = regexp.MustCompile(`^@?[a-z][a-z0-9-]*$`)
+)
+
+// templateVarNames are the placeholders profiles may use.
+var templateVarNames = map[string]bool{
+	"workspace": true,
+	"file":      true,
+	"gitRoot":   true,
+	"home":      true,
+}
+
+// reservedEnvKeys are set by the terminal itself and can't be overridden.
+var reservedEnvKeys = map[string]bool{
+	"MDT_TERMINAL":   true,
+	"MDT_SESSION_ID": true,
+	"TMUX":           true,
+	"TMUX_PANE":      true,
+}
+
+// checkTemplate rejects unknown placeholders.
+func checkTemplate(field, value string) error {
+	for _, m := range templatePattern.FindAllStringSubmatch(value, -1) {
+		if !templateVarNames[m[1]] {
+			return fmt.Errorf("%s: unknown placeholder {{%s}}", field, m[1])
+		}
+	}
+	return nil
+}
+
+// Validate checks a profile for problems that would make it fail to spawn.
+func (p *TerminalProfile) Validate() error {
+	if strings.TrimSpace(p.ID) == "" {
+		return fmt.Errorf("id is required")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	for field, value := range map[string]string{"command": p.Command, "cwd": p.Cwd, "preCommand": p.PreCommand} {
+		if err := checkTemplate(field, value); err != nil {
+			return err
+		}
+	}
+
+	if p.Shell != "" {
+		if _, err := exec.LookPath(p.Shell); err != nil {
+			return fmt.Errorf("shell %q not found", p.Shell)
+		}
+	}
+
+	if p.Cols != 0 && (p.Cols < 10 || p.Cols > 1000) {
+		return fmt.Errorf("cols must be between 10 and 1000")
+	}
+	if p.Rows != 0 && (p.Rows < 5 || p.Rows > 500) {
+		return fmt.Errorf("rows must be between 5 and 500")
+	}
+
+	for key, value := range p.Env {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("env: invalid variable name %q", key)
+		}
+		if reservedEnvKeys[key] {
+			return fmt.Errorf("env: %s is set by the terminal and can't be overridden", key)
+		}
+		if err := checkTemplate("env."+key, value); err != nil {
+			return err
+		}
+	}
+
+	if p.Notifications != nil {
+		if err := p.Notifications.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Backend != "" && p.Backend != BackendTmux && p.Backend != BackendPTY {
+		return fmt.Errorf("backend must be tmux or pty")
+	}
+
+	for key, value := range p.TmuxOptions {
+		if !tmuxOptionPattern.MatchString(key) {
+			return fmt.Errorf("tmuxOptions: invalid option name %q", key)
+		}
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("tmuxOptions: %s must be a single line", key)
+		}
+	}
+	return nil
+}
+
+// validateProfiles validates every profile and checks IDs are unique.
+func validateProfiles(profiles []TerminalProfile) error {
+	seen := make(map[string]bool, len(profiles))
+	for i := range profiles {
+		if err := profiles[i].Validate(); err != nil {
+			name := profiles[i].ID
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		if seen[profiles[i].ID] {
+			return fmt.Errorf("duplicate profile id %s", profiles[i].ID)
+		}
+		seen[profiles[i].ID] = true
+	}
+	return nil
+}
+
+// --- Templating ---
+
+// TemplateVars are the values substituted into profile placeholders.
+type TemplateVars struct {
+	Workspace string
+	File      string
+	GitRoot   string
+	Home      string
+}
+
+// NewTemplateVars fills in the derived values: home, and the git root of
+// the file (or of the workspace when there is no file).
+func NewTemplateVars(workspace, file string) TemplateVars {
+	home, _ := os.UserHomeDir()
+	vars := TemplateVars{Workspace: workspace, File: file, Home: home}
+	if file != "" {
+		vars.GitRoot = FindGitRoot(filepath.Dir(file))
+	}
+	if vars.GitRoot == "" && workspace != "" {
+		vars.GitRoot = FindGitRoot(workspace)
+	}
+	if vars.Workspace == "" {
+		vars.Workspace = home
+	}
+	return vars
+}
+
+// Expand replaces the placeholders in s. Unknown placeholders are left as is.
+func (v TemplateVars) Expand(s string) string {
+	return v.expand(s, func(value string) string { return value })
+}
+
+// ExpandShell is Expand for shell command lines: values are quoted, so a
+// file name cannot inject commands.
+func (v TemplateVars) ExpandShell(s string) string {
+	return v.expand(s, shellQuote)
+}
+
+func (v TemplateVars) expand(s string, quote func(string) string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return templatePattern.ReplaceAllStringFunc(s, func(m string) string {
+		switch templatePattern.FindStringSubmatch(m)[1] {
+		case "workspace":
+			return quote(v.Workspace)
+		case "file":
+			return quote(v.File)
+		case "gitRoot":
+			if v.GitRoot == "" {
+				return quote(v.Workspace)
+			}
+			return quote(v.GitRoot)
+		case "home":
+			return quote(v.Home)
+		}
+		return m
+	})
+}
+
+// SpawnOptions resolves the profile into spawn options for a session.
+func (p *TerminalProfile) SpawnOptions(id string, vars TemplateVars) SpawnOptions {
+	opts := SpawnOptions{
+		ID:          id,
+		Cwd:         vars.Expand(p.Cwd),
+		Cols:        p.Cols,
+		Rows:        p.Rows,
+		Command:     vars.ExpandShell(p.Command),
+		Shell:       p.Shell,
+		Login:       p.Login == nil || *p.Login,
+		PreCommand:  vars.ExpandShell(p.PreCommand),
+		TmuxOptions: p.TmuxOptions,
+		Backend:     p.Backend,
+
+		ShellIntegration: p.ShellIntegration != nil && *p.ShellIntegration,
+	}
+	if len(p.Env) > 0 {
+		opts.Env = make(map[string]string, len(p.Env))
+		for k, v := range p.Env {
+			opts.Env[k] = vars.Expand(v)
+		}
+	}
+	return opts
+}
+
+// --- HTTP Handlers ---
+
+// TerminalProfiles returns saved profiles
+func TerminalProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// SaveTerminalProfile validates and saves terminal profiles
+func SaveTerminalProfile(w http.ResponseWriter, r *http.Request) {
+	var profiles []TerminalProfile
+	if err := json.NewDecoder(r.Body).Decode(&profiles); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateProfiles(profiles); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := SaveProfiles(profiles); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creack/pty"
+)
+
+// --- Plain PTY backend ---
+//
+// Without tmux the shell runs directly on a PTY owned by this process. It
+// can't survive a backend restart, so a session with no subscribers is
+// kept for a longer grace period before its shell is ended, and recent
+// output is buffered in memory to replay to reconnecting clients. Screen
+// reads and key names are emulated from that buffer.
+
+const (
+	// ptyGracePeriod is how long a plain PTY session with no subscribers
+	// keeps running.
+	ptyGracePeriod = 5 * time.Minute
+	// ptyScrollbackBytes is how much output a plain PTY session keeps.
+	ptyScrollbackBytes = 1 << 20
+)
+
+// outputBuffer keeps a session's most recent output, up to limit bytes.
+type outputBuffer struct {
+	data      []byte
+	limit     int
+	lastWrite time.Time
+	mu        sync.Mutex
+}
+
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+// Write appends output. The buffer is compacted once it holds twice the
+// limit, so trimming is amortized across writes.
+func (b *outputBuffer) Write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	b.lastWrite = time.Now()
+	if len(b.data) > 2*b.limit {
+		b.data = append([]byte(nil), b.data[len(b.data)-b.limit:]...)
+	}
+}
+
+// Tail returns the last lines lines of output (everything kept if lines <=
+// 0). Once output has been dropped, it starts at a line boundary.
+func (b *outputBuffer) Tail(lines int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := b.data
+	if len(data) > b.limit {
+		data = data[len(data)-b.limit:]
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	if lines > 0 {
+		end := len(data)
+		if end > 0 && data[end-1] == '\n' {
+			end-- // a trailing newline doesn't start another line
+		}
+		for i, n := end-1, 0; i >= 0; i-- {
+			if data[i] == '\n' {
+				if n++; n == lines {
+					data = data[i+1:]
+					break
+				}
+			}
+		}
+	}
+	return append([]byte(nil), data...)
+}
+
+// LastWrite returns when output was last written.
+func (b *outputBuffer) LastWrite() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastWrite
+}
+
+// stripANSI turns raw terminal output into text: escape sequences are
+// dropped (SGR color sequences kept with keepSGR) and a carriage return
+// starts its line over, as it would on screen.
+func stripANSI(raw []byte, keepSGR bool) string {
+	var out strings.Builder
+	var line []byte
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == 0x1b && i+1 < len(raw):
+			switch raw[i+1] {
+			case '[': // CSI: parameters, then a final byte in 0x40-0x7e
+				j := i + 2
+				for j < len(raw) && (raw[j] < 0x40 || raw[j] > 0x7e) {
+					j++
+				}
+				if keepSGR && j < len(raw) && raw[j] == 'm' {
+					line = append(line, raw[i:j+1]...)
+				}
+				i = j
+			case ']', 'P', '_', '^': // OSC, DCS, APC, PM: up to BEL or ST
+				j := i + 2
+				for j < len(raw) && raw[j] != 0x07 && !(raw[j] == 0x1b && j+1 < len(raw) && raw[j+1] == '\\') {
+					j++
+				}
+				if j < len(raw) && raw[j] == 0x1b {
+					j++
+				}
+				i = j
+			case '(', ')', '#': // charset and line attribute selection
+				i += 2
+			default:
+				i++
+			}
+		case c == '\r':
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				continue
+			}
+			line = line[:0]
+		case c == '\n':
+			out.Write(line)
+			out.WriteByte('\n')
+			line = line[:0]
+		case c == '\b':
+			if _, size := utf8.DecodeLastRune(line); size > 0 {
+				line = line[:len(line)-size]
+			}
+		case c == '\t' || (c >= 0x20 && c != 0x7f):
+			line = append(line, c)
+		}
+	}
+	out.Write(line)
+	return out.String()
+}
+
+// ptyKeys maps tmux key names to the bytes a terminal sends for them.
+var ptyKeys = map[string]string{
+	"Enter": "\r", "Tab": "\t", "BTab": "\x1b[Z", "Escape": "\x1b", "Space": " ", "BSpace": "\x7f",
+	"Up": "\x1b[A", "Down": "\x1b[B", "Right": "\x1b[C", "Left": "\x1b[D",
+	"Home": "\x1b[H", "End": "\x1b[F", "IC": "\x1b[2~", "DC": "\x1b[3~",
+	"PageUp": "\x1b[5~", "PPage": "\x1b[5~", "PageDown": "\x1b[6~", "NPage": "\x1b[6~",
+	"F1": "\x1bOP", "F2": "\x1bOQ", "F3": "\x1bOR", "F4": "\x1bOS",
+	"F5": "\x1b[15~", "F6": "\x1b[17~", "F7": "\x1b[18~", "F8": "\x1b[19~",
+	"F9": "\x1b[20~", "F10": "\x1b[21~", "F11": "\x1b[23~", "F12": "\x1b[24~",
+}
+
+// ptyKeyBytes translates a tmux key name (Enter, C-c, M-f, ...) into input
+// bytes. Like tmux send-keys, a name that isn't a key is sent as text.
+func ptyKeyBytes(name string) []byte {
+	if seq, ok := ptyKeys[name]; ok {
+		return []byte(seq)
+	}
+	if rest, ok := strings.CutPrefix(name, "C-"); ok && len(rest) == 1 {
+		switch c := rest[0]; {
+		case c >= 'a' && c <= 'z':
+			return []byte{c - 'a' + 1}
+		case c >= 'A' && c <= 'Z':
+			return []byte{c - 'A' + 1}
+		case c == '@' || c == ' ':
+			return []byte{0}
+		case c >= '[' && c <= '_':
+			return []byte{c - '@'}
+		case c == '?':
+			return []byte{0x7f}
+		}
+	}
+	if rest, ok := strings.CutPrefix(name, "M-"); ok && rest != "" {
+		return append([]byte{0x1b}, ptyKeyBytes(rest)...)
+	}
+	return []byte(name)
+}
+
+// ptyBackend runs the shell directly on a PTY.
+type ptyBackend struct{}
+
+// Spawn starts the shell on a new PTY. Caller holds tm.mu.
+func (ptyBackend) Spawn(tm *TerminalManager, opts SpawnOptions, cwd string, cols, rows uint16) (*TerminalSession, error) {
+	env := buildPTYEnv(opts.ID, cols, rows)
+	for k, v := range opts.shellEnv() {
+		env = append(env, k+"="+v) // later entries win
+	}
+	if len(opts.TmuxOptions) > 0 {
+		log.Printf("[Terminal] Session %s: tmux options ignored on the pty backend", opts.ID)
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", "exec "+opts.shellCommand())
+	cmd.Dir = cwd
+	cmd.Env = env
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start PTY: %w", err)
+	}
+	limitTerminalProcess(cmd.Process.Pid)
+
+	session := &TerminalSession{
+		ID:         opts.ID,
+		Backend:    BackendPTY,
+		Cwd:        cwd,
+		Cols:       cols,
+		Rows:       rows,
+		CreatedAt:  time.Now(),
+		ptmx:       ptmx,
+		cmd:        cmd,
+		scrollback: newOutputBuffer(ptyScrollbackBytes),
+		clients:    make(map[interface{}]*terminalSubscriber),
+		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	tm.sessions[opts.ID] = session
+
+	go tm.readPTY(session)
+	go tm.waitPTY(session)
+	return session, nil
+}
+
+// waitPTY cleans up after a plain PTY session whose shell exited on its own.
+func (tm *TerminalManager) waitPTY(session *TerminalSession) {
+	session.cmd.Wait()
+	close(session.exited)
+
+	id := session.ID
+	tm.mu.RLock()
+	current, ok := tm.sessions[id]
+	tm.mu.RUnlock()
+	if !ok || current != session {
+		return // closed through CloseSession
+	}
+
+	log.Printf("[Terminal] Session %s shell exited", id)
+	// Notify while the subscribers are still registered
+	if tm.closedFunc != nil {
+		tm.closedFunc(id)
+	}
+
+	tm.mu.Lock()
+	if current, ok := tm.sessions[id]; ok && current == session {
+		delete(tm.sessions, id)
+	}
+	if timer, exists := tm.disconnectTimers[id]; exists {
+		timer.Stop()
+		delete(tm.disconnectTimers, id)
+	}
+	tm.mu.Unlock()
+
+	session.ptmx.Close()
+	tm.StopRecording(id)
+	tm.forgetShell(id)
+	tm.forgetActivity(id)
+	tm.forgetGroupMember(id)
+}
+
+func (ptyBackend) Persistent() bool { return false }
+
+func (ptyBackend) GracePeriod() time.Duration { return ptyGracePeriod }
+
+// Kill hangs up the shell's process group (the shell leads its own
+// session), then kills it if it hasn't exited after two seconds.
+func (ptyBackend) Kill(session *TerminalSession) {
+	if session.cmd == nil || session.cmd.Process == nil {
+		return
+	}
+	pgid := session.cmd.Process.Pid
+	syscall.Kill(-pgid, syscall.SIGHUP)
+	select {
+	case <-session.exited:
+	case <-time.After(2 * time.Second):
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
+
+// Replay returns the buffered output as written, which restores colors
+// and the screen contents as well as the history.
+func (ptyBackend) Replay(session *TerminalSession, lines int) ([]byte, int, error) {
+	data := session.scrollback.Tail(lines)
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	return data, bytes.Count(data, []byte("\n")) + 1, nil
+}
+
+func (ptyBackend) Scrollback(session *TerminalSession, lines int, ansi bool) (string, error) {
+	return strings.TrimRight(stripANSI(session.scrollback.Tail(lines), ansi), "\n"), nil
+}
+
+// Screen approximates the screen with the last rows of output; the cursor
+// is taken to be at the end of it.
+func (ptyBackend) Screen(session *TerminalSession, history int, ansi bool) (*Screen, error) {
+	session.mu.Lock()
+	cols, rows := int(session.Cols), int(session.Rows)
+	session.mu.Unlock()
+
+	lines := strings.Split(stripANSI(session.scrollback.Tail(rows+history), ansi), "\n")
+	last := lines[len(lines)-1]
+	return &Screen{
+		TerminalID: session.ID,
+		Lines:      lines,
+		Cols:       cols,
+		Rows:       rows,
+		CursorX:    utf8.RuneCountInString(last),
+		CursorY:    len(lines) - 1,
+	}, nil
+}
+
+func (ptyBackend) SendKeys(session *TerminalSession, keys []string) error {
+	var input []byte
+	for _, key := range keys {
+		input = append(input, ptyKeyBytes(key)...)
+	}
+	_, err := session.ptmx.Write(input)
+	return err
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// ---- Plain PTY backend tests ----
+
+func TestStripANSI_OverwritesAndColors(t *testing.T) {
+	raw := []byte("\x1b]133;A\x07$ \x1b[1;32mok\x1b[0m\r\n10%\r50%\r100%\nab\bc\x1b(B")
+	if got, want := stripANSI(raw, false), "$ ok\n100%\nac"; got != want {
+		t.Errorf("stripANSI = %q, want %q", got, want)
+	}
+	if got, want := stripANSI(raw, true), "$ \x1b[1;32mok\x1b[0m\n100%\nac"; got != want {
+		t.Errorf("stripANSI with SGR = %q, want %q", got, want)
+	}
+}
+
+func TestPTYKeyBytes(t *testing.T) {
+	cases := map[string]string{
+		"Enter": "\r",
+		"C-c":   "\x03",
+		"C-[":   "\x1b",
+		"M-f":   "\x1bf",
+		"M-Up":  "\x1b\x1b[A",
+		"F5":    "\x1b[15~",
+		"ls":    "ls", // not a key: sent as text, like tmux
+	}
+	for name, want := range cases {
+		if got := string(ptyKeyBytes(name)); got != want {
+			t.Errorf("ptyKeyBytes(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestOutputBuffer_TailAndTrim(t *testing.T) {
+	b := newOutputBuffer(16)
+	b.Write([]byte("one\ntwo\nthree\n"))
+	if got := string(b.Tail(2)); got != "two\nthree\n" {
+		t.Errorf("Tail(2) = %q", got)
+	}
+	b.Write([]byte("four\nfive\nsix\n"))
+	// Only the last 16 bytes are kept, from the first whole line
+	if got := string(b.Tail(0)); got != "four\nfive\nsix\n" {
+		t.Errorf("Tail(0) after trim = %q", got)
+	}
+	if b.LastWrite().IsZero() {
+		t.Error("expected the last write time to be set")
+	}
+}
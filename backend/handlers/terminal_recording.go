@@ -0,0 +1,672 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/utils"
+)
+
+// --- Recording (asciicast v2) ---
+
+// RecordingInfo describes an asciicast recording on disk.
+type RecordingInfo struct {
+	Name       string  `json:"name"` // file name without .cast
+	TerminalID string  `json:"terminalId"`
+	Title      string  `json:"title,omitempty"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	StartedAt  int64   `json:"startedAt"` // Unix ms
+	Duration   float64 `json:"duration"`  // seconds
+	Size       int64   `json:"size"`
+	Active     bool    `json:"active"`
+}
+
+// asciicastHeader is the first line of an asciicast v2 file.
+type asciicastHeader struct {
+	Version    int               `json:"version"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Timestamp  int64             `json:"timestamp"`
+	Title      string            `json:"title,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	TerminalID string            `json:"mt_terminal_id,omitempty"`
+}
+
+// recorder tees one session's output into an asciicast file.
+type recorder struct {
+	name  string
+	file  *os.File
+	start time.Time
+	info  RecordingInfo
+
+	// Trailing bytes of an incomplete UTF-8 sequence from the last read,
+	// carried over so events never split a character.
+	pending []byte
+	mu      sync.Mutex
+}
+
+func recordingsDir() string {
+	return filepath.Join(utils.DataDir(), "recordings")
+}
+
+// recordingPath returns the file for a recording name, rejecting names that
+// could escape the recordings directory.
+func recordingPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid recording name: %s", name)
+	}
+	return filepath.Join(recordingsDir(), name+".cast"), nil
+}
+
+// writeEvent appends one [time, code, data] event line.
+func (r *recorder) writeEvent(code, data string) {
+	line, err := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6, code, data,
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if n, err := r.file.Write(line); err != nil {
+		log.Printf("[Terminal] Recording %s write error: %v", r.name, err)
+	} else {
+		r.info.Size += int64(n)
+	}
+}
+
+// StartRecording begins recording a session's output to a new asciicast file.
+// The current screen is captured as the first frame so playback doesn't
+// start blank mid-session.
+func (tm *TerminalManager) StartRecording(sessionID, title string) (*RecordingInfo, error) {
+	tm.mu.RLock()
+	session, ok := tm.sessions[sessionID]
+	tm.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	tm.recMu.Lock()
+	defer tm.recMu.Unlock()
+	if tm.recorders == nil {
+		tm.recorders = make(map[string]*recorder)
+	}
+	if _, exists := tm.recorders[sessionID]; exists {
+		return nil, fmt.Errorf("session %s is already being recorded", sessionID)
+	}
+
+	if err := os.MkdirAll(recordingsDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+
+	now := time.Now()
+	stamp := fmt.Sprintf("%s-%s", sessionID, now.Format("20060102-150405"))
+	var name, path string
+	var file *os.File
+	// Recordings started within the same second get a counter suffix
+	for n := 1; ; n++ {
+		name = stamp
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d", stamp, n)
+		}
+		var err error
+		if path, err = recordingPath(name); err != nil {
+			return nil, err
+		}
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || n >= 100 {
+			return nil, fmt.Errorf("failed to create recording: %w", err)
+		}
+	}
+
+	session.mu.Lock()
+	cols, rows := int(session.Cols), int(session.Rows)
+	session.mu.Unlock()
+	if title == "" {
+		title = sessionID
+	}
+
+	header, _ := json.Marshal(asciicastHeader{
+		Version:    2,
+		Width:      cols,
+		Height:     rows,
+		Timestamp:  now.Unix(),
+		Title:      title,
+		Env:        map[string]string{"TERM": "xterm-256color", "SHELL": getShell()},
+		TerminalID: sessionID,
+	})
+	if _, err := file.Write(append(header, '\n')); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write recording header: %w", err)
+	}
+
+	rec := &recorder{
+		name:  name,
+		file:  file,
+		start: now,
+		info: RecordingInfo{
+			Name:       name,
+			TerminalID: sessionID,
+			Title:      title,
+			Width:      cols,
+			Height:     rows,
+			StartedAt:  now.UnixMilli(),
+			Size:       int64(len(header) + 1),
+			Active:     true,
+		},
+	}
+
+	if screen, err := session.backend().Screen(session, 0, true); err == nil {
+		rec.writeEvent("o", "\x1b[H\x1b[2J"+strings.Join(screen.Lines, "\r\n"))
+	}
+
+	tm.recorders[sessionID] = rec
+	log.Printf("[Terminal] Recording %s started for session %s", name, sessionID)
+
+	info := rec.info
+	return &info, nil
+}
+
+// StopRecording finishes a session's recording and closes the file.
+func (tm *TerminalManager) StopRecording(sessionID string) (*RecordingInfo, error) {
+	tm.recMu.Lock()
+	rec, ok := tm.recorders[sessionID]
+	delete(tm.recorders, sessionID)
+	tm.recMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("session %s is not being recorded", sessionID)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.pending) > 0 {
+		rec.writeEvent("o", string(rec.pending))
+		rec.pending = nil
+	}
+	rec.file.Close()
+	rec.info.Active = false
+	rec.info.Duration = time.Since(rec.start).Seconds()
+
+	log.Printf("[Terminal] Recording %s stopped (%.1fs, %d bytes)", rec.name, rec.info.Duration, rec.info.Size)
+	info := rec.info
+	return &info, nil
+}
+
+// recordOutput appends PTY output to the session's recording, if any.
+func (tm *TerminalManager) recordOutput(sessionID string, data []byte) {
+	tm.recMu.Lock()
+	rec, ok := tm.recorders[sessionID]
+	tm.recMu.Unlock()
+	if !ok {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	buf := append(rec.pending, data...)
+	cut := utf8CompletePrefix(buf)
+	rec.pending = append([]byte(nil), buf[cut:]...)
+	if cut > 0 {
+		rec.writeEvent("o", string(buf[:cut]))
+	}
+}
+
+// recordResize appends a resize event to the session's recording, if any.
+func (tm *TerminalManager) recordResize(sessionID string, cols, rows uint16) {
+	tm.recMu.Lock()
+	rec, ok := tm.recorders[sessionID]
+	tm.recMu.Unlock()
+	if !ok {
+		return
+	}
+
+	rec.mu.Lock()
+	rec.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+	rec.mu.Unlock()
+}
+
+// utf8CompletePrefix returns the length of buf up to (not including) a
+// trailing incomplete UTF-8 sequence. Invalid bytes are not held back.
+func utf8CompletePrefix(buf []byte) int {
+	// A UTF-8 sequence is at most 4 bytes, so only the tail needs checking
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(buf[i]) {
+			continue
+		}
+		if !utf8.FullRune(buf[i:]) {
+			return i
+		}
+		break
+	}
+	return len(buf)
+}
+
+// ListRecordings returns all recordings on disk, newest first.
+func (tm *TerminalManager) ListRecordings() ([]RecordingInfo, error) {
+	entries, err := os.ReadDir(recordingsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RecordingInfo{}, nil
+		}
+		return nil, err
+	}
+
+	tm.recMu.Lock()
+	active := make(map[string]RecordingInfo, len(tm.recorders))
+	for _, rec := range tm.recorders {
+		rec.mu.Lock()
+		info := rec.info
+		info.Duration = time.Since(rec.start).Seconds()
+		rec.mu.Unlock()
+		active[rec.name] = info
+	}
+	tm.recMu.Unlock()
+
+	result := make([]RecordingInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".cast") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".cast")
+		if info, ok := active[name]; ok {
+			result = append(result, info)
+			continue
+		}
+		info, err := readRecordingInfo(filepath.Join(recordingsDir(), entry.Name()))
+		if err != nil {
+			log.Printf("[Terminal] Skipping unreadable recording %s: %v", entry.Name(), err)
+			continue
+		}
+		info.Name = name
+		result = append(result, *info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt > result[j].StartedAt
+	})
+	return result, nil
+}
+
+// readRecordingInfo reads the header and the last event time of a finished
+// recording.
+func readRecordingInfo(path string) (*RecordingInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	headerLine, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var header asciicastHeader
+	if err := json.Unmarshal(headerLine, &header); err != nil || header.Version != 2 {
+		return nil, fmt.Errorf("not an asciicast v2 file")
+	}
+
+	info := &RecordingInfo{
+		TerminalID: header.TerminalID,
+		Title:      header.Title,
+		Width:      header.Width,
+		Height:     header.Height,
+		StartedAt:  header.Timestamp * 1000,
+		Size:       stat.Size(),
+	}
+
+	// Duration is the timestamp of the last event; read just the tail
+	tailSize := int64(64 * 1024)
+	if tailSize > stat.Size() {
+		tailSize = stat.Size()
+	}
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, stat.Size()-tailSize); err == nil || err == io.EOF {
+		lines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+		var event []json.RawMessage
+		if json.Unmarshal([]byte(lines[len(lines)-1]), &event) == nil && len(event) == 3 {
+			json.Unmarshal(event[0], &info.Duration)
+		}
+	}
+
+	return info, nil
+}
+
+// --- Playback ---
+
+// playback streams a recording to one client in real time.
+type playback struct {
+	id      string
+	client  interface{}
+	send    func(interface{})
+	speed   float64
+	maxIdle time.Duration
+	paused  bool
+	stopped bool
+	wake    chan struct{} // signalled on any control change
+	mu      sync.Mutex
+}
+
+// emit sends a message unless the playback has been stopped. Holding mu
+// while sending guarantees nothing is sent after stop() returns (the
+// client's channel may be closed right after).
+func (p *playback) emit(msg map[string]interface{}) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	msg["playbackId"] = p.id
+	p.send(msg)
+	return true
+}
+
+func (p *playback) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *playback) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+// wait sleeps for d of recording time, honouring speed changes and pauses.
+// Returns false if the playback was stopped.
+func (p *playback) wait(d time.Duration) bool {
+	for {
+		p.mu.Lock()
+		speed, paused, stopped := p.speed, p.paused, p.stopped
+		p.mu.Unlock()
+		if stopped {
+			return false
+		}
+		if paused {
+			<-p.wake
+			continue
+		}
+		if d <= 0 {
+			return true
+		}
+
+		started := time.Now()
+		timer := time.NewTimer(time.Duration(float64(d) / speed))
+		select {
+		case <-timer.C:
+			d = 0
+		case <-p.wake:
+			timer.Stop()
+			d -= time.Duration(float64(time.Since(started)) * speed)
+		}
+	}
+}
+
+// clampSpeed bounds playback speed to a sane range (default 1x).
+func clampSpeed(speed float64) float64 {
+	if speed <= 0 {
+		return 1
+	}
+	if speed < 0.1 {
+		return 0.1
+	}
+	if speed > 32 {
+		return 32
+	}
+	return speed
+}
+
+// StartPlayback streams a recording to a client as terminal-playback-*
+// messages: one -start with the terminal size, -output and -resize events
+// paced by the recording's timestamps (scaled by speed, pauses capped at
+// maxIdle seconds), then -end.
+func (tm *TerminalManager) StartPlayback(playbackID, name string, speed, maxIdle float64, clientSend func(interface{}), client interface{}) error {
+	path, err := recordingPath(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("recording %s not found", name)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var header asciicastHeader
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &header) != nil || header.Version != 2 {
+		f.Close()
+		return fmt.Errorf("recording %s is not an asciicast v2 file", name)
+	}
+
+	if playbackID == "" {
+		playbackID = fmt.Sprintf("pb-%d", time.Now().UnixNano())
+	}
+	p := &playback{
+		id:     playbackID,
+		client: client,
+		send:   clientSend,
+		speed:  clampSpeed(speed),
+		wake:   make(chan struct{}, 1),
+	}
+	if maxIdle > 0 {
+		p.maxIdle = time.Duration(maxIdle * float64(time.Second))
+	}
+
+	tm.recMu.Lock()
+	if tm.playbacks == nil {
+		tm.playbacks = make(map[string]*playback)
+	}
+	if old, exists := tm.playbacks[playbackID]; exists {
+		old.stop()
+	}
+	tm.playbacks[playbackID] = p
+	tm.recMu.Unlock()
+
+	go func() {
+		defer f.Close()
+		defer func() {
+			tm.recMu.Lock()
+			if tm.playbacks[playbackID] == p {
+				delete(tm.playbacks, playbackID)
+			}
+			tm.recMu.Unlock()
+		}()
+
+		if !p.emit(map[string]interface{}{
+			"type":      "terminal-playback-start",
+			"recording": name,
+			"title":     header.Title,
+			"cols":      header.Width,
+			"rows":      header.Height,
+			"speed":     p.speed,
+		}) {
+			return
+		}
+
+		var last float64
+		for scanner.Scan() {
+			var event []json.RawMessage
+			if json.Unmarshal(scanner.Bytes(), &event) != nil || len(event) != 3 {
+				continue
+			}
+			var at float64
+			var code, data string
+			json.Unmarshal(event[0], &at)
+			json.Unmarshal(event[1], &code)
+			json.Unmarshal(event[2], &data)
+
+			delay := time.Duration((at - last) * float64(time.Second))
+			if p.maxIdle > 0 && delay > p.maxIdle {
+				delay = p.maxIdle
+			}
+			last = at
+			if !p.wait(delay) {
+				return
+			}
+
+			msg := map[string]interface{}{"time": at}
+			switch code {
+			case "o":
+				msg["type"] = "terminal-playback-output"
+				msg["data"] = base64.StdEncoding.EncodeToString([]byte(data))
+			case "r":
+				var cols, rows int
+				if _, err := fmt.Sscanf(data, "%dx%d", &cols, &rows); err != nil {
+					continue
+				}
+				msg["type"] = "terminal-playback-resize"
+				msg["cols"] = cols
+				msg["rows"] = rows
+			default:
+				continue
+			}
+			if !p.emit(msg) {
+				return
+			}
+		}
+
+		p.emit(map[string]interface{}{
+			"type":     "terminal-playback-end",
+			"duration": last,
+		})
+	}()
+
+	log.Printf("[Terminal] Playback %s of %s started at %.1fx", playbackID, name, p.speed)
+	return nil
+}
+
+// ControlPlayback changes the speed of, pauses, resumes or stops a playback.
+func (tm *TerminalManager) ControlPlayback(playbackID, action string, speed float64) error {
+	tm.recMu.Lock()
+	p, ok := tm.playbacks[playbackID]
+	tm.recMu.Unlock()
+	if !ok {
+		return fmt.Errorf("playback %s not found", playbackID)
+	}
+
+	switch action {
+	case "stop":
+		p.stop()
+		return nil
+	case "speed":
+		p.mu.Lock()
+		p.speed = clampSpeed(speed)
+		p.mu.Unlock()
+	case "pause":
+		p.mu.Lock()
+		p.paused = true
+		p.mu.Unlock()
+	case "resume":
+		p.mu.Lock()
+		p.paused = false
+		p.mu.Unlock()
+	default:
+		return fmt.Errorf("unknown playback action: %s", action)
+	}
+	p.signal()
+	return nil
+}
+
+// stopClientPlaybacks stops every playback streaming to client. Called when
+// the client disconnects, before its send channel is closed.
+func (tm *TerminalManager) stopClientPlaybacks(client interface{}) {
+	tm.recMu.Lock()
+	var stopping []*playback
+	for id, p := range tm.playbacks {
+		if p.client == client {
+			stopping = append(stopping, p)
+			delete(tm.playbacks, id)
+		}
+	}
+	tm.recMu.Unlock()
+
+	for _, p := range stopping {
+		p.stop()
+	}
+}
+
+// --- HTTP Handlers ---
+
+// TerminalRecordingStart handles POST /api/terminal/{id}/recording
+func TerminalRecordingStart(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"title,omitempty"`
+	}
+	// Body is optional
+	json.NewDecoder(r.Body).Decode(&req)
+
+	info, err := GetTerminalManager().StartRecording(chi.URLParam(r, "id"), req.Title)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// TerminalRecordingStop handles DELETE /api/terminal/{id}/recording
+func TerminalRecordingStop(w http.ResponseWriter, r *http.Request) {
+	info, err := GetTerminalManager().StopRecording(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+// TerminalRecordings handles GET /api/terminal/recordings
+func TerminalRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings, err := GetTerminalManager().ListRecordings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recordings": recordings,
+		"count":      len(recordings),
+	})
+}
+
+// TerminalRecordingDownload handles GET /api/terminal/recordings/{name} -
+// the raw .cast file (playable with asciinema).
+func TerminalRecordingDownload(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	path, err := recordingPath(name)
+	if err != nil {
+		http.Error(w, `{"error": "invalid recording name"}`, http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, `{"error": "recording not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.cast"`, name))
+	http.ServeFile(w, r, path)
+}
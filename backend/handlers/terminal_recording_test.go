@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// ---- Recording tests ----
+
+func TestUTF8CompletePrefix_HoldsBackSplitRune(t *testing.T) {
+	euro := []byte("€") // 3 bytes
+	cases := []struct {
+		buf  []byte
+		want int
+	}{
+		{[]byte("abc"), 3},
+		{append([]byte("ab"), euro...), 5},
+		{append([]byte("ab"), euro[:2]...), 2},
+		{append([]byte("ab"), euro[:1]...), 2},
+		{[]byte{'a', 0xff}, 2}, // invalid byte is passed through
+	}
+	for _, c := range cases {
+		if got := utf8CompletePrefix(c.buf); got != c.want {
+			t.Errorf("utf8CompletePrefix(%q) = %d, want %d", c.buf, got, c.want)
+		}
+	}
+}
+
+func TestStartRecording_SameSecondGetsUniqueNames(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tm := newTestManager()
+	tm.sessions["mt-rec-test"] = &TerminalSession{ID: "mt-rec-test", Cols: 80, Rows: 24}
+
+	names := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		info, err := tm.StartRecording("mt-rec-test", "")
+		if err != nil {
+			t.Fatalf("recording %d: %v", i, err)
+		}
+		if _, err := tm.StopRecording("mt-rec-test"); err != nil {
+			t.Fatal(err)
+		}
+		names[info.Name] = true
+	}
+	if len(names) != 3 {
+		t.Errorf("expected 3 distinct recordings, got %v", names)
+	}
+}
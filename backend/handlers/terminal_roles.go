@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Subscriber roles ---
+//
+// Every client subscribed to a session has a role. The owner and writers
+// may send input; viewers only watch. The first client to attach owns the
+// session; later clients join as viewers until the owner makes them
+// writers. When the owner leaves, the longest-attached writer takes over;
+// with no writer left the session is unowned until a client attaches or
+// takes control. Ownership only moves away from a present owner through
+// handoff (possibly after terminal-request-control).
+
+// Subscriber roles
+const (
+	RoleOwner  = "owner"
+	RoleWriter = "writer"
+	RoleViewer = "viewer"
+)
+
+// ErrReadOnly is returned when a viewer tries to write to a session.
+var ErrReadOnly = errors.New("read-only: viewers can't send input")
+
+// TerminalClient is implemented by WebSocket clients so sessions can list
+// who is attached. Clients that don't implement it are still subscribed,
+// just anonymously.
+type TerminalClient interface {
+	ClientID() string
+	ClientName() string
+}
+
+// terminalSubscriber is one client's subscription to a session.
+type terminalSubscriber struct {
+	role     string
+	joinedAt time.Time
+	seq      uint64 // join order
+}
+
+// SubscriberInfo describes an attached client.
+type SubscriberInfo struct {
+	ClientID string    `json:"clientId"`
+	Name     string    `json:"name,omitempty"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+func clientIdentity(client interface{}) (id, name string) {
+	if c, ok := client.(TerminalClient); ok {
+		return c.ClientID(), c.ClientName()
+	}
+	return fmt.Sprintf("%p", client), ""
+}
+
+func canWrite(role string) bool {
+	return role == RoleOwner || role == RoleWriter
+}
+
+// The methods below must be called with s.mu held.
+
+// addSubscriber subscribes client (keeping its role if it already is) and
+// returns its role. The client owns the session if nobody does, unless
+// requested is RoleViewer; otherwise it joins as a viewer. Only the owner
+// grants write access (setRoleLocked, handoffLocked).
+func (s *TerminalSession) addSubscriber(client interface{}, requested string) string {
+	if sub, ok := s.clients[client]; ok {
+		return sub.role
+	}
+	role := RoleViewer
+	if requested != RoleViewer && s.ownerLocked() == nil {
+		role = RoleOwner
+	}
+	s.subSeq++
+	s.clients[client] = &terminalSubscriber{role: role, joinedAt: time.Now(), seq: s.subSeq}
+	return role
+}
+
+// removeSubscriber unsubscribes client, passing ownership to the
+// longest-attached writer if it was the owner (viewers are never promoted).
+// It returns how many clients remain.
+func (s *TerminalSession) removeSubscriber(client interface{}) int {
+	sub, ok := s.clients[client]
+	if !ok {
+		return len(s.clients)
+	}
+	delete(s.clients, client)
+	if sub.role == RoleOwner {
+		if next := s.longestAttachedWriterLocked(); next != nil {
+			next.role = RoleOwner
+		}
+	}
+	return len(s.clients)
+}
+
+func (s *TerminalSession) ownerLocked() interface{} {
+	for c, sub := range s.clients {
+		if sub.role == RoleOwner {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *TerminalSession) longestAttachedWriterLocked() *terminalSubscriber {
+	var first *terminalSubscriber
+	for _, sub := range s.clients {
+		if sub.role == RoleWriter && (first == nil || sub.seq < first.seq) {
+			first = sub
+		}
+	}
+	return first
+}
+
+func (s *TerminalSession) findSubscriberLocked(clientID string) (interface{}, *terminalSubscriber) {
+	for c, sub := range s.clients {
+		if id, _ := clientIdentity(c); id == clientID {
+			return c, sub
+		}
+	}
+	return nil, nil
+}
+
+// takeControlLocked makes client the owner of a session nobody owns. While
+// there is an owner, control moves only through handoff.
+func (s *TerminalSession) takeControlLocked(client interface{}) error {
+	sub, ok := s.clients[client]
+	if !ok {
+		return fmt.Errorf("not subscribed to %s", s.ID)
+	}
+	if sub.role == RoleOwner {
+		return nil
+	}
+	if s.ownerLocked() != nil {
+		return fmt.Errorf("the session has an owner: request control instead")
+	}
+	sub.role = RoleOwner
+	return nil
+}
+
+// handoffLocked passes ownership from the owner to another subscriber; the
+// previous owner becomes a viewer.
+func (s *TerminalSession) handoffLocked(from interface{}, toClientID string) error {
+	sub, ok := s.clients[from]
+	if !ok || sub.role != RoleOwner {
+		return fmt.Errorf("only the owner can hand off control")
+	}
+	_, target := s.findSubscriberLocked(toClientID)
+	if target == nil {
+		return fmt.Errorf("client %s is not attached to %s", toClientID, s.ID)
+	}
+	if target == sub {
+		return nil
+	}
+	sub.role = RoleViewer
+	target.role = RoleOwner
+	return nil
+}
+
+// setRoleLocked lets the owner make another subscriber a writer or viewer.
+func (s *TerminalSession) setRoleLocked(by interface{}, clientID, role string) error {
+	if role != RoleWriter && role != RoleViewer {
+		return fmt.Errorf("role must be writer or viewer (use handoff to transfer ownership)")
+	}
+	sub, ok := s.clients[by]
+	if !ok || sub.role != RoleOwner {
+		return fmt.Errorf("only the owner can change roles")
+	}
+	_, target := s.findSubscriberLocked(clientID)
+	if target == nil {
+		return fmt.Errorf("client %s is not attached to %s", clientID, s.ID)
+	}
+	if target == sub {
+		return fmt.Errorf("the owner's role can only change through handoff")
+	}
+	target.role = role
+	return nil
+}
+
+// subscribersLocked lists the subscribers in join order.
+func (s *TerminalSession) subscribersLocked() []SubscriberInfo {
+	type entry struct {
+		info SubscriberInfo
+		seq  uint64
+	}
+	entries := make([]entry, 0, len(s.clients))
+	for c, sub := range s.clients {
+		id, name := clientIdentity(c)
+		entries = append(entries, entry{SubscriberInfo{ClientID: id, Name: name, Role: sub.role, JoinedAt: sub.joinedAt}, sub.seq})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	result := make([]SubscriberInfo, len(entries))
+	for i, e := range entries {
+		result[i] = e.info
+	}
+	return result
+}
+
+// --- Manager API ---
+
+// Subscribers returns the clients attached to a session, in join order.
+func (tm *TerminalManager) Subscribers(sessionID string) ([]SubscriberInfo, error) {
+	tm.mu.RLock()
+	session, ok := tm.sessions[sessionID]
+	tm.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.subscribersLocked(), nil
+}
+
+// checkWriter returns an error unless client is subscribed to the session
+// with a role that can write. A nil client is the server itself.
+func (s *TerminalSession) checkWriter(client interface{}) error {
+	if client == nil {
+		return nil
+	}
+	s.mu.Lock()
+	sub, subscribed := s.clients[client]
+	s.mu.Unlock()
+	if !subscribed {
+		return fmt.Errorf("not subscribed to session %s", s.ID)
+	}
+	if !canWrite(sub.role) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// ClientRole returns a client's role in a session ("" if not subscribed).
+func (tm *TerminalManager) ClientRole(sessionID string, client interface{}) string {
+	tm.mu.RLock()
+	session, ok := tm.sessions[sessionID]
+	tm.mu.RUnlock()
+	if !ok {
+		return ""
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if sub, ok := session.clients[client]; ok {
+		return sub.role
+	}
+	return ""
+}
+
+// changeRoles applies fn to a session under its lock and, if it succeeds,
+// tells the session's clients about the new subscriber list.
+func (tm *TerminalManager) changeRoles(sessionID string, fn func(s *TerminalSession) error) error {
+	tm.mu.RLock()
+	session, ok := tm.sessions[sessionID]
+	tm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	session.mu.Lock()
+	err := fn(session)
+	session.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tm.notifySubscribers(sessionID)
+	return nil
+}
+
+// notifySubscribers sends the session's subscriber list to its clients.
+func (tm *TerminalManager) notifySubscribers(sessionID string) {
+	subs, err := tm.Subscribers(sessionID)
+	if err != nil {
+		return
+	}
+	tm.sendSessionEvent(sessionID, map[string]interface{}{
+		"type":        "terminal-subscribers",
+		"terminalId":  sessionID,
+		"subscribers": subs,
+	})
+}
+
+// handleTerminalRoleMessage handles terminal-take-control,
+// terminal-request-control, terminal-handoff, terminal-set-role and
+// terminal-subscribers.
+func handleTerminalRoleMessage(msgType string, raw json.RawMessage, clientSend func(interface{}), client interface{}) {
+	tm := GetTerminalManager()
+
+	var msg struct {
+		TerminalID string `json:"terminalId"`
+		ClientID   string `json:"clientId"`
+		Role       string `json:"role"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Terminal] Failed to parse message: %v", err)
+		return
+	}
+
+	var err error
+	switch msgType {
+	case "terminal-take-control":
+		err = tm.changeRoles(msg.TerminalID, func(s *TerminalSession) error {
+			return s.takeControlLocked(client)
+		})
+	case "terminal-handoff":
+		err = tm.changeRoles(msg.TerminalID, func(s *TerminalSession) error {
+			return s.handoffLocked(client, msg.ClientID)
+		})
+	case "terminal-set-role":
+		err = tm.changeRoles(msg.TerminalID, func(s *TerminalSession) error {
+			return s.setRoleLocked(client, msg.ClientID, msg.Role)
+		})
+	case "terminal-request-control":
+		// The owner's window decides whether to hand off
+		if tm.ClientRole(msg.TerminalID, client) == "" {
+			err = fmt.Errorf("not subscribed to %s", msg.TerminalID)
+			break
+		}
+		id, name := clientIdentity(client)
+		tm.sendSessionEvent(msg.TerminalID, map[string]interface{}{
+			"type":       "terminal-control-requested",
+			"terminalId": msg.TerminalID,
+			"clientId":   id,
+			"name":       name,
+		})
+	case "terminal-subscribers":
+		var subs []SubscriberInfo
+		if subs, err = tm.Subscribers(msg.TerminalID); err == nil {
+			clientSend(map[string]interface{}{
+				"type":        "terminal-subscribers",
+				"terminalId":  msg.TerminalID,
+				"subscribers": subs,
+			})
+		}
+	}
+
+	if err != nil {
+		clientSend(map[string]interface{}{
+			"type":       "terminal-error",
+			"terminalId": msg.TerminalID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// TerminalSubscribers handles GET /api/terminal/{id}/subscribers
+func TerminalSubscribers(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	subs, err := GetTerminalManager().Subscribers(id)
+	if err != nil {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"terminalId":  id,
+		"subscribers": subs,
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// ---- Subscriber role tests ----
+
+type fakeTerminalClient struct{ id string }
+
+func (c *fakeTerminalClient) ClientID() string   { return c.id }
+func (c *fakeTerminalClient) ClientName() string { return "" }
+
+func newRoleTestSession() *TerminalSession {
+	return &TerminalSession{ID: "mt-roles", clients: make(map[interface{}]*terminalSubscriber)}
+}
+
+func TestSubscriberRoles_JoinAndOwnerLeaves(t *testing.T) {
+	s := newRoleTestSession()
+	a, b, c := &fakeTerminalClient{"a"}, &fakeTerminalClient{"b"}, &fakeTerminalClient{"c"}
+
+	if role := s.addSubscriber(a, ""); role != RoleOwner {
+		t.Errorf("first client should own the session, got %s", role)
+	}
+	if role := s.addSubscriber(b, ""); role != RoleViewer {
+		t.Errorf("later clients should join as viewers, got %s", role)
+	}
+	if role := s.addSubscriber(c, RoleWriter); role != RoleViewer {
+		t.Errorf("only the owner grants the writer role, got %s", role)
+	}
+	if err := s.setRoleLocked(a, "c", RoleWriter); err != nil {
+		t.Fatal(err)
+	}
+	if role := s.addSubscriber(b, RoleWriter); role != RoleViewer {
+		t.Errorf("re-adding should keep the existing role, got %s", role)
+	}
+
+	// The longest-attached writer inherits ownership, not an earlier viewer
+	if remaining := s.removeSubscriber(a); remaining != 2 {
+		t.Errorf("expected 2 remaining, got %d", remaining)
+	}
+	if s.clients[b].role != RoleViewer || s.clients[c].role != RoleOwner {
+		t.Errorf("unexpected roles after owner left: b=%s c=%s", s.clients[b].role, s.clients[c].role)
+	}
+
+	// With only viewers left the session has no owner until the next
+	// client attaches
+	s.removeSubscriber(c)
+	if s.clients[b].role != RoleViewer || s.ownerLocked() != nil {
+		t.Errorf("a viewer was promoted: b=%s", s.clients[b].role)
+	}
+	d := &fakeTerminalClient{"d"}
+	if role := s.addSubscriber(d, ""); role != RoleOwner {
+		t.Errorf("next client should own the unowned session, got %s", role)
+	}
+	s.removeSubscriber(d)
+	if err := s.takeControlLocked(b); err != nil || s.clients[b].role != RoleOwner {
+		t.Errorf("a viewer should be able to take control of an unowned session: %v", err)
+	}
+}
+
+func TestSubscriberRoles_ControlTransfers(t *testing.T) {
+	s := newRoleTestSession()
+	owner, writer, viewer := &fakeTerminalClient{"o"}, &fakeTerminalClient{"w"}, &fakeTerminalClient{"v"}
+	s.addSubscriber(owner, "")
+	s.addSubscriber(writer, "")
+	s.addSubscriber(viewer, "")
+	if err := s.setRoleLocked(owner, "w", RoleWriter); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.takeControlLocked(viewer); err == nil {
+		t.Error("a viewer shouldn't be able to take control from an owner")
+	}
+	if err := s.takeControlLocked(writer); err == nil || s.clients[owner].role != RoleOwner {
+		t.Error("a writer shouldn't be able to take control from an owner")
+	}
+	if err := s.setRoleLocked(writer, "v", RoleWriter); err == nil {
+		t.Error("only the owner should be able to change roles")
+	}
+
+	if err := s.handoffLocked(owner, "w"); err != nil {
+		t.Fatalf("handoff to writer failed: %v", err)
+	}
+	if s.clients[writer].role != RoleOwner || s.clients[owner].role != RoleViewer {
+		t.Errorf("handoff: writer=%s owner=%s", s.clients[writer].role, s.clients[owner].role)
+	}
+
+	if err := s.handoffLocked(writer, "v"); err != nil {
+		t.Fatalf("handoff failed: %v", err)
+	}
+	if s.clients[viewer].role != RoleOwner || s.clients[writer].role != RoleViewer {
+		t.Errorf("handoff: viewer=%s writer=%s", s.clients[viewer].role, s.clients[writer].role)
+	}
+
+	if err := s.setRoleLocked(viewer, "o", RoleWriter); err != nil || s.clients[owner].role != RoleWriter {
+		t.Errorf("set-role failed: %v (role %s)", err, s.clients[owner].role)
+	}
+
+	subs := s.subscribersLocked()
+	if len(subs) != 3 || subs[0].ClientID != "o" || subs[2].ClientID != "v" {
+		t.Errorf("subscribers should be in join order, got %+v", subs)
+	}
+}
+
+func TestRemoveClient_ReturnsRemaining(t *testing.T) {
+	tm := newTestManager()
+	s := newRoleTestSession()
+	tm.sessions[s.ID] = s
+	a, b := &fakeTerminalClient{"a"}, &fakeTerminalClient{"b"}
+	s.addSubscriber(a, "")
+	s.addSubscriber(b, "")
+
+	// Others still watch: terminal-disconnect must not detach the PTY
+	if remaining := tm.RemoveClient(s.ID, a); remaining != 1 {
+		t.Errorf("expected 1 remaining, got %d", remaining)
+	}
+	if remaining := tm.RemoveClient(s.ID, b); remaining != 0 {
+		t.Errorf("expected 0 remaining, got %d", remaining)
+	}
+	tm.cancelGraceTimer(s.ID)
+}
+
+func TestWriteToSession_RejectsViewers(t *testing.T) {
+	tm := newTestManager()
+	s := newRoleTestSession()
+	tm.sessions[s.ID] = s
+	owner, viewer := &fakeTerminalClient{"o"}, &fakeTerminalClient{"v"}
+	s.addSubscriber(owner, "")
+	s.addSubscriber(viewer, "")
+
+	if err := tm.WriteToSession(s.ID, viewer, []byte("x")); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+	if err := tm.WriteToSession(s.ID, &fakeTerminalClient{"stranger"}, []byte("x")); err == nil {
+		t.Error("expected an error for an unsubscribed client")
+	}
+}
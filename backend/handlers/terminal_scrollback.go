@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultScrollbackLines is how much history is replayed on reconnect.
+	defaultScrollbackLines = 5000
+	// maxScrollbackLines caps a single replay so a huge history can't
+	// overflow the client's WebSocket send buffer.
+	maxScrollbackLines = 50000
+)
+
+// CaptureScrollback returns the scrollback history of a tmux session via
+// `tmux capture-pane`. lines limits how far back to go (<= 0 for the full
+// history). With ansi, colors and attributes are kept as SGR sequences.
+// When historyOnly is set the visible screen is excluded, since tmux
+// redraws it on attach. Wrapped lines are joined so the client can re-wrap
+// at its own width.
+func CaptureScrollback(tmuxSession string, lines int, ansi, historyOnly bool) (string, error) {
+	args := []string{"capture-pane", "-p", "-J", "-t", tmuxSession}
+	if ansi {
+		args = append(args, "-e")
+	}
+	if lines > 0 {
+		args = append(args, "-S", strconv.Itoa(-lines))
+	} else {
+		args = append(args, "-S", "-")
+	}
+	if historyOnly {
+		args = append(args, "-E", "-1")
+	}
+
+	out, err := tmuxCmd(args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture scrollback for %s: %w", tmuxSession, err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// scrollbackForTerminal formats captured history for xterm.js: CRLF line
+// endings and a trailing newline so live output starts on a fresh line.
+func scrollbackForTerminal(history string) []byte {
+	if history == "" {
+		return nil
+	}
+	return []byte(strings.ReplaceAll(history, "\n", "\r\n") + "\r\n")
+}
+
+// TerminalHistory handles GET /api/terminal/history/{id} - export a session's
+// full scrollback. ?format=text (default), html or ansi; ?lines=N limits it.
+func TerminalHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	session, ok := GetTerminalManager().findSession(id)
+	if !strings.HasPrefix(id, "mt-") || !ok {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return
+	}
+
+	lines, _ := strconv.Atoi(r.URL.Query().Get("lines"))
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "text"
+	}
+	if format != "text" && format != "html" && format != "ansi" {
+		http.Error(w, `{"error": "format must be text, html or ansi"}`, http.StatusBadRequest)
+		return
+	}
+
+	history, err := session.backend().Scrollback(session, lines, format != "text")
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("download") == "true" {
+		ext := map[string]string{"text": "txt", "html": "html", "ansi": "ansi"}[format]
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, id, ext))
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<!doctype html><meta charset=\"utf-8\"><title>%s</title>\n"+
+			"<pre style=\"background:#1e1e1e;color:#d4d4d4;padding:1em;font-family:monospace\">%s</pre>\n",
+			html.EscapeString(id), ansiToHTML(history))
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(history + "\n"))
+	}
+}
+
+// sendScrollback replays a session's history to one client as a
+// terminal-scrollback message (see addClientWithScrollback). lines < 0
+// disables replay.
+func sendScrollback(clientSend func(interface{}), session *TerminalSession, lines int) {
+	if lines < 0 {
+		return
+	}
+	if lines == 0 {
+		lines = defaultScrollbackLines
+	}
+	if lines > maxScrollbackLines {
+		lines = maxScrollbackLines
+	}
+
+	data, count, err := session.backend().Replay(session, lines)
+	if err != nil {
+		log.Printf("[Terminal] Scrollback capture failed for %s: %v", session.ID, err)
+		return
+	}
+	if data == nil {
+		return
+	}
+
+	clientSend(map[string]interface{}{
+		"type":       "terminal-scrollback",
+		"terminalId": session.ID,
+		"data":       base64.StdEncoding.EncodeToString(data),
+		"lines":      count,
+	})
+}
+
+// addClientWithScrollback subscribes a reconnecting client and sends it the
+// session's history. Output is held back until the history is sent, so the
+// client sees everything after it as live output.
+func (tm *TerminalManager) addClientWithScrollback(clientSend func(interface{}), session *TerminalSession, client interface{}, requestedRole string, lines int) string {
+	session.outputMu.Lock()
+	defer session.outputMu.Unlock()
+	role := tm.AddClient(session.ID, client, requestedRole)
+	sendScrollback(clientSend, session, lines)
+	return role
+}
+
+// --- ANSI → HTML ---
+
+// ansiPalette is the xterm palette for the 16 basic colors.
+var ansiPalette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// ansi256 returns the hex color for an xterm 256-color index.
+func ansi256(n int) string {
+	switch {
+	case n < 16:
+		return ansiPalette[n]
+	case n < 232:
+		n -= 16
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[(n/6)%6], levels[n%6])
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
+
+// sgrState is the current set of graphic rendition attributes.
+type sgrState struct {
+	fg, bg                                        string
+	bold, dim, italic, underline, inverse, strike bool
+}
+
+func (s sgrState) style() string {
+	fg, bg := s.fg, s.bg
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#1e1e1e"
+		}
+		if bg == "" {
+			bg = "#d4d4d4"
+		}
+	}
+
+	var parts []string
+	if fg != "" {
+		parts = append(parts, "color:"+fg)
+	}
+	if bg != "" {
+		parts = append(parts, "background-color:"+bg)
+	}
+	if s.bold {
+		parts = append(parts, "font-weight:bold")
+	}
+	if s.dim {
+		parts = append(parts, "opacity:0.7")
+	}
+	if s.italic {
+		parts = append(parts, "font-style:italic")
+	}
+	var deco []string
+	if s.underline {
+		deco = append(deco, "underline")
+	}
+	if s.strike {
+		deco = append(deco, "line-through")
+	}
+	if len(deco) > 0 {
+		parts = append(parts, "text-decoration:"+strings.Join(deco, " "))
+	}
+	return strings.Join(parts, ";")
+}
+
+// extendedColor parses the tail of a 38/48 sequence (5;n or 2;r;g;b),
+// returning the color and how many parameters it consumed.
+func extendedColor(params []int) (string, int) {
+	if len(params) >= 2 && params[0] == 5 {
+		if params[1] >= 0 && params[1] < 256 {
+			return ansi256(params[1]), 2
+		}
+		return "", 2
+	}
+	if len(params) >= 4 && params[0] == 2 {
+		return fmt.Sprintf("#%02x%02x%02x", params[1]&0xff, params[2]&0xff, params[3]&0xff), 4
+	}
+	return "", len(params)
+}
+
+// apply updates the state with one SGR parameter list.
+func (s *sgrState) apply(params []int) {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			*s = sgrState{}
+		case p == 1:
+			s.bold = true
+		case p == 2:
+			s.dim = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 7:
+			s.inverse = true
+		case p == 9:
+			s.strike = true
+		case p == 22:
+			s.bold, s.dim = false, false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p == 27:
+			s.inverse = false
+		case p == 29:
+			s.strike = false
+		case p >= 30 && p <= 37:
+			s.fg = ansiPalette[p-30]
+		case p == 38:
+			color, n := extendedColor(params[i+1:])
+			s.fg = color
+			i += n
+		case p == 39:
+			s.fg = ""
+		case p >= 40 && p <= 47:
+			s.bg = ansiPalette[p-40]
+		case p == 48:
+			color, n := extendedColor(params[i+1:])
+			s.bg = color
+			i += n
+		case p == 49:
+			s.bg = ""
+		case p >= 90 && p <= 97:
+			s.fg = ansiPalette[p-90+8]
+		case p >= 100 && p <= 107:
+			s.bg = ansiPalette[p-100+8]
+		}
+	}
+}
+
+// ansiToHTML converts text containing ANSI SGR sequences into HTML with
+// inline-styled spans. Text is HTML-escaped; other escape sequences (cursor
+// movement, OSC titles) are dropped.
+func ansiToHTML(input string) string {
+	var b strings.Builder
+	var state sgrState
+	open := false
+
+	setStyle := func() {
+		if open {
+			b.WriteString("</span>")
+			open = false
+		}
+		if style := state.style(); style != "" {
+			b.WriteString(`<span style="` + style + `">`)
+			open = true
+		}
+	}
+
+	text := 0 // start of pending plain text
+	flush := func(end int) {
+		if end > text {
+			b.WriteString(html.EscapeString(input[text:end]))
+		}
+	}
+
+	for i := 0; i < len(input); {
+		if input[i] != 0x1b || i+1 >= len(input) {
+			i++
+			continue
+		}
+		flush(i)
+
+		switch input[i+1] {
+		case '[':
+			// CSI: parameters, intermediates, final byte in 0x40-0x7e
+			j := i + 2
+			for j < len(input) && (input[j] < 0x40 || input[j] > 0x7e) {
+				j++
+			}
+			if j < len(input) && input[j] == 'm' {
+				state.apply(parseSGRParams(input[i+2 : j]))
+				setStyle()
+			}
+			i = j + 1
+		case ']':
+			// OSC: terminated by BEL or ST (ESC \)
+			j := i + 2
+			for j < len(input) && input[j] != 0x07 && !(input[j] == 0x1b && j+1 < len(input) && input[j+1] == '\\') {
+				j++
+			}
+			if j < len(input) && input[j] == 0x1b {
+				j++
+			}
+			i = j + 1
+		default:
+			i += 2
+		}
+		if i > len(input) {
+			i = len(input)
+		}
+		text = i
+	}
+	flush(len(input))
+
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
+
+// parseSGRParams splits "1;38;5;208" (or "38:5:208") into integers.
+// Empty parameters count as 0.
+func parseSGRParams(s string) []int {
+	if s == "" {
+		return nil
+	}
+	fields := strings.Split(strings.ReplaceAll(s, ":", ";"), ";")
+	params := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, _ := strconv.Atoi(f)
+		params = append(params, n)
+	}
+	return params
+}
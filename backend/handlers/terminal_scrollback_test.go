@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ---- ansiToHTML tests ----
+
+func TestAnsiToHTML_PlainTextIsEscaped(t *testing.T) {
+	got := ansiToHTML("a < b && c > d")
+	if got != "a &lt; b &amp;&amp; c &gt; d" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestAnsiToHTML_BasicColorAndReset(t *testing.T) {
+	got := ansiToHTML("\x1b[31mred\x1b[0m plain")
+	want := `<span style="color:#cd3131">red</span> plain`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAnsiToHTML_256AndTrueColor(t *testing.T) {
+	got := ansiToHTML("\x1b[38;5;208mo\x1b[48;2;1;2;3mx\x1b[m")
+	if !strings.Contains(got, "color:#ff8700") {
+		t.Errorf("expected 256-color orange, got %q", got)
+	}
+	if !strings.Contains(got, "background-color:#010203") {
+		t.Errorf("expected truecolor background, got %q", got)
+	}
+	if strings.Count(got, "<span") != strings.Count(got, "</span>") {
+		t.Errorf("unbalanced spans: %q", got)
+	}
+}
+
+func TestAnsiToHTML_AttributesCombine(t *testing.T) {
+	got := ansiToHTML("\x1b[1;4;92mok\x1b[22mthin")
+	if !strings.Contains(got, `<span style="color:#23d18b;font-weight:bold;text-decoration:underline">ok`) {
+		t.Errorf("expected bold underline bright green, got %q", got)
+	}
+	if !strings.Contains(got, `<span style="color:#23d18b;text-decoration:underline">thin</span>`) {
+		t.Errorf("expected bold cleared by SGR 22, got %q", got)
+	}
+}
+
+func TestAnsiToHTML_DropsNonSGRSequences(t *testing.T) {
+	got := ansiToHTML("\x1b]0;title\x07\x1b[2Jhello\x1b[10;5Hworld\x1b]8;;http://x\x1b\\")
+	if got != "helloworld" {
+		t.Errorf("expected control sequences stripped, got %q", got)
+	}
+}
+
+func TestScrollbackForTerminal_UsesCRLF(t *testing.T) {
+	got := string(scrollbackForTerminal("one\ntwo"))
+	if got != "one\r\ntwo\r\n" {
+		t.Errorf("got %q", got)
+	}
+	if scrollbackForTerminal("") != nil {
+		t.Error("expected nil for empty history")
+	}
+}
+
+// ---- Reconnect replay tests ----
+
+func TestAddClientWithScrollback_NoGapOrRepeat(t *testing.T) {
+	tm := newTestManager()
+	tm.shells = make(map[string]*shellTracker)
+
+	// A pipe stands in for the PTY of a session that keeps writing
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &TerminalSession{
+		ID:         "mt-replay",
+		Backend:    BackendPTY,
+		ptmx:       r,
+		scrollback: newOutputBuffer(ptyScrollbackBytes),
+		clients:    make(map[interface{}]*terminalSubscriber),
+		done:       make(chan struct{}),
+	}
+	tm.sessions[session.ID] = session
+
+	client := &fakeTerminalClient{"late"}
+	var mu sync.Mutex
+	var received bytes.Buffer
+	tm.SetBroadcastFunc(func(id string, data []byte) {
+		for _, c := range tm.GetClients(id) {
+			if c == client {
+				mu.Lock()
+				received.Write(data)
+				mu.Unlock()
+			}
+		}
+	})
+	readDone := make(chan struct{})
+	go func() {
+		tm.readPTY(session)
+		close(readDone)
+	}()
+
+	stop := make(chan struct{})
+	go func() {
+		defer w.Close()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fmt.Fprintf(w, "%d\n", i)
+		}
+	}()
+
+	// Let the history fill up, so replaying it takes a while
+	time.Sleep(100 * time.Millisecond)
+	tm.addClientWithScrollback(func(msg interface{}) {
+		m := msg.(map[string]interface{})
+		if m["type"] != "terminal-scrollback" {
+			return
+		}
+		data, _ := base64.StdEncoding.DecodeString(m["data"].(string))
+		mu.Lock()
+		received.Write(data)
+		mu.Unlock()
+	}, session, client, "", maxScrollbackLines)
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	<-readDone
+
+	// History followed by live output counts up without gaps or repeats
+	lines := strings.Split(strings.TrimSuffix(received.String(), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("received %d lines", len(lines))
+	}
+	first, _ := strconv.Atoi(lines[0])
+	for i, line := range lines {
+		if n, err := strconv.Atoi(line); err != nil || n != first+i {
+			t.Fatalf("line %d is %q, want %d", i, line, first+i)
+		}
+	}
+}
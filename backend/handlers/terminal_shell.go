@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/utils"
+)
+
+// --- Shell integration ---
+//
+// Interactive bash, zsh and fish sessions load a small snippet that marks
+// prompt and command boundaries with OSC 133 and reports the working
+// directory with OSC 7. tmux forwards them (wrapped in its passthrough
+// escape) to our attached PTY, where readPTY hands the output to
+// trackShell. The sequences are left in the stream; xterm.js ignores them.
+
+//go:embed all:shell-integration
+var shellIntegrationFiles embed.FS
+
+var (
+	shellIntegrationOnce sync.Once
+	shellIntegrationPath string
+)
+
+// shellIntegrationDir writes the integration scripts to the data directory
+// (once per process, so upgrades replace stale copies) and returns it.
+func shellIntegrationDir() string {
+	shellIntegrationOnce.Do(func() {
+		dir := filepath.Join(utils.DataDir(), "shell-integration")
+
+		err := fs.WalkDir(shellIntegrationFiles, "shell-integration", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dir, strings.TrimPrefix(path, "shell-integration"))
+			if d.IsDir() {
+				return os.MkdirAll(target, 0755)
+			}
+			data, err := shellIntegrationFiles.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, 0644)
+		})
+		if err != nil {
+			log.Printf("[Terminal] Failed to install shell integration: %v", err)
+			return
+		}
+		shellIntegrationPath = dir
+	})
+	return shellIntegrationPath
+}
+
+// integrationShell returns which integration script applies to shell
+// ("bash", "zsh", "fish"), or "" if the shell isn't supported.
+func integrationShell(shell string) string {
+	switch name := filepath.Base(shell); name {
+	case "bash", "zsh", "fish":
+		return name
+	}
+	return ""
+}
+
+// shellIntegrationInvoke returns the arguments that load the integration
+// into an interactive shell (replacing -l where the shell needs it), plus
+// the environment the scripts expect. ok is false if the shell isn't
+// supported or the scripts couldn't be installed.
+func shellIntegrationInvoke(shell string, login bool, env map[string]string) (args string, extraEnv map[string]string, ok bool) {
+	kind := integrationShell(shell)
+	if kind == "" {
+		return "", nil, false
+	}
+	dir := shellIntegrationDir()
+	if dir == "" {
+		return "", nil, false
+	}
+
+	extraEnv = make(map[string]string)
+	switch kind {
+	case "bash":
+		// --init-file is ignored by login shells; the script sources the
+		// login files itself instead
+		args = " --init-file " + shellQuote(filepath.Join(dir, "bash.sh"))
+		if login {
+			extraEnv["MDT_SHELL_LOGIN"] = "1"
+		}
+	case "zsh":
+		userZdotdir := env["ZDOTDIR"]
+		if userZdotdir == "" {
+			userZdotdir = os.Getenv("ZDOTDIR")
+		}
+		if userZdotdir != "" {
+			extraEnv["MDT_USER_ZDOTDIR"] = userZdotdir
+		}
+		extraEnv["ZDOTDIR"] = filepath.Join(dir, "zsh")
+		if login {
+			args = " -l"
+		}
+	case "fish":
+		if login {
+			args = " -l"
+		}
+		args += " --init-command " + shellQuote("source "+shellQuote(filepath.Join(dir, "fish.fish")))
+	}
+	return args, extraEnv, true
+}
+
+// --- OSC scanning ---
+
+// maxOSCLength bounds a buffered OSC payload; longer ones are dropped.
+const maxOSCLength = 8192
+
+const (
+	oscGround = iota
+	oscEscape
+	oscString
+	oscStringEscape
+)
+
+// oscScanner extracts OSC payloads (the text between ESC ] and BEL/ST)
+// from a byte stream, and counts bells (BEL outside a sequence). Sequences
+// may be split across Feed calls.
+type oscScanner struct {
+	state    int
+	buf      []byte
+	overflow bool
+	bells    int // since the last TakeBells
+}
+
+// Feed scans data and returns the payloads of the OSC sequences completed
+// in it.
+func (s *oscScanner) Feed(data []byte) []string {
+	if s.state == oscGround && bytes.IndexByte(data, 0x1b) < 0 {
+		s.bells += bytes.Count(data, []byte{0x07})
+		return nil
+	}
+
+	var payloads []string
+	for _, b := range data {
+		switch s.state {
+		case oscGround:
+			switch b {
+			case 0x1b:
+				s.state = oscEscape
+			case 0x07:
+				s.bells++
+			}
+		case oscEscape:
+			s.startOrGround(b)
+		case oscString:
+			switch b {
+			case 0x07:
+				payloads = s.finish(payloads)
+			case 0x1b:
+				s.state = oscStringEscape
+			default:
+				if len(s.buf) < maxOSCLength {
+					s.buf = append(s.buf, b)
+				} else {
+					s.overflow = true
+				}
+			}
+		case oscStringEscape:
+			if b == '\\' {
+				payloads = s.finish(payloads)
+			} else {
+				// ESC that isn't ST aborts the string and starts a new sequence
+				s.startOrGround(b)
+			}
+		}
+	}
+	return payloads
+}
+
+// TakeBells returns the number of bells seen since the last call.
+func (s *oscScanner) TakeBells() int {
+	n := s.bells
+	s.bells = 0
+	return n
+}
+
+func (s *oscScanner) startOrGround(b byte) {
+	switch b {
+	case ']':
+		s.state = oscString
+		s.buf = s.buf[:0]
+		s.overflow = false
+	case 0x1b:
+		s.state = oscEscape
+	default:
+		s.state = oscGround
+	}
+}
+
+func (s *oscScanner) finish(payloads []string) []string {
+	if !s.overflow {
+		payloads = append(payloads, string(s.buf))
+	}
+	s.state = oscGround
+	s.buf = s.buf[:0]
+	s.overflow = false
+	return payloads
+}
+
+// --- Command tracking ---
+
+// maxCommandHistory is how many finished commands are kept per session.
+const maxCommandHistory = 500
+
+// CommandRecord is one command run at a shell prompt.
+type CommandRecord struct {
+	ID         int        `json:"id"`
+	Command    string     `json:"command"`
+	Cwd        string     `json:"cwd,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+	ExitCode   *int       `json:"exitCode,omitempty"`
+}
+
+// shellTracker follows the OSC 133/7 marks of one session.
+type shellTracker struct {
+	scanner    oscScanner
+	integrated bool // seen at least one mark
+	cwd        string
+	running    *CommandRecord
+	history    []CommandRecord
+	nextID     int
+	mu         sync.Mutex
+}
+
+// shellChange is what one OSC payload changed.
+type shellChange struct {
+	cwd      string         // new working directory
+	started  *CommandRecord // command that started
+	finished *CommandRecord // command that finished
+}
+
+// apply updates the tracker with one OSC payload. Payloads other than
+// OSC 133 and OSC 7 are ignored.
+func (t *shellTracker) apply(payload string, now time.Time) []shellChange {
+	code, rest, _ := strings.Cut(payload, ";")
+	switch code {
+	case "7":
+		u, err := url.Parse(rest)
+		if err != nil || u.Scheme != "file" || u.Path == "" || u.Path == t.cwd {
+			return nil
+		}
+		t.integrated = true
+		t.cwd = u.Path
+		return []shellChange{{cwd: u.Path}}
+
+	case "133":
+		t.integrated = true
+		fields := strings.Split(rest, ";")
+		switch fields[0] {
+		case "A":
+			// A prompt without D: the command's status is unknown
+			if t.running != nil {
+				return []shellChange{{finished: t.finish(now, nil)}}
+			}
+		case "C":
+			var changes []shellChange
+			if t.running != nil {
+				changes = append(changes, shellChange{finished: t.finish(now, nil)})
+			}
+			t.nextID++
+			t.running = &CommandRecord{
+				ID:        t.nextID,
+				Command:   commandLineParam(fields[1:]),
+				Cwd:       t.cwd,
+				StartedAt: now,
+			}
+			started := *t.running
+			return append(changes, shellChange{started: &started})
+		case "D":
+			if t.running == nil {
+				return nil
+			}
+			var exitCode *int
+			if len(fields) > 1 {
+				if n, err := strconv.Atoi(fields[1]); err == nil {
+					exitCode = &n
+				}
+			}
+			return []shellChange{{finished: t.finish(now, exitCode)}}
+		}
+	}
+	return nil
+}
+
+// finish moves the running command into the history.
+func (t *shellTracker) finish(now time.Time, exitCode *int) *CommandRecord {
+	rec := *t.running
+	t.running = nil
+	rec.FinishedAt = &now
+	rec.DurationMs = now.Sub(rec.StartedAt).Milliseconds()
+	rec.ExitCode = exitCode
+
+	t.history = append(t.history, rec)
+	if len(t.history) > maxCommandHistory {
+		t.history = t.history[len(t.history)-maxCommandHistory:]
+	}
+	return &rec
+}
+
+// commandLineParam reads the command line from OSC 133;C parameters
+// (cmdline_url=<percent-encoded> or cmdline=<raw>).
+func commandLineParam(params []string) string {
+	for _, p := range params {
+		if v, ok := strings.CutPrefix(p, "cmdline_url="); ok {
+			if decoded, err := url.PathUnescape(v); err == nil {
+				return decoded
+			}
+			return v
+		}
+		if v, ok := strings.CutPrefix(p, "cmdline="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// trackShell scans PTY output for shell integration marks and bells,
+// updates the session's cwd and command history, notifies the session's
+// clients, and feeds the activity monitor.
+func (tm *TerminalManager) trackShell(sessionID string, data []byte) {
+	tm.shellMu.Lock()
+	tracker, ok := tm.shells[sessionID]
+	if !ok {
+		tracker = &shellTracker{}
+		tm.shells[sessionID] = tracker
+	}
+	tm.shellMu.Unlock()
+
+	tracker.mu.Lock()
+	payloads := tracker.scanner.Feed(data)
+	var changes []shellChange
+	now := time.Now()
+	for _, p := range payloads {
+		changes = append(changes, tracker.apply(p, now)...)
+	}
+	bells := tracker.scanner.TakeBells()
+	tracker.mu.Unlock()
+
+	if bells > 0 {
+		tm.noteBell(sessionID)
+	}
+
+	for _, c := range changes {
+		switch {
+		case c.cwd != "":
+			tm.mu.Lock()
+			if session, ok := tm.sessions[sessionID]; ok {
+				session.Cwd = c.cwd
+			}
+			tm.mu.Unlock()
+			tm.sendSessionEvent(sessionID, map[string]interface{}{
+				"type":       "terminal-cwd",
+				"terminalId": sessionID,
+				"cwd":        c.cwd,
+			})
+		case c.started != nil:
+			tm.sendSessionEvent(sessionID, map[string]interface{}{
+				"type":       "terminal-command",
+				"terminalId": sessionID,
+				"phase":      "started",
+				"command":    c.started,
+			})
+			tm.auditCommandStarted(sessionID, c.started)
+		case c.finished != nil:
+			tm.sendSessionEvent(sessionID, map[string]interface{}{
+				"type":       "terminal-command",
+				"terminalId": sessionID,
+				"phase":      "finished",
+				"command":    c.finished,
+			})
+			tm.noteCommandFinished(sessionID, c.finished)
+			tm.auditCommandFinished(sessionID, c.finished)
+		}
+	}
+}
+
+// forgetShell drops the command history (and audit state) of a closed
+// session.
+func (tm *TerminalManager) forgetShell(sessionID string) {
+	tm.shellMu.Lock()
+	delete(tm.shells, sessionID)
+	tm.shellMu.Unlock()
+	tm.forgetAudit(sessionID)
+}
+
+// CommandHistory returns the finished commands of a session (oldest first),
+// the running command if any, the last reported cwd, and whether the shell
+// has reported any integration marks at all.
+func (tm *TerminalManager) CommandHistory(sessionID string) (history []CommandRecord, running *CommandRecord, cwd string, integrated bool) {
+	tm.shellMu.Lock()
+	tracker, ok := tm.shells[sessionID]
+	tm.shellMu.Unlock()
+	if !ok {
+		return []CommandRecord{}, nil, "", false
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	history = make([]CommandRecord, len(tracker.history))
+	copy(history, tracker.history)
+	if tracker.running != nil {
+		r := *tracker.running
+		running = &r
+	}
+	return history, running, tracker.cwd, tracker.integrated
+}
+
+// TerminalCommands handles GET /api/terminal/{id}/commands - the command
+// history recorded through shell integration.
+func TerminalCommands(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	tm := GetTerminalManager()
+
+	tm.mu.RLock()
+	_, exists := tm.sessions[id]
+	tm.mu.RUnlock()
+	if !exists {
+		http.Error(w, `{"error": "terminal session not found"}`, http.StatusNotFound)
+		return
+	}
+
+	history, running, cwd, integrated := tm.CommandHistory(id)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"terminalId": id,
+		"integrated": integrated,
+		"cwd":        cwd,
+		"running":    running,
+		"commands":   history,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- Shell integration tests ----
+
+func TestOSCScanner_SplitSequences(t *testing.T) {
+	var s oscScanner
+	var got []string
+	// BEL and ST terminators, a sequence split across reads, a CSI in between
+	for _, chunk := range []string{
+		"out\x1b]133;A\x07\x1b[1mbold\x1b]7;file://h/tm",
+		"p\x1b\\",
+		"\x1b]133;D;",
+		"2\x07",
+	} {
+		got = append(got, s.Feed([]byte(chunk))...)
+	}
+	want := []string{"133;A", "7;file://h/tmp", "133;D;2"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestShellTracker_CommandLifecycle(t *testing.T) {
+	var tr shellTracker
+	start := time.Unix(1000, 0)
+
+	tr.apply("7;file://host/home/u/my%20dir", start)
+	if tr.cwd != "/home/u/my dir" {
+		t.Fatalf("cwd = %q", tr.cwd)
+	}
+
+	tr.apply("133;A", start)
+	changes := tr.apply("133;C;cmdline_url=ls%20-la", start)
+	if len(changes) != 1 || changes[0].started == nil || changes[0].started.Command != "ls -la" {
+		t.Fatalf("expected a started command, got %+v", changes)
+	}
+	changes = tr.apply("133;D;1", start.Add(1500*time.Millisecond))
+	if len(changes) != 1 || changes[0].finished == nil {
+		t.Fatalf("expected a finished command, got %+v", changes)
+	}
+	rec := changes[0].finished
+	if rec.ExitCode == nil || *rec.ExitCode != 1 || rec.DurationMs != 1500 || rec.Cwd != "/home/u/my dir" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	// A prompt after a command with no D finishes it with an unknown status
+	tr.apply("133;C;cmdline=vim", start)
+	tr.apply("133;A", start)
+	if len(tr.history) != 2 || tr.history[1].ExitCode != nil || tr.running != nil {
+		t.Errorf("unexpected history %+v", tr.history)
+	}
+
+	// D without a running command is ignored
+	if changes := tr.apply("133;D;0", start); changes != nil {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestOSCScanner_CountsBells(t *testing.T) {
+	var s oscScanner
+	s.Feed([]byte("done\x07"))
+	s.Feed([]byte("\x1b]0;title\x07\x07")) // the first BEL terminates the OSC
+	if n := s.TakeBells(); n != 2 {
+		t.Errorf("expected 2 bells, got %d", n)
+	}
+	if n := s.TakeBells(); n != 0 {
+		t.Errorf("expected bells to reset, got %d", n)
+	}
+}
@@ -255,6 +255,95 @@ func TestSaveTerminalProfileHandler_SavesAndReturnsOK(t *testing.T) {
 	}
 }
 
+func TestSaveTerminalProfileHandler_RejectsInvalidProfiles(t *testing.T) {
+	cases := map[string][]TerminalProfile{
+		"missing name":        {{ID: "a"}},
+		"duplicate id":        {{ID: "a", Name: "A"}, {ID: "a", Name: "B"}},
+		"unknown placeholder": {{ID: "a", Name: "A", Cwd: "{{workspace}}/{{nope}}"}},
+		"bad env key":         {{ID: "a", Name: "A", Env: map[string]string{"1BAD": "x"}}},
+		"reserved env key":    {{ID: "a", Name: "A", Env: map[string]string{"MDT_SESSION_ID": "x"}}},
+		"bad tmux option":     {{ID: "a", Name: "A", TmuxOptions: map[string]string{"status style": "x"}}},
+		"missing shell":       {{ID: "a", Name: "A", Shell: "/nonexistent/shell"}},
+		"size out of range":   {{ID: "a", Name: "A", Cols: 5}},
+	}
+	for name, profiles := range cases {
+		data, _ := json.Marshal(profiles)
+		req := httptest.NewRequest(http.MethodPost, "/api/terminal/profiles", strings.NewReader(string(data)))
+		rr := httptest.NewRecorder()
+
+		SaveTerminalProfile(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, rr.Code)
+		}
+	}
+}
+
+func TestSpawnOptions_ShellIntegrationOptIn(t *testing.T) {
+	on, off := true, false
+	vars := TemplateVars{Workspace: "/ws"}
+	if (&TerminalProfile{}).SpawnOptions("mt-a", vars).ShellIntegration {
+		t.Error("expected shell integration off by default")
+	}
+	if !(&TerminalProfile{ShellIntegration: &on}).SpawnOptions("mt-a", vars).ShellIntegration {
+		t.Error("expected the profile to enable shell integration")
+	}
+
+	opts, err := spawnRequest{ID: "mt-a"}.spawnOptions()
+	if err != nil || opts.ShellIntegration {
+		t.Errorf("expected shell integration off by default, got %v (%v)", opts.ShellIntegration, err)
+	}
+	opts, _ = spawnRequest{ID: "mt-a", ShellIntegration: &on}.spawnOptions()
+	if !opts.ShellIntegration {
+		t.Error("expected the request to enable shell integration")
+	}
+	opts, _ = spawnRequest{ID: "mt-a", ShellIntegration: &off}.spawnOptions()
+	if opts.ShellIntegration {
+		t.Error("expected the request to disable shell integration")
+	}
+}
+
+func TestTemplateVarsExpand(t *testing.T) {
+	vars := TemplateVars{Workspace: "/ws", File: "/ws/a.md", GitRoot: "/ws", Home: "/home/u"}
+	got := vars.Expand("cd {{workspace}} && edit {{ file }} in {{gitRoot}} from {{home}}")
+	want := "cd /ws && edit /ws/a.md in /ws from /home/u"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// gitRoot falls back to the workspace outside a repo
+	vars.GitRoot = ""
+	if got := vars.Expand("{{gitRoot}}"); got != "/ws" {
+		t.Errorf("expected gitRoot fallback to workspace, got %q", got)
+	}
+
+	// Command lines get quoted values
+	vars.File = "/ws/it's; rm -rf ~.md"
+	got = vars.ExpandShell("vim {{file}}")
+	want = `vim '/ws/it'\''s; rm -rf ~.md'`
+	if got != want {
+		t.Errorf("ExpandShell: got %q, want %q", got, want)
+	}
+}
+
+func TestSpawnOptionsShellCommand(t *testing.T) {
+	cases := []struct {
+		opts SpawnOptions
+		want string
+	}{
+		{SpawnOptions{Shell: "/bin/zsh", Login: true}, `'/bin/zsh' -l`},
+		{SpawnOptions{Shell: "/bin/bash"}, `'/bin/bash'`},
+		{SpawnOptions{Shell: "/bin/bash", Login: true, Command: "npm run dev"}, `'/bin/bash' -l -c 'npm run dev'`},
+		{SpawnOptions{Shell: "/bin/sh", PreCommand: "cd src"}, "'/bin/sh' -c 'cd src\nexec '\\''/bin/sh'\\'''"},
+		{SpawnOptions{Shell: "/bin/sh", Command: "echo 'hi'"}, `'/bin/sh' -c 'echo '\''hi'\'''`},
+	}
+	for _, c := range cases {
+		if got := c.opts.shellCommand(); got != c.want {
+			t.Errorf("shellCommand(%+v) = %q, want %q", c.opts, got, c.want)
+		}
+	}
+}
+
 // ---- helpers ----
 
 func envContains(env []string, needle string) bool {
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"markdown-themes-backend/utils"
+)
+
+// --- Theme sync ---
+//
+// xterm.js takes its colors from the app theme (src/lib/terminalThemes.ts),
+// but tmux draws the status bar, pane borders, messages and copy-mode
+// highlights itself. The client posts the active palette here; it is
+// turned into tmux styles, set on every mt-* session and stored so new
+// sessions start themed. Everything is set per session and window, never
+// globally, since the tmux server is shared with the user's own sessions.
+// New windows pick the styles up through an after-new-window hook.
+
+// TerminalPalette mirrors TerminalPalette in src/lib/terminalThemes.ts.
+// Colors are CSS colors: #rgb, #rrggbb, rgb() or rgba().
+type TerminalPalette struct {
+	Foreground          string `json:"foreground"`
+	Cursor              string `json:"cursor"`
+	CursorAccent        string `json:"cursorAccent"`
+	SelectionBackground string `json:"selectionBackground"`
+	Black               string `json:"black"`
+	Red                 string `json:"red"`
+	Green               string `json:"green"`
+	Yellow              string `json:"yellow"`
+	Blue                string `json:"blue"`
+	Magenta             string `json:"magenta"`
+	Cyan                string `json:"cyan"`
+	White               string `json:"white"`
+	BrightBlack         string `json:"brightBlack"`
+	BrightRed           string `json:"brightRed"`
+	BrightGreen         string `json:"brightGreen"`
+	BrightYellow        string `json:"brightYellow"`
+	BrightBlue          string `json:"brightBlue"`
+	BrightMagenta       string `json:"brightMagenta"`
+	BrightCyan          string `json:"brightCyan"`
+	BrightWhite         string `json:"brightWhite"`
+}
+
+// TerminalTheme is the app theme as applied to tmux.
+type TerminalTheme struct {
+	ThemeID string          `json:"themeId,omitempty"`
+	Palette TerminalPalette `json:"palette"`
+	// Background is the page color behind the (transparent) terminal,
+	// used to flatten translucent colors; black if unset
+	Background string `json:"background,omitempty"`
+}
+
+// themeOption is a tmux option set from the theme.
+type themeOption struct {
+	Name   string
+	Value  string
+	Window bool // window option (set on each window) rather than session option
+}
+
+var cssRGBPattern = regexp.MustCompile(`^rgba?\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*(?:,\s*([\d.]+)\s*)?\)$`)
+
+// parseCSSColor parses a CSS hex or rgb()/rgba() color into its channels
+// and alpha.
+func parseCSSColor(s string) (rgb [3]float64, alpha float64, err error) {
+	s = strings.TrimSpace(s)
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) == 6 {
+			if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				return [3]float64{float64(v >> 16), float64(v >> 8 & 0xff), float64(v & 0xff)}, 1, nil
+			}
+		}
+		return rgb, 0, fmt.Errorf("invalid color %q", s)
+	}
+	m := cssRGBPattern.FindStringSubmatch(s)
+	if m == nil {
+		return rgb, 0, fmt.Errorf("invalid color %q (use #rrggbb or rgba())", s)
+	}
+	for i := range rgb {
+		v, _ := strconv.Atoi(m[i+1])
+		if v > 255 {
+			return rgb, 0, fmt.Errorf("invalid color %q", s)
+		}
+		rgb[i] = float64(v)
+	}
+	alpha = 1
+	if m[4] != "" {
+		if alpha, err = strconv.ParseFloat(m[4], 64); err != nil || alpha > 1 {
+			return rgb, 0, fmt.Errorf("invalid color %q", s)
+		}
+	}
+	return rgb, alpha, nil
+}
+
+// tmuxColor converts a CSS color to a tmux #rrggbb, flattening any
+// transparency onto backdrop.
+func tmuxColor(s string, backdrop [3]float64) (string, error) {
+	rgb, alpha, err := parseCSSColor(s)
+	if err != nil {
+		return "", err
+	}
+	var c [3]int
+	for i := range rgb {
+		c[i] = int(math.Round(rgb[i]*alpha + backdrop[i]*(1-alpha)))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2]), nil
+}
+
+// themeOptions maps a theme to tmux options: the status bar and menus use
+// the palette's black and foreground, the current window and active pane
+// border its blue, messages its yellow, and copy mode the selection color
+// with cyan and magenta for search matches.
+func themeOptions(theme TerminalTheme) ([]themeOption, error) {
+	var backdrop [3]float64
+	if theme.Background != "" {
+		rgb, _, err := parseCSSColor(theme.Background)
+		if err != nil {
+			return nil, fmt.Errorf("background: %w", err)
+		}
+		backdrop = rgb
+	}
+
+	var firstErr error
+	color := func(field, value string) string {
+		c, err := tmuxColor(value, backdrop)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("palette.%s: %w", field, err)
+		}
+		return c
+	}
+	p := theme.Palette
+	fg := color("foreground", p.Foreground)
+	sel := color("selectionBackground", p.SelectionBackground)
+	black := color("black", p.Black)
+	yellow := color("yellow", p.Yellow)
+	blue := color("blue", p.Blue)
+	magenta := color("magenta", p.Magenta)
+	cyan := color("cyan", p.Cyan)
+	white := color("white", p.White)
+	gray := color("brightBlack", p.BrightBlack)
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return []themeOption{
+		{Name: "status-style", Value: "bg=" + black + ",fg=" + fg},
+		{Name: "message-style", Value: "bg=" + yellow + ",fg=" + black},
+		{Name: "message-command-style", Value: "bg=" + black + ",fg=" + yellow},
+		{Name: "menu-style", Value: "bg=" + black + ",fg=" + fg},
+		{Name: "menu-selected-style", Value: "bg=" + blue + ",fg=" + black + ",bold"},
+		{Name: "menu-border-style", Value: "fg=" + gray},
+		{Name: "display-panes-colour", Value: gray},
+		{Name: "display-panes-active-colour", Value: blue},
+		{Name: "window-status-style", Value: "fg=" + white, Window: true},
+		{Name: "window-status-current-style", Value: "bg=" + blue + ",fg=" + black + ",bold", Window: true},
+		{Name: "pane-border-style", Value: "fg=" + gray, Window: true},
+		{Name: "pane-active-border-style", Value: "fg=" + blue, Window: true},
+		{Name: "mode-style", Value: "bg=" + sel + ",fg=" + fg, Window: true},
+		{Name: "copy-mode-match-style", Value: "bg=" + cyan + ",fg=" + black, Window: true},
+		{Name: "copy-mode-current-match-style", Value: "bg=" + magenta + ",fg=" + black, Window: true},
+		{Name: "clock-mode-colour", Value: blue, Window: true},
+	}, nil
+}
+
+func themePath() string {
+	return filepath.Join(utils.DataDir(), "terminal-theme.json")
+}
+
+// LoadTerminalTheme reads the stored theme, or nil if none has been set.
+func LoadTerminalTheme() (*TerminalTheme, error) {
+	data, err := os.ReadFile(themePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var theme TerminalTheme
+	if err := json.Unmarshal(data, &theme); err != nil {
+		return nil, err
+	}
+	return &theme, nil
+}
+
+// SaveTerminalTheme stores the theme for new sessions.
+func SaveTerminalTheme(theme TerminalTheme) error {
+	path := themePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(theme, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// unsupportedTmuxOptions holds options the installed tmux rejected (the
+// menu styles need tmux 3.4), so they aren't retried for every session.
+var unsupportedTmuxOptions sync.Map
+
+// setThemeOption runs set-option, remembering options tmux doesn't know.
+func setThemeOption(args ...string) {
+	name := args[len(args)-2]
+	if _, skip := unsupportedTmuxOptions.Load(name); skip {
+		return
+	}
+	out, err := tmuxCmd(append([]string{"set-option"}, args...)...).CombinedOutput()
+	if err == nil {
+		return
+	}
+	if strings.Contains(string(out), "invalid option") {
+		unsupportedTmuxOptions.Store(name, true)
+		log.Printf("[Terminal] tmux option %s not supported, theme skips it", name)
+		return
+	}
+	log.Printf("[Terminal] tmux set-option %s warning: %v (output: %s)", name, err, strings.TrimSpace(string(out)))
+}
+
+// applyThemeOptions sets the theme's options on a tmux session and its
+// windows, and hooks new windows so they get the window options too.
+func applyThemeOptions(tmuxSession string, options []themeOption) {
+	var windows []string
+	if out, err := runTmux("list-windows", "-t", tmuxSession, "-F", "#{window_id}"); err == nil {
+		windows = strings.Fields(out)
+	}
+	for _, o := range options {
+		if !o.Window {
+			setThemeOption("-t", tmuxSession, o.Name, o.Value)
+			continue
+		}
+		for _, window := range windows {
+			setThemeOption("-w", "-t", window, o.Name, o.Value)
+		}
+	}
+
+	var hook []string
+	for _, o := range options {
+		if _, skip := unsupportedTmuxOptions.Load(o.Name); o.Window && !skip {
+			hook = append(hook, fmt.Sprintf("set-option -w %s '%s'", o.Name, o.Value))
+		}
+	}
+	if out, err := tmuxCmd("set-hook", "-t", tmuxSession, "after-new-window", strings.Join(hook, " ; ")).CombinedOutput(); err != nil {
+		log.Printf("[Terminal] tmux set-hook warning: %v (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+}
+
+// resetThemeOptions drops the theme's options from a tmux session, so it
+// falls back to the tmux config.
+func resetThemeOptions(tmuxSession string, options []themeOption) {
+	var windows []string
+	if out, err := runTmux("list-windows", "-t", tmuxSession, "-F", "#{window_id}"); err == nil {
+		windows = strings.Fields(out)
+	}
+	for _, o := range options {
+		if _, skip := unsupportedTmuxOptions.Load(o.Name); skip {
+			continue
+		}
+		if !o.Window {
+			tmuxCmd("set-option", "-u", "-t", tmuxSession, o.Name).Run()
+			continue
+		}
+		for _, window := range windows {
+			tmuxCmd("set-option", "-u", "-w", "-t", window, o.Name).Run()
+		}
+	}
+	tmuxCmd("set-hook", "-u", "-t", tmuxSession, "after-new-window").Run()
+}
+
+// applyStoredTheme themes a new tmux session with the stored theme, if any.
+func applyStoredTheme(tmuxSession string) {
+	theme, err := LoadTerminalTheme()
+	if err != nil {
+		log.Printf("[Terminal] Failed to load terminal theme: %v", err)
+		return
+	}
+	if theme == nil {
+		return
+	}
+	options, err := themeOptions(*theme)
+	if err != nil {
+		log.Printf("[Terminal] Stored terminal theme is invalid: %v", err)
+		return
+	}
+	applyThemeOptions(tmuxSession, options)
+}
+
+// themedSessions returns the mt-* tmux sessions.
+func themedSessions() []string {
+	out, err := runTmux("list-sessions", "-F", "#{session_name}")
+	if err != nil {
+		return nil // no tmux server
+	}
+	var sessions []string
+	for _, name := range strings.Fields(out) {
+		if strings.HasPrefix(name, "mt-") {
+			sessions = append(sessions, name)
+		}
+	}
+	return sessions
+}
+
+// SetTerminalTheme stores a theme and applies it to every mt-* session,
+// returning how many sessions were themed.
+func (tm *TerminalManager) SetTerminalTheme(theme TerminalTheme) (int, error) {
+	options, err := themeOptions(theme)
+	if err != nil {
+		return 0, err
+	}
+	if err := SaveTerminalTheme(theme); err != nil {
+		return 0, err
+	}
+	sessions := []string{}
+	if tmuxAvailable() {
+		sessions = themedSessions()
+	}
+	for _, name := range sessions {
+		applyThemeOptions(name, options)
+	}
+	log.Printf("[Terminal] Theme %s applied to %d tmux sessions", theme.ThemeID, len(sessions))
+	tm.themeChanged(&theme)
+	return len(sessions), nil
+}
+
+// ClearTerminalTheme removes the stored theme and its options from every
+// mt-* session.
+func (tm *TerminalManager) ClearTerminalTheme() error {
+	theme, err := LoadTerminalTheme()
+	if err != nil || theme == nil {
+		return err
+	}
+	if err := os.Remove(themePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if options, err := themeOptions(*theme); err == nil && tmuxAvailable() {
+		for _, name := range themedSessions() {
+			resetThemeOptions(name, options)
+		}
+	}
+	tm.themeChanged(nil)
+	return nil
+}
+
+// themeChanged tells all clients which theme tmux is using.
+func (tm *TerminalManager) themeChanged(theme *TerminalTheme) {
+	if tm.broadcastAllFunc != nil {
+		tm.broadcastAllFunc(map[string]interface{}{
+			"type":  "terminal-theme",
+			"theme": theme,
+		})
+	}
+}
+
+// --- HTTP Handlers ---
+
+// TerminalThemeGet handles GET /api/terminal/theme - the stored theme
+func TerminalThemeGet(w http.ResponseWriter, r *http.Request) {
+	theme, err := LoadTerminalTheme()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"theme": theme})
+}
+
+// TerminalThemeSet handles POST /api/terminal/theme - apply the app theme
+// to tmux
+func TerminalThemeSet(w http.ResponseWriter, r *http.Request) {
+	var theme TerminalTheme
+	if err := json.NewDecoder(r.Body).Decode(&theme); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if _, err := themeOptions(theme); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	n, err := GetTerminalManager().SetTerminalTheme(theme)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "sessions": n})
+}
+
+// TerminalThemeClear handles DELETE /api/terminal/theme - back to the tmux
+// config's colors
+func TerminalThemeClear(w http.ResponseWriter, r *http.Request) {
+	if err := GetTerminalManager().ClearTerminalTheme(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
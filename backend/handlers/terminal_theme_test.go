@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---- Theme sync tests ----
+
+func TestThemeOptions_ColorsAndTranslucency(t *testing.T) {
+	theme := TerminalTheme{
+		Background: "#ffffff",
+		Palette: TerminalPalette{
+			Foreground: "#e0e0e0", SelectionBackground: "rgba(0, 0, 255, 0.5)",
+			Black: "#111", Yellow: "#ffcc00", Blue: "rgb(0, 128, 255)", Magenta: "#ff00ff",
+			Cyan: "#00ffff", White: "#cccccc", BrightBlack: "#555555",
+		},
+	}
+	options, err := themeOptions(theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]themeOption)
+	for _, o := range options {
+		values[o.Name] = o
+	}
+	if got := values["status-style"]; got.Value != "bg=#111111,fg=#e0e0e0" || got.Window {
+		t.Errorf("status-style = %+v", got)
+	}
+	// Half-transparent blue over the white page
+	if got := values["mode-style"]; got.Value != "bg=#8080ff,fg=#e0e0e0" || !got.Window {
+		t.Errorf("mode-style = %+v", got)
+	}
+	if got := values["pane-active-border-style"].Value; got != "fg=#0080ff" {
+		t.Errorf("pane-active-border-style = %q", got)
+	}
+
+	theme.Palette.Blue = "blue"
+	if _, err := themeOptions(theme); err == nil || !strings.Contains(err.Error(), "palette.blue") {
+		t.Errorf("expected a palette.blue error, got %v", err)
+	}
+	for _, bad := range []string{"", "#12345", "rgb(256, 0, 0)", "rgba(0, 0, 0, 2)"} {
+		if _, _, err := parseCSSColor(bad); err == nil {
+			t.Errorf("parseCSSColor(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"markdown-themes-backend/utils"
+)
+
+// listenConfig describes where the server accepts connections.
+//
+//	BIND_ADDR    TCP address to bind (default 127.0.0.1; "0.0.0.0" for all interfaces)
+//	UNIX_SOCKET  Also serve on this Unix domain socket path
+//	SOCKET_MODE  Octal permissions for the socket (default 0600)
+//	TLS          "1" to serve HTTPS on the TCP listener
+//	TLS_CERT     Certificate file (implies TLS); a self-signed one is generated if unset
+//	TLS_KEY      Private key file for TLS_CERT
+type listenConfig struct {
+	BindAddr   string
+	Port       string
+	UnixSocket string
+	SocketMode os.FileMode
+	TLS        bool
+	TLSCert    string
+	TLSKey     string
+}
+
+// loadListenConfig reads the listener configuration from the environment.
+func loadListenConfig(port string) (listenConfig, error) {
+	cfg := listenConfig{
+		BindAddr:   os.Getenv("BIND_ADDR"),
+		Port:       port,
+		UnixSocket: os.Getenv("UNIX_SOCKET"),
+		SocketMode: 0600,
+		TLSCert:    os.Getenv("TLS_CERT"),
+		TLSKey:     os.Getenv("TLS_KEY"),
+	}
+	if cfg.BindAddr == "" {
+		cfg.BindAddr = "127.0.0.1"
+	}
+
+	if mode := os.Getenv("SOCKET_MODE"); mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SOCKET_MODE %q: %w", mode, err)
+		}
+		cfg.SocketMode = os.FileMode(parsed)
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return cfg, fmt.Errorf("TLS_CERT and TLS_KEY must be set together")
+	}
+	cfg.TLS = cfg.TLSCert != "" || os.Getenv("TLS") == "1" || os.Getenv("TLS") == "true"
+
+	return cfg, nil
+}
+
+// scheme returns the URL scheme of the TCP listener.
+func (cfg listenConfig) scheme() string {
+	if cfg.TLS {
+		return "https"
+	}
+	return "http"
+}
+
+// openListeners opens the TCP listener (TLS-wrapped if configured) and the
+// optional Unix socket listener.
+func openListeners(cfg listenConfig) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	tcp, err := net.Listen("tcp", net.JoinHostPort(cfg.BindAddr, cfg.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s:%s: %w", cfg.BindAddr, cfg.Port, err)
+	}
+	if cfg.TLS {
+		tlsConfig, err := loadTLSConfig(cfg)
+		if err != nil {
+			tcp.Close()
+			return nil, err
+		}
+		tcp = tls.NewListener(tcp, tlsConfig)
+	}
+	listeners = append(listeners, tcp)
+
+	if cfg.UnixSocket != "" {
+		unix, err := listenUnix(cfg.UnixSocket, cfg.SocketMode)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, unix)
+	}
+
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket file
+// left by a previous run, and restricts it to mode.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace %s: not a socket", path)
+		}
+		// A live server answers; a stale socket refuses the connection
+		if conn, err := net.DialTimeout("unix", path, 500*time.Millisecond); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// Restrict the socket before anything is served on it (the umask is
+	// process-wide, so it can't be narrowed just for this file)
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set mode on %s: %w", path, err)
+	}
+	// Go removes the socket file when the listener is closed
+	return l, nil
+}
+
+// loadTLSConfig loads the configured certificate, or a self-signed one
+// stored in the data directory (generated on first use or after expiry).
+func loadTLSConfig(cfg listenConfig) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if certFile == "" {
+		dir := filepath.Join(utils.DataDir(), "tls")
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile = filepath.Join(dir, "key.pem")
+		if !certValid(certFile) {
+			if err := generateSelfSignedCert(certFile, keyFile, cfg.BindAddr); err != nil {
+				return nil, err
+			}
+			log.Printf("Generated self-signed TLS certificate: %s", certFile)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// certValid reports whether certFile holds a certificate valid for at least
+// another day.
+func certValid(certFile string) bool {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	return time.Now().Add(24 * time.Hour).Before(cert.NotAfter)
+}
+
+// generateSelfSignedCert writes a one-year ECDSA certificate for localhost,
+// the loopback addresses and bindAddr.
+func generateSelfSignedCert(certFile, keyFile, bindAddr string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "markdown-themes", Organization: []string{"markdown-themes (self-signed)"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(bindAddr); ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode TLS key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write TLS key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write TLS certificate: %w", err)
+	}
+	return nil
+}
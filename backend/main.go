@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,6 +24,11 @@ import (
 )
 
 func main() {
+	// Subcommands (mt open ...) are clients of a running server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Generate per-startup auth token
 	if err := auth.Init(); err != nil {
 		log.Fatalf("Failed to initialize auth token: %v", err)
@@ -40,25 +47,38 @@ func main() {
 		port = "8130"
 	}
 
+	// Listeners: bind address, optional Unix socket and TLS
+	listenCfg, err := loadListenConfig(port)
+	if err != nil {
+		log.Fatalf("Invalid listener configuration: %v", err)
+	}
+
+	// Explicit browser origins allowed to call the API and open the WebSocket
+	auth.InitOrigins(port)
+
 	// Create router
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:*", "http://127.0.0.1:*"},
+	// Previews answer CORS and origin checks themselves: their pages are
+	// sandboxed into an opaque origin
+	r.Use(handlers.SkipPreview(cors.Handler(cors.Options{
+		AllowedOrigins:   auth.AllowedOrigins(),
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Auth-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Auth-Token", auth.CSRFHeader},
 		ExposedHeaders:   []string{"Link", "X-Output-File"},
 		AllowCredentials: true,
 		MaxAge:           300,
-	}))
+	})))
+	// Origin allow-list and CSRF check for state-changing requests
+	r.Use(handlers.SkipPreview(auth.Protect))
 
 	// JSON content type for API responses (except WebSocket, SSE, and file-serving endpoints)
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path != "/ws" && r.URL.Path != "/api/files/raw" && !strings.HasPrefix(r.URL.Path, "/api/files/serve/") && !strings.HasPrefix(r.URL.Path, "/api/tts/") && !(r.URL.Path == "/api/chat" && r.Method == "POST") {
+			if servesJSON(r) {
 				w.Header().Set("Content-Type", "application/json")
 			}
 			next.ServeHTTP(w, r)
@@ -71,6 +91,13 @@ func main() {
 
 	// Routes
 	r.Route("/api", func(r chi.Router) {
+		// Every state-changing route that starts, stops or signals a process
+		// (commands, tasks, the Claude CLI, git, the editor, terminal windows
+		// and panes) or configures how they run (limits, profiles, theme,
+		// audit, recording) also requires the auth token, whatever the
+		// request's origin
+		withToken := r.With(auth.RequireToken)
+
 		// Auth
 		r.Get("/auth/token", handlers.AuthToken)
 
@@ -83,20 +110,43 @@ func main() {
 		r.Get("/files/audio", handlers.FileMedia)
 		r.Get("/files/raw", handlers.FileRaw)
 		r.Get("/files/serve/*", handlers.ServeFile)
-		r.Post("/files/open", handlers.FileOpen)
+		withToken.Post("/files/open", handlers.FileOpen)
+
+		// Share links (signed, expiring, read-only)
+		r.Get("/shares", handlers.SharesList)
+		r.Post("/shares", handlers.ShareCreate)
+		r.Delete("/shares/{id}", handlers.ShareRevoke)
+
+		// Command runner (non-interactive exec)
+		withToken.Post("/exec", handlers.ExecStart)
+		r.Get("/exec/history", handlers.ExecHistory)
+		r.Get("/exec/{id}", handlers.ExecGet)
+		r.Get("/exec/{id}/stream", handlers.ExecStream)
+		withToken.Delete("/exec/{id}", handlers.ExecCancel)
+
+		// Task runner (long-running project processes)
+		r.Get("/tasks", handlers.TasksList)
+		withToken.Post("/tasks/{name}/start", handlers.TaskStart)
+		withToken.Post("/tasks/{name}/stop", handlers.TaskStop)
+		withToken.Post("/tasks/{name}/restart", handlers.TaskRestart)
+		r.Get("/tasks/{name}/logs", handlers.TaskLogs)
+
+		// Process limits
+		r.Get("/processes/limits", handlers.ProcessLimitSettings)
+		withToken.Post("/processes/limits", handlers.SaveProcessLimitSettings)
 
 		// Claude
 		r.Get("/claude/session", handlers.ClaudeSession)
 		r.Get("/claude/session/{sessionId}", handlers.ClaudeSessionByID)
 
 		// Notepad (lightweight non-streaming Claude CLI)
-		r.Post("/notepad", handlers.NotepadSend)
-		r.Delete("/notepad", handlers.NotepadStop)
+		withToken.Post("/notepad", handlers.NotepadSend)
+		withToken.Delete("/notepad", handlers.NotepadStop)
 
 		// Chat (AI conversations via Claude CLI)
-		r.Post("/chat", handlers.Chat)
+		withToken.Post("/chat", handlers.Chat)
 		r.Get("/chat/process", handlers.ChatProcessStatus)
-		r.Delete("/chat/process", handlers.ChatProcessKill)
+		withToken.Delete("/chat/process", handlers.ChatProcessKill)
 
 		// Conversation persistence (SQLite)
 		r.Get("/chat/conversations", handlers.ConversationsList)
@@ -112,19 +162,56 @@ func main() {
 		r.Get("/git/diff", handlers.GitDiff)
 
 		// Git repo operations
-		r.Post("/git/repos/{repo}/stage", handlers.GitRepoStage)
-		r.Post("/git/repos/{repo}/unstage", handlers.GitRepoUnstage)
-		r.Post("/git/repos/{repo}/commit", handlers.GitRepoCommit)
-		r.Post("/git/repos/{repo}/push", handlers.GitRepoPush)
-		r.Post("/git/repos/{repo}/pull", handlers.GitRepoPull)
-		r.Post("/git/repos/{repo}/fetch", handlers.GitRepoFetch)
-		r.Post("/git/repos/{repo}/discard", handlers.GitRepoDiscard)
-		r.Post("/git/repos/{repo}/generate-message", handlers.GitRepoGenerateMessage)
+		withToken.Post("/git/repos/{repo}/stage", handlers.GitRepoStage)
+		withToken.Post("/git/repos/{repo}/unstage", handlers.GitRepoUnstage)
+		withToken.Post("/git/repos/{repo}/commit", handlers.GitRepoCommit)
+		withToken.Post("/git/repos/{repo}/push", handlers.GitRepoPush)
+		withToken.Post("/git/repos/{repo}/pull", handlers.GitRepoPull)
+		withToken.Post("/git/repos/{repo}/fetch", handlers.GitRepoFetch)
+		withToken.Post("/git/repos/{repo}/discard", handlers.GitRepoDiscard)
+		withToken.Post("/git/repos/{repo}/generate-message", handlers.GitRepoGenerateMessage)
 
 		// Terminal
 		r.Get("/terminal/list", handlers.TerminalList)
+		r.Get("/terminal/processes", handlers.TerminalProcesses)
+		r.Get("/terminal/ports", handlers.TerminalPorts)
+		r.Get("/terminal/groups", handlers.TerminalGroups)
+		r.Get("/terminal/audit", handlers.TerminalAudit)
+		r.Get("/terminal/audit/settings", handlers.TerminalAuditSettings)
+		withToken.Post("/terminal/audit/settings", handlers.SaveTerminalAuditSettings)
+		r.Get("/terminal/theme", handlers.TerminalThemeGet)
+		withToken.Post("/terminal/theme", handlers.TerminalThemeSet)
+		withToken.Delete("/terminal/theme", handlers.TerminalThemeClear)
 		r.Get("/terminal/profiles", handlers.TerminalProfiles)
-		r.Post("/terminal/profiles", handlers.SaveTerminalProfile)
+		withToken.Post("/terminal/profiles", handlers.SaveTerminalProfile)
+		r.Get("/terminal/history/{id}", handlers.TerminalHistory)
+		r.Get("/terminal/{id}/commands", handlers.TerminalCommands)
+		r.Get("/terminal/{id}/subscribers", handlers.TerminalSubscribers)
+		r.Get("/terminal/{id}/windows", handlers.TerminalWindows)
+		withToken.Post("/terminal/{id}/windows", handlers.TerminalWindowCreate)
+		withToken.Post("/terminal/{id}/windows/{window}/select", handlers.TerminalWindowSelect)
+		withToken.Delete("/terminal/{id}/windows/{window}", handlers.TerminalWindowKill)
+		withToken.Post("/terminal/{id}/panes/{pane}/split", handlers.TerminalPaneSplit)
+		withToken.Post("/terminal/{id}/panes/{pane}/select", handlers.TerminalPaneSelect)
+		withToken.Post("/terminal/{id}/panes/{pane}/resize", handlers.TerminalPaneResize)
+		withToken.Delete("/terminal/{id}/panes/{pane}", handlers.TerminalPaneKill)
+		r.Post("/terminal/{id}/resolve-link", handlers.TerminalResolveLink)
+		r.Get("/terminal/recordings", handlers.TerminalRecordings)
+		r.Get("/terminal/recordings/{name}", handlers.TerminalRecordingDownload)
+		withToken.Post("/terminal/{id}/recording", handlers.TerminalRecordingStart)
+		withToken.Delete("/terminal/{id}/recording", handlers.TerminalRecordingStop)
+
+		// Terminal automation (scripts, the mt CLI and integration tests;
+		// token required)
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireToken)
+			r.Post("/open", handlers.OpenFile)
+			r.Post("/terminal/sessions", handlers.TerminalAPISpawn)
+			r.Post("/terminal/{id}/send", handlers.TerminalAPISend)
+			r.Post("/terminal/{id}/wait", handlers.TerminalAPIWait)
+			r.Get("/terminal/{id}/screen", handlers.TerminalAPIScreen)
+			r.Delete("/terminal/{id}", handlers.TerminalAPIClose)
+		})
 
 		// Beads
 		r.Get("/beads/issues", handlers.BeadsIssues)
@@ -136,6 +223,13 @@ func main() {
 	// WebSocket
 	r.Get("/ws", hub.HandleWebSocket)
 
+	// Public share links (access is granted by the signed URL itself)
+	r.Get("/share/{id}/{expires}/{sig}/*", handlers.ShareServe)
+
+	// Dev servers running in terminals, for the HTML viewer
+	r.Handle("/preview/{port}", http.HandlerFunc(handlers.PreviewProxy))
+	r.Handle("/preview/{port}/*", http.HandlerFunc(handlers.PreviewProxy))
+
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -151,27 +245,74 @@ func main() {
 		handlers.GetTerminalManager().RecoverOrphanedSessions()
 	}()
 
-	log.Printf("markdown-themes backend starting on port %s", port)
-	log.Printf("API: http://localhost:%s/api", port)
-	log.Printf("WebSocket: ws://localhost:%s/ws", port)
+	listeners, err := openListeners(listenCfg)
+	if err != nil {
+		log.Fatalf("Failed to open listeners: %v", err)
+	}
 
-	srv := &http.Server{Addr: ":" + port, Handler: r}
+	base := fmt.Sprintf("%s://%s", listenCfg.scheme(), net.JoinHostPort(listenCfg.BindAddr, port))
+	log.Printf("markdown-themes backend starting on %s", base)
+	log.Printf("API: %s/api", base)
+	if listenCfg.UnixSocket != "" {
+		log.Printf("Unix socket: %s (mode %04o)", listenCfg.UnixSocket, listenCfg.SocketMode)
+	}
+
+	srv := &http.Server{Handler: r}
+
+	// Serve every listener from the same server; the first fatal error stops all.
+	serveErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			serveErr <- srv.Serve(l)
+		}(l)
+	}
 
 	// Graceful shutdown: on SIGINT/SIGTERM, close PTYs before exiting.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-quit
+	select {
+	case <-quit:
 		log.Println("Shutting down...")
-		handlers.GetTerminalManager().Shutdown()
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
+	case err := <-serveErr:
+		if err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
 		}
-	}()
+	}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+	handlers.GetTerminalManager().Shutdown()
+	handlers.StopAllTasks()
+	handlers.TerminateProcesses()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Shutdown closes all listeners (removing the Unix socket file)
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+}
+
+// rawResponsePrefixes are the paths whose handlers set their own content
+// type (file serving, recordings, proxies and share links).
+var rawResponsePrefixes = []string{
+	"/api/files/serve/",
+	"/api/tts/",
+	"/api/terminal/history/",
+	"/api/terminal/recordings/",
+	"/share/",
+	"/preview/",
+}
+
+// servesJSON reports whether the response to r defaults to JSON.
+func servesJSON(r *http.Request) bool {
+	switch {
+	case r.URL.Path == "/ws", r.URL.Path == "/api/files/raw":
+		return false
+	case r.URL.Path == "/api/chat" && r.Method == http.MethodPost: // SSE stream
+		return false
+	}
+	for _, prefix := range rawResponsePrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
 	}
+	return true
 }
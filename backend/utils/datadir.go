@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DataDir returns the app's data directory: markdown-themes under
+// $XDG_DATA_HOME, or ~/.local/share when that is unset.
+func DataDir() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "markdown-themes")
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+
+	"markdown-themes-backend/handlers"
+)
+
+// execMessage is the payload for exec-run / exec-cancel messages.
+type execMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"` // echoed back so the client can match the run
+	RunID     string `json:"runId,omitempty"`
+	handlers.ExecRequest
+}
+
+// handleExecMessage starts or cancels a command run. A started run's events
+// are delivered on the "exec:{runId}" topic, which the client is subscribed
+// to automatically.
+func (c *Client) handleExecMessage(raw []byte) {
+	var msg execMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Exec] Invalid message: %v", err)
+		return
+	}
+
+	switch msg.Type {
+	case "exec-run":
+		run, err := handlers.StartExec(msg.ExecRequest)
+		if err != nil {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":      "exec-error",
+				"requestId": msg.RequestID,
+				"error":     err.Error(),
+			})
+			return
+		}
+		c.hub.SendToClient(c, map[string]interface{}{
+			"type":      "exec-accepted",
+			"requestId": msg.RequestID,
+			"run":       run,
+		})
+		if err := c.hub.Subscribe(c, topicMessage{Type: "subscribe", Topic: "exec:" + run.ID}); err != nil {
+			log.Printf("[Exec] Failed to subscribe client to %s: %v", run.ID, err)
+		}
+
+	case "exec-cancel":
+		if err := handlers.CancelExec(msg.RunID); err != nil {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":  "exec-error",
+				"runId": msg.RunID,
+				"error": err.Error(),
+			})
+		}
+
+	default:
+		log.Printf("[Exec] Unknown message type: %s", msg.Type)
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"markdown-themes-backend/handlers"
+)
+
+// ---- Exec tests ----
+
+// readExecRun collects a run's stdout from the exec topic until it exits,
+// failing if an event is missing, repeated or out of order.
+func readExecRun(t *testing.T, c *Client, runID string) string {
+	t.Helper()
+	var stdout strings.Builder
+	nextID := 0.0
+	for {
+		ev := nextMessage(t, c, "topic-event")
+		if ev["topic"] != "exec:"+runID {
+			continue
+		}
+		buffered := ev["data"].(map[string]interface{})
+		if id := buffered["id"].(float64); id != nextID {
+			t.Fatalf("client %s: event id %v, want %v", c.id, id, nextID)
+		}
+		nextID++
+
+		data := buffered["data"].(map[string]interface{})
+		switch data["type"] {
+		case "exec-output":
+			stdout.WriteString(data["data"].(string))
+		case "exec-exit":
+			return stdout.String()
+		}
+	}
+}
+
+func TestExec_RunEventsDeliveredOnceInOrder(t *testing.T) {
+	h := newTestHub(t)
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+
+	// One write per line, so a run produces a steady stream of events
+	const lines = 2000
+	req := handlers.ExecRequest{
+		Command: fmt.Sprintf("i=1; while [ $i -le %d ]; do echo $i; i=$((i+1)); done", lines),
+		Cwd:     t.TempDir(),
+	}
+	var want strings.Builder
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&want, "%d\n", i)
+	}
+
+	// exec-run subscribes the client to its run
+	raw, _ := json.Marshal(execMessage{Type: "exec-run", ExecRequest: req})
+	a.handleExecMessage(raw)
+	runA := nextMessage(t, a, "exec-accepted")["run"].(map[string]interface{})["id"].(string)
+
+	// b subscribes to another run while it is still writing
+	runB, err := handlers.StartExec(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writing := func() bool {
+		for _, run := range handlers.ListExecRuns(req.Cwd) {
+			if run.ID == runB.ID {
+				return run.StdoutBytes > 0
+			}
+		}
+		return false
+	}
+	for deadline := time.Now().Add(2 * time.Second); !writing(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("run produced no output")
+		}
+	}
+	if err := h.Subscribe(b, topicMessage{Topic: "exec", Params: map[string]string{"runId": runB.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readExecRun(t, a, runA); got != want.String() {
+		t.Errorf("exec-run: stdout is %d bytes, want %d", len(got), want.Len())
+	}
+	if got := readExecRun(t, b, runB.ID); got != want.String() {
+		t.Errorf("subscribed mid-run: stdout is %d bytes, want %d", len(got), want.Len())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -23,9 +24,8 @@ func isValidPath(p string) bool {
 }
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for local dev
-	},
+	// Only configured browser origins (non-browser clients send none)
+	CheckOrigin: auth.CheckOrigin,
 }
 
 // Client represents a WebSocket connection
@@ -34,9 +34,17 @@ type Client struct {
 	conn *websocket.Conn
 	send chan []byte
 
+	// Closed once the hub has registered the client
+	registered chan struct{}
+
+	// Identity and what the client is viewing (guarded by mu)
+	id       string
+	presence Presence
+
 	// Subscriptions
 	watchedFiles      map[string]bool
 	watchedWorkspaces map[string]bool
+	topics            map[string]bool
 	mu                sync.Mutex
 }
 
@@ -52,6 +60,10 @@ type Hub struct {
 	// File watcher
 	watcher *FileWatcher
 
+	// Pub/sub topics: key ("git-status:/repo") -> running topic
+	topics   map[string]*topic
+	topicsMu sync.Mutex
+
 	mu sync.RWMutex
 }
 
@@ -61,6 +73,7 @@ func NewHub() *Hub {
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		topics:     make(map[string]*topic),
 	}
 	h.watcher = NewFileWatcher(h)
 
@@ -91,6 +104,14 @@ func NewHub() *Hub {
 		}
 	})
 
+	tm.SetSessionEventFunc(func(sessionID string, message interface{}) {
+		for _, c := range tm.GetClients(sessionID) {
+			if client, ok := c.(*Client); ok {
+				h.SendToClient(client, message)
+			}
+		}
+	})
+
 	// Wire up broadcast-to-all for terminal recovery notifications
 	tm.SetBroadcastAllFunc(func(message interface{}) {
 		h.BroadcastAll(message)
@@ -107,11 +128,28 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
+			close(client.registered)
+			h.publishPresence(client)
 			log.Printf("[Hub] Client connected, total: %d", len(h.clients))
 
 		case client := <-h.unregister:
+			// Clean up terminal subscriptions and playbacks first, outside
+			// h.mu: their senders may need it (SendToClient on a full buffer).
+			handlers.GetTerminalManager().RemoveAllClientSessions(client)
+
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
+			// Collect topic subscriptions, also of clients already dropped
+			// by SendToClient for a full buffer. Subscribe adds them under
+			// h.mu, so none are added after this.
+			client.mu.Lock()
+			topicKeys := make([]string, 0, len(client.topics))
+			for key := range client.topics {
+				topicKeys = append(topicKeys, key)
+			}
+			client.mu.Unlock()
+
+			_, registered := h.clients[client]
+			if registered {
 				// Clean up file watches for this client
 				client.mu.Lock()
 				for path := range client.watchedFiles {
@@ -122,13 +160,18 @@ func (h *Hub) Run() {
 				}
 				client.mu.Unlock()
 
-				// Clean up terminal subscriptions
-				handlers.GetTerminalManager().RemoveAllClientSessions(client)
-
 				delete(h.clients, client)
 				close(client.send)
 			}
 			h.mu.Unlock()
+
+			// Providers stop outside h.mu: their stop may call into the hub
+			for _, key := range topicKeys {
+				h.Unsubscribe(client, key)
+			}
+			if registered {
+				h.clientLeft(client)
+			}
 			log.Printf("[Hub] Client disconnected, total: %d", len(h.clients))
 		}
 	}
@@ -181,8 +224,8 @@ type IncomingMessage struct {
 
 // HandleWebSocket upgrades HTTP connection to WebSocket
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Validate auth token (generated per startup)
-	token := r.URL.Query().Get("token")
+	// Validate auth token (generated per startup): query param or auth cookie
+	token, _ := auth.RequestToken(r)
 	if !auth.Validate(token) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -194,18 +237,23 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	id := newClientID()
 	client := &Client{
 		hub:               h,
 		conn:              conn,
 		send:              make(chan []byte, 256),
+		registered:        make(chan struct{}),
+		id:                id,
+		presence:          Presence{ClientID: id, Name: r.URL.Query().Get("name"), UpdatedAt: time.Now().UnixMilli()},
 		watchedFiles:      make(map[string]bool),
 		watchedWorkspaces: make(map[string]bool),
+		topics:            make(map[string]bool),
 	}
 
 	h.register <- client
 
 	// Send connected message
-	h.SendToClient(client, map[string]string{"type": "connected"})
+	h.SendToClient(client, map[string]string{"type": "connected", "clientId": id})
 
 	// Start read/write pumps
 	go client.writePump()
@@ -218,6 +266,9 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
+	// Messages may subscribe the client, which must be registered by then
+	<-c.registered
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -242,6 +293,30 @@ func (c *Client) readPump() {
 			continue
 		}
 
+		// Route pub/sub topic messages
+		if msg.Type == "subscribe" || msg.Type == "unsubscribe" {
+			c.handleTopicMessage(message)
+			continue
+		}
+
+		// Route command runner messages
+		if strings.HasPrefix(msg.Type, "exec-") {
+			c.handleExecMessage(message)
+			continue
+		}
+
+		// Route task runner messages
+		if strings.HasPrefix(msg.Type, "task-") {
+			c.handleTaskMessage(message)
+			continue
+		}
+
+		// Route presence/follow messages
+		if strings.HasPrefix(msg.Type, "presence-") {
+			c.handlePresenceMessage(message)
+			continue
+		}
+
 		c.handleMessage(msg)
 	}
 }
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// ---- helpers ----
+
+// newTestHub starts a hub for the test.
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	h := NewHub()
+	go h.Run()
+	return h
+}
+
+// connectTestClient registers a client without a connection; its messages
+// are read from client.send.
+func connectTestClient(t *testing.T, h *Hub, name string) *Client {
+	t.Helper()
+	id := newClientID()
+	c := &Client{
+		hub:               h,
+		send:              make(chan []byte, 4096), // room for a whole test run
+		registered:        make(chan struct{}),
+		id:                id,
+		presence:          Presence{ClientID: id, Name: name},
+		watchedFiles:      make(map[string]bool),
+		watchedWorkspaces: make(map[string]bool),
+		topics:            make(map[string]bool),
+	}
+	h.register <- c
+	<-c.registered
+	return c
+}
+
+// nextMessage returns the client's next message of the given type,
+// skipping others.
+func nextMessage(t *testing.T, c *Client, msgType string) map[string]interface{} {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				t.Fatalf("client %s: connection closed waiting for %s", c.id, msgType)
+			}
+			var msg map[string]interface{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg["type"] == msgType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("client %s: no %s message", c.id, msgType)
+		}
+	}
+}
+
+// noMessage fails if the client receives a message of the given type
+// within a short wait.
+func noMessage(t *testing.T, c *Client, msgType string) {
+	t.Helper()
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case data := <-c.send:
+			var msg map[string]interface{}
+			json.Unmarshal(data, &msg)
+			if msg["type"] == msgType {
+				t.Fatalf("client %s: unexpected %s: %s", c.id, msgType, data)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Presence describes what a connected client is currently looking at.
+// Clients publish it with presence-update; other clients can list it and
+// follow a leader so their viewer tracks the leader's file and position.
+type Presence struct {
+	ClientID   string  `json:"clientId"`
+	Name       string  `json:"name,omitempty"`
+	File       string  `json:"file,omitempty"`
+	Anchor     string  `json:"anchor,omitempty"`    // heading slug or element id nearest the top of the viewport
+	ScrollTop  float64 `json:"scrollTop,omitempty"` // scroll position as a fraction of the document (0..1)
+	TerminalID string  `json:"terminalId,omitempty"`
+	Following  string  `json:"following,omitempty"` // clientId of the leader this client follows
+	UpdatedAt  int64   `json:"updatedAt"`
+}
+
+// presenceMessage is the payload for presence-* WebSocket messages.
+type presenceMessage struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name,omitempty"`
+	File       string  `json:"file,omitempty"`
+	Anchor     string  `json:"anchor,omitempty"`
+	ScrollTop  float64 `json:"scrollTop,omitempty"`
+	TerminalID string  `json:"terminalId,omitempty"`
+	ClientID   string  `json:"clientId,omitempty"` // leader for presence-follow
+}
+
+// newClientID returns a short random identifier for a WebSocket client.
+func newClientID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// snapshotPresence returns a copy of the client's presence. Caller must NOT hold c.mu.
+func (c *Client) snapshotPresence() Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.presence
+}
+
+// ClientID returns the client's identifier (handlers.TerminalClient).
+func (c *Client) ClientID() string {
+	return c.id
+}
+
+// ClientName returns the client's display name (handlers.TerminalClient).
+func (c *Client) ClientName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.presence.Name
+}
+
+// findClient returns the connected client with the given ID, or nil.
+func (h *Hub) findClient(id string) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.id == id {
+			return client
+		}
+	}
+	return nil
+}
+
+// listPresence returns the presence of every connected client.
+func (h *Hub) listPresence() []Presence {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	result := make([]Presence, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, client.snapshotPresence())
+	}
+	return result
+}
+
+// followersOf returns the clients currently following the given leader.
+func (h *Hub) followersOf(leaderID string) []*Client {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	var followers []*Client
+	for _, client := range clients {
+		if client.snapshotPresence().Following == leaderID {
+			followers = append(followers, client)
+		}
+	}
+	return followers
+}
+
+// followChainReaches reports whether following leaderID from the given
+// client would create a cycle (the leader already follows the client,
+// directly or through other followers).
+func (h *Hub) followChainReaches(leaderID, clientID string) bool {
+	seen := make(map[string]bool)
+	current := leaderID
+	for current != "" && !seen[current] {
+		if current == clientID {
+			return true
+		}
+		seen[current] = true
+		leader := h.findClient(current)
+		if leader == nil {
+			return false
+		}
+		current = leader.snapshotPresence().Following
+	}
+	return false
+}
+
+// publishPresence notifies every client of a presence change and pushes the
+// leader's new position to its followers.
+func (h *Hub) publishPresence(client *Client) {
+	p := client.snapshotPresence()
+	h.BroadcastAll(map[string]interface{}{
+		"type":     "presence-changed",
+		"presence": p,
+	})
+	for _, follower := range h.followersOf(p.ClientID) {
+		h.SendToClient(follower, map[string]interface{}{
+			"type":   "presence-follow-update",
+			"leader": p,
+		})
+	}
+}
+
+// clientLeft announces a disconnected client and releases its followers.
+// Called from Run after the client was removed from the registry.
+func (h *Hub) clientLeft(client *Client) {
+	h.BroadcastAll(map[string]interface{}{
+		"type":     "presence-left",
+		"clientId": client.id,
+	})
+	for _, follower := range h.followersOf(client.id) {
+		follower.mu.Lock()
+		follower.presence.Following = ""
+		follower.mu.Unlock()
+		h.SendToClient(follower, map[string]interface{}{
+			"type":     "presence-follow-ended",
+			"leaderId": client.id,
+			"reason":   "leader disconnected",
+		})
+	}
+}
+
+// handlePresenceMessage processes presence-* messages from a client.
+func (c *Client) handlePresenceMessage(raw []byte) {
+	var msg presenceMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Presence] Invalid message: %v", err)
+		return
+	}
+
+	switch msg.Type {
+	case "presence-update":
+		if msg.File != "" && !isValidPath(msg.File) {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":  "presence-error",
+				"error": "invalid file path",
+			})
+			return
+		}
+		c.mu.Lock()
+		if msg.Name != "" {
+			c.presence.Name = msg.Name
+		}
+		c.presence.File = msg.File
+		c.presence.Anchor = msg.Anchor
+		c.presence.ScrollTop = msg.ScrollTop
+		c.presence.TerminalID = msg.TerminalID
+		c.presence.UpdatedAt = time.Now().UnixMilli()
+		c.mu.Unlock()
+		c.hub.publishPresence(c)
+
+	case "presence-list":
+		c.hub.SendToClient(c, map[string]interface{}{
+			"type":    "presence-list",
+			"self":    c.id,
+			"clients": c.hub.listPresence(),
+		})
+
+	case "presence-follow":
+		leader := c.hub.findClient(msg.ClientID)
+		if leader == nil || leader == c {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":     "presence-follow-error",
+				"clientId": msg.ClientID,
+				"error":    "leader not found",
+			})
+			return
+		}
+		if c.hub.followChainReaches(leader.id, c.id) {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":     "presence-follow-error",
+				"clientId": msg.ClientID,
+				"error":    "leader is already following this client",
+			})
+			return
+		}
+		c.mu.Lock()
+		c.presence.Following = leader.id
+		c.presence.UpdatedAt = time.Now().UnixMilli()
+		c.mu.Unlock()
+
+		// Jump straight to the leader's current position.
+		c.hub.SendToClient(c, map[string]interface{}{
+			"type":   "presence-follow-update",
+			"leader": leader.snapshotPresence(),
+		})
+		c.hub.publishPresence(c)
+		log.Printf("[Presence] Client %s now following %s", c.id, leader.id)
+
+	case "presence-unfollow":
+		c.mu.Lock()
+		leaderID := c.presence.Following
+		c.presence.Following = ""
+		c.presence.UpdatedAt = time.Now().UnixMilli()
+		c.mu.Unlock()
+		if leaderID == "" {
+			return
+		}
+		c.hub.SendToClient(c, map[string]interface{}{
+			"type":     "presence-follow-ended",
+			"leaderId": leaderID,
+			"reason":   "unfollowed",
+		})
+		c.hub.publishPresence(c)
+
+	default:
+		log.Printf("[Presence] Unknown message type: %s", msg.Type)
+	}
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// ---- Presence tests ----
+
+// sendPresence feeds a presence-* message to the client as if it came from
+// its connection.
+func sendPresence(t *testing.T, c *Client, msg presenceMessage) {
+	t.Helper()
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handlePresenceMessage(raw)
+}
+
+// nextPresenceOf returns the next presence-changed the client receives
+// about the given client, skipping announcements of other clients.
+func nextPresenceOf(t *testing.T, c *Client, clientID string) map[string]interface{} {
+	t.Helper()
+	for {
+		p := nextMessage(t, c, "presence-changed")["presence"].(map[string]interface{})
+		if p["clientId"] == clientID {
+			return p
+		}
+	}
+}
+
+func TestPresence_UpdateAndList(t *testing.T) {
+	h := newTestHub(t)
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+
+	sendPresence(t, a, presenceMessage{Type: "presence-update", Name: "alice", File: "/docs/readme.md", Anchor: "intro", ScrollTop: 0.5})
+	p := nextPresenceOf(t, b, a.id)
+	if p["name"] != "alice" || p["file"] != "/docs/readme.md" || p["anchor"] != "intro" {
+		t.Errorf("presence-changed = %v", p)
+	}
+
+	sendPresence(t, a, presenceMessage{Type: "presence-update", File: "../etc/passwd"})
+	if msg := nextMessage(t, a, "presence-error"); msg["error"] != "invalid file path" {
+		t.Errorf("presence-error = %v", msg)
+	}
+	noMessage(t, b, "presence-changed")
+
+	sendPresence(t, b, presenceMessage{Type: "presence-list"})
+	list := nextMessage(t, b, "presence-list")
+	if list["self"] != b.id || len(list["clients"].([]interface{})) != 2 {
+		t.Errorf("presence-list = %v", list)
+	}
+}
+
+func TestPresence_Follow(t *testing.T) {
+	h := newTestHub(t)
+	a, b, c := connectTestClient(t, h, "a"), connectTestClient(t, h, "b"), connectTestClient(t, h, "c")
+
+	sendPresence(t, a, presenceMessage{Type: "presence-update", File: "/docs/a.md"})
+	sendPresence(t, b, presenceMessage{Type: "presence-follow", ClientID: a.id})
+	if msg := nextMessage(t, b, "presence-follow-update"); msg["leader"].(map[string]interface{})["file"] != "/docs/a.md" {
+		t.Errorf("initial follow update = %v", msg)
+	}
+
+	// The follower tracks the leader's moves
+	sendPresence(t, a, presenceMessage{Type: "presence-update", File: "/docs/b.md", Anchor: "usage"})
+	if msg := nextMessage(t, b, "presence-follow-update"); msg["leader"].(map[string]interface{})["anchor"] != "usage" {
+		t.Errorf("follow update = %v", msg)
+	}
+	noMessage(t, c, "presence-follow-update")
+
+	// Following back, directly or through a chain, is a cycle
+	sendPresence(t, c, presenceMessage{Type: "presence-follow", ClientID: b.id})
+	nextMessage(t, c, "presence-follow-update")
+	sendPresence(t, a, presenceMessage{Type: "presence-follow", ClientID: c.id})
+	if msg := nextMessage(t, a, "presence-follow-error"); msg["error"] != "leader is already following this client" {
+		t.Errorf("cycle = %v", msg)
+	}
+	sendPresence(t, a, presenceMessage{Type: "presence-follow", ClientID: "nope"})
+	if msg := nextMessage(t, a, "presence-follow-error"); msg["error"] != "leader not found" {
+		t.Errorf("unknown leader = %v", msg)
+	}
+
+	sendPresence(t, c, presenceMessage{Type: "presence-unfollow"})
+	if msg := nextMessage(t, c, "presence-follow-ended"); msg["reason"] != "unfollowed" {
+		t.Errorf("unfollow = %v", msg)
+	}
+	if c.snapshotPresence().Following != "" {
+		t.Error("still following after unfollow")
+	}
+}
+
+func TestPresence_LeaderLeaving(t *testing.T) {
+	h := newTestHub(t)
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+
+	sendPresence(t, b, presenceMessage{Type: "presence-follow", ClientID: a.id})
+	nextMessage(t, b, "presence-follow-update")
+
+	h.unregister <- a
+	if msg := nextMessage(t, b, "presence-left"); msg["clientId"] != a.id {
+		t.Errorf("presence-left = %v", msg)
+	}
+	msg := nextMessage(t, b, "presence-follow-ended")
+	if msg["leaderId"] != a.id || msg["reason"] != "leader disconnected" {
+		t.Errorf("presence-follow-ended = %v", msg)
+	}
+	if b.snapshotPresence().Following != "" {
+		t.Error("follower still following a disconnected leader")
+	}
+}
@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+
+	"markdown-themes-backend/handlers"
+)
+
+// taskMessage is the payload for task-start / task-stop / task-restart
+// messages.
+type taskMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"` // echoed back in task-error
+	Workspace string `json:"workspace"`
+	Name      string `json:"name"`
+}
+
+// handleTaskMessage starts, stops or restarts a task. Status changes and
+// output are delivered on the "tasks:{workspace}" topic.
+func (c *Client) handleTaskMessage(raw []byte) {
+	var msg taskMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Tasks] Invalid message: %v", err)
+		return
+	}
+
+	var action func(workspace, name string) (*handlers.TaskStatus, error)
+	switch msg.Type {
+	case "task-start":
+		action = handlers.StartTask
+	case "task-stop":
+		action = handlers.StopTask
+	case "task-restart":
+		action = handlers.RestartTask
+	default:
+		log.Printf("[Tasks] Unknown message type: %s", msg.Type)
+		return
+	}
+
+	// Restarting waits for the old process to exit; don't hold up the
+	// client's read loop meanwhile
+	go func() {
+		if _, err := action(msg.Workspace, msg.Name); err != nil {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":      "task-error",
+				"requestId": msg.RequestID,
+				"workspace": msg.Workspace,
+				"name":      msg.Name,
+				"error":     err.Error(),
+			})
+		}
+	}()
+}
@@ -0,0 +1,644 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"markdown-themes-backend/handlers"
+	"markdown-themes-backend/utils"
+)
+
+// TopicProvider produces server-side events for one topic family
+// (e.g. "git-status"). Start is called when the first client subscribes to
+// a topic instance and must call publish for every event, never synchronously
+// from Start itself (subscribers are only told they are subscribed once
+// Start returns); the returned stop function is called when the last
+// subscriber leaves. Neither is called with hub locks held.
+type TopicProvider struct {
+	// KeyParam is the parameter that identifies a topic instance:
+	// "git-status:{repo}" uses "repo". Empty for singleton topics.
+	KeyParam string
+	// Snapshot providers publish full state, so the last event is replayed
+	// to clients that subscribe to an already-running topic.
+	Snapshot bool
+	Start    func(params map[string]string, publish func(data interface{})) (stop func(), err error)
+}
+
+// topicProviders lists the topic families clients can subscribe to.
+var topicProviders = map[string]TopicProvider{
+	"git-status":      {KeyParam: "repo", Snapshot: true, Start: startGitStatusTopic},
+	"beads":           {KeyParam: "path", Snapshot: true, Start: startBeadsTopic},
+	"chat":            {KeyParam: "conversationId", Start: startChatTopic},
+	"exec":            {KeyParam: "runId", Start: startExecTopic},
+	"tasks":           {KeyParam: "workspace", Start: startTasksTopic},
+	"claude-sessions": {Snapshot: true, Start: startClaudeSessionsTopic},
+	"terminal-pane":   {KeyParam: "pane", Start: startTerminalPaneTopic},
+}
+
+// topic is a running topic instance shared by all of its subscribers.
+type topic struct {
+	key      string
+	snapshot bool
+	clients  map[*Client]bool
+	last     []byte // last published message (snapshot topics only)
+
+	// Closed once the provider's Start has returned; stop and err are set
+	// by then (guarded by topicsMu)
+	started chan struct{}
+	stop    func()
+	err     error
+}
+
+// topicMessage is the payload for subscribe/unsubscribe messages.
+// The topic can be given as a bare name with params, or in key form
+// ("git-status:/path/to/repo").
+type topicMessage struct {
+	Type   string            `json:"type"`
+	Topic  string            `json:"topic"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// resolveTopic validates a subscription request and returns the provider,
+// the canonical topic key and the provider params.
+func resolveTopic(msg topicMessage) (TopicProvider, string, map[string]string, error) {
+	name := msg.Topic
+	params := make(map[string]string, len(msg.Params))
+	for k, v := range msg.Params {
+		params[k] = v
+	}
+	value := ""
+	if n, v, ok := strings.Cut(name, ":"); ok {
+		name, value = n, v
+	}
+
+	provider, ok := topicProviders[name]
+	if !ok {
+		return TopicProvider{}, "", nil, fmt.Errorf("unknown topic %q", name)
+	}
+	if provider.KeyParam == "" {
+		return provider, name, params, nil
+	}
+	if value == "" {
+		value = params[provider.KeyParam]
+	}
+	if value == "" {
+		return TopicProvider{}, "", nil, fmt.Errorf("topic %s requires %q", name, provider.KeyParam)
+	}
+	params[provider.KeyParam] = value
+	return provider, name + ":" + value, params, nil
+}
+
+// Subscribe adds a client to a topic, starting its provider if needed.
+// The provider starts outside the hub's locks; clients subscribing while it
+// starts wait for it.
+func (h *Hub) Subscribe(client *Client, msg topicMessage) error {
+	provider, key, params, err := resolveTopic(msg)
+	if err != nil {
+		return err
+	}
+
+	// Held until the client is added, so a disconnect either sees the
+	// subscription (and removes it) or happened first
+	h.mu.RLock()
+	if !h.clients[client] {
+		h.mu.RUnlock()
+		return fmt.Errorf("client not connected")
+	}
+	h.topicsMu.Lock()
+	t, exists := h.topics[key]
+	if !exists {
+		t = &topic{key: key, snapshot: provider.Snapshot, clients: make(map[*Client]bool), started: make(chan struct{})}
+		h.topics[key] = t
+	}
+	t.clients[client] = true
+	h.topicsMu.Unlock()
+	client.mu.Lock()
+	client.topics[key] = true
+	client.mu.Unlock()
+	h.mu.RUnlock()
+
+	if exists {
+		<-t.started
+	} else {
+		h.startTopic(t, provider, params)
+	}
+
+	h.topicsMu.Lock()
+	startErr, last := t.err, t.last
+	h.topicsMu.Unlock()
+	if startErr != nil {
+		client.mu.Lock()
+		delete(client.topics, key)
+		client.mu.Unlock()
+		return startErr
+	}
+
+	h.SendToClient(client, map[string]interface{}{
+		"type":  "subscribed",
+		"topic": key,
+	})
+	if last != nil {
+		h.sendToConnected([]*Client{client}, last)
+	}
+	return nil
+}
+
+// startTopic runs the provider for a new topic. If it fails, the topic is
+// dropped; if every subscriber left while it started, it is stopped again.
+func (h *Hub) startTopic(t *topic, provider TopicProvider, params map[string]string) {
+	stop, err := provider.Start(params, func(data interface{}) {
+		h.publishTopic(t.key, data)
+	})
+
+	h.topicsMu.Lock()
+	t.stop, t.err = stop, err
+	current := h.topics[t.key] == t
+	if err != nil && current {
+		delete(h.topics, t.key)
+	}
+	close(t.started)
+	h.topicsMu.Unlock()
+
+	switch {
+	case err != nil:
+		log.Printf("[Topics] Failed to start %s: %v", t.key, err)
+	case !current:
+		stop()
+	default:
+		log.Printf("[Topics] Started %s", t.key)
+	}
+}
+
+// Unsubscribe removes a client from a topic, stopping the provider when the
+// last subscriber leaves. Must not be called with h.mu held.
+func (h *Hub) Unsubscribe(client *Client, key string) {
+	h.topicsMu.Lock()
+	t, ok := h.topics[key]
+	if !ok {
+		h.topicsMu.Unlock()
+		return
+	}
+	delete(t.clients, client)
+	var stop func()
+	if len(t.clients) == 0 {
+		delete(h.topics, key)
+		select {
+		case <-t.started:
+			stop = t.stop
+		default:
+			// Still starting: startTopic stops it once Start returns
+		}
+	}
+	h.topicsMu.Unlock()
+
+	client.mu.Lock()
+	delete(client.topics, key)
+	client.mu.Unlock()
+
+	if stop != nil {
+		stop()
+		log.Printf("[Topics] Stopped %s (no subscribers)", key)
+	}
+}
+
+// publishTopic sends a topic event to every subscriber.
+func (h *Hub) publishTopic(key string, data interface{}) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type":  "topic-event",
+		"topic": key,
+		"data":  data,
+	})
+	if err != nil {
+		log.Printf("[Topics] Error marshaling %s event: %v", key, err)
+		return
+	}
+
+	h.topicsMu.Lock()
+	t, ok := h.topics[key]
+	if !ok {
+		h.topicsMu.Unlock()
+		return
+	}
+	if t.snapshot {
+		t.last = message
+	}
+	clients := make([]*Client, 0, len(t.clients))
+	for c := range t.clients {
+		clients = append(clients, c)
+	}
+	h.topicsMu.Unlock()
+
+	h.sendToConnected(clients, message)
+}
+
+// sendToConnected sends a message to the clients that are still connected.
+// Like BroadcastAll it holds h.mu, so it can't race unregister closing a
+// client's send channel.
+func (h *Hub) sendToConnected(clients []*Client, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, c := range clients {
+		if !h.clients[c] {
+			continue
+		}
+		select {
+		case c.send <- message:
+		default:
+			// Skip clients with full buffers (same policy as BroadcastAll)
+		}
+	}
+}
+
+// handleTopicMessage processes subscribe/unsubscribe messages.
+func (c *Client) handleTopicMessage(raw []byte) {
+	var msg topicMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		log.Printf("[Topics] Invalid message: %v", err)
+		return
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		if err := c.hub.Subscribe(c, msg); err != nil {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":  "subscribe-error",
+				"topic": msg.Topic,
+				"error": err.Error(),
+			})
+		}
+
+	case "unsubscribe":
+		_, key, _, err := resolveTopic(msg)
+		if err != nil {
+			return
+		}
+		c.hub.Unsubscribe(c, key)
+		c.hub.SendToClient(c, map[string]interface{}{
+			"type":  "unsubscribed",
+			"topic": key,
+		})
+	}
+}
+
+// --- Provider helpers ---
+
+// debouncer coalesces bursts of filesystem events into a single call.
+type debouncer struct {
+	delay time.Duration
+	fn    func()
+	timer *time.Timer
+	mu    sync.Mutex
+}
+
+func newDebouncer(delay time.Duration, fn func()) *debouncer {
+	return &debouncer{delay: delay, fn: fn}
+}
+
+func (d *debouncer) trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, d.fn)
+}
+
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// runWatcher feeds fsnotify events to onEvent until done is closed, then
+// closes the watcher.
+func runWatcher(w *fsnotify.Watcher, done chan struct{}, onEvent func(fsnotify.Event)) {
+	defer w.Close()
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			onEvent(event)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[Topics] Watcher error: %v", err)
+		}
+	}
+}
+
+// addTreeToWatcher adds root and its non-ignored subdirectories to w.
+func addTreeToWatcher(w *fsnotify.Watcher, root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue on error
+		}
+		if info.IsDir() {
+			if path != root && (info.Name() == ".git" || utils.ShouldIgnoreDir(info.Name())) {
+				return filepath.SkipDir
+			}
+			w.Add(path)
+		}
+		return nil
+	})
+}
+
+// publishIfChanged publishes data only when its JSON encoding differs from
+// the previous call, so no-op filesystem churn does not reach clients.
+func publishIfChanged(publish func(data interface{})) func(data interface{}) {
+	var last []byte
+	var mu sync.Mutex
+	return func(data interface{}) {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		changed := !bytes.Equal(encoded, last)
+		last = encoded
+		mu.Unlock()
+		if changed {
+			publish(data)
+		}
+	}
+}
+
+// --- Providers ---
+
+// startGitStatusTopic watches a repository's working tree and .git metadata
+// (index, HEAD, refs) and publishes `git status` whenever either changes.
+func startGitStatusTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	repo := filepath.Clean(params["repo"])
+	if !isValidPath(repo) {
+		return nil, fmt.Errorf("invalid repo path")
+	}
+	gitRoot := handlers.FindGitRoot(repo)
+	if gitRoot == "" {
+		return nil, fmt.Errorf("not a git repository: %s", repo)
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	publish = publishIfChanged(publish)
+	refresh := newDebouncer(300*time.Millisecond, func() {
+		publish(handlers.GitStatusSnapshot(gitRoot))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		addTreeToWatcher(w, gitRoot)
+		gitDir := filepath.Join(gitRoot, ".git")
+		for _, dir := range []string{gitDir, filepath.Join(gitDir, "refs", "heads")} {
+			w.Add(dir)
+		}
+		publish(handlers.GitStatusSnapshot(gitRoot))
+	}()
+	go runWatcher(w, done, func(event fsnotify.Event) {
+		// Ignore lock-file churn from git itself
+		if strings.HasSuffix(event.Name, ".lock") {
+			return
+		}
+		if event.Op&fsnotify.Create != 0 {
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !utils.ShouldIgnoreDir(info.Name()) {
+				addTreeToWatcher(w, event.Name)
+			}
+		}
+		refresh.trigger()
+	})
+
+	return func() {
+		refresh.stop()
+		close(done)
+	}, nil
+}
+
+// startBeadsTopic watches {path}/.beads/issues.jsonl and publishes the issue
+// list whenever it changes.
+func startBeadsTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	root := filepath.Clean(params["path"])
+	if !isValidPath(root) {
+		return nil, fmt.Errorf("invalid path")
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	beadsDir := filepath.Join(root, ".beads")
+	send := func() {
+		issues := handlers.LoadBeadsIssues(root)
+		publish(map[string]interface{}{
+			"issues": issues,
+			"count":  len(issues),
+		})
+	}
+	refresh := newDebouncer(200*time.Millisecond, send)
+
+	// Watch the project root too so a freshly created .beads dir is picked up.
+	w.Add(root)
+	w.Add(beadsDir)
+	go send()
+
+	done := make(chan struct{})
+	go runWatcher(w, done, func(event fsnotify.Event) {
+		if event.Name == beadsDir && event.Op&fsnotify.Create != 0 {
+			w.Add(beadsDir)
+			refresh.trigger()
+			return
+		}
+		if filepath.Dir(event.Name) == beadsDir && filepath.Base(event.Name) == "issues.jsonl" {
+			refresh.trigger()
+		}
+	})
+
+	return func() {
+		refresh.stop()
+		close(done)
+	}, nil
+}
+
+// startChatTopic forwards a conversation's stream events as they are
+// produced by the Claude CLI process. Events already buffered for an
+// in-flight stream are replayed first; live events arriving meanwhile are
+// held back so the order is kept.
+func startChatTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	convID := params["conversationId"]
+
+	var mu sync.Mutex
+	var pending []interface{}
+	replaying := true
+	events, completed, unsubscribe := handlers.SubscribeChatEvents(convID, func(data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if replaying {
+			pending = append(pending, data)
+			return
+		}
+		publish(data)
+	})
+
+	go func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ev := range events {
+			publish(ev)
+		}
+		if completed {
+			publish(map[string]interface{}{
+				"type":           "stream-complete",
+				"conversationId": convID,
+			})
+		}
+		for _, data := range pending {
+			publish(data)
+		}
+		pending, replaying = nil, false
+	}()
+
+	return unsubscribe, nil
+}
+
+// startExecTopic forwards a command run's output and exit events, replaying
+// what was produced before the subscription.
+func startExecTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	runID := params["runId"]
+
+	var mu sync.Mutex
+	var pending []interface{}
+	replaying := true
+	events, unsubscribe, ok := handlers.SubscribeExecEvents(runID, func(data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if replaying {
+			pending = append(pending, data)
+			return
+		}
+		publish(data)
+	})
+	if !ok {
+		return nil, fmt.Errorf("run %s not found", runID)
+	}
+
+	go func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ev := range events {
+			publish(ev)
+		}
+		for _, data := range pending {
+			publish(data)
+		}
+		pending, replaying = nil, false
+	}()
+
+	return unsubscribe, nil
+}
+
+// startTasksTopic forwards a workspace's task status changes and output,
+// starting with the current task list. Earlier output is fetched over HTTP.
+func startTasksTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	workspace := params["workspace"]
+	unsubscribe, err := handlers.SubscribeTaskEvents(workspace, publish)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if event, err := handlers.TaskWorkspaceEvents(workspace); err == nil {
+			publish(event)
+		}
+	}()
+
+	return unsubscribe, nil
+}
+
+// startTerminalPaneTopic streams one tmux pane ("%3") of a terminal.
+func startTerminalPaneTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	return handlers.StreamPane(params["pane"], publish)
+}
+
+// claudeSessionWindow is how recently a conversation file must have been
+// written to count as an active Claude session.
+const claudeSessionWindow = 30 * time.Minute
+
+// startClaudeSessionsTopic watches ~/.claude/projects and publishes the list
+// of recently active Claude sessions whenever a conversation file is written.
+func startClaudeSessionsTopic(params map[string]string, publish func(data interface{})) (func(), error) {
+	projectsDir := handlers.ClaudeProjectsDir()
+	if _, err := os.Stat(projectsDir); err != nil {
+		return nil, fmt.Errorf("no Claude projects directory found")
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var activeMu sync.Mutex
+	active := ""
+	send := func() {
+		sessions, err := handlers.RecentClaudeSessions(claudeSessionWindow)
+		if err != nil {
+			return
+		}
+		activeMu.Lock()
+		activePath := active
+		activeMu.Unlock()
+		publish(map[string]interface{}{
+			"sessions":   sessions,
+			"activePath": activePath,
+		})
+	}
+	refresh := newDebouncer(time.Second, send)
+
+	w.Add(projectsDir)
+	if entries, err := os.ReadDir(projectsDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				w.Add(filepath.Join(projectsDir, entry.Name()))
+			}
+		}
+	}
+	go send()
+
+	done := make(chan struct{})
+	go runWatcher(w, done, func(event fsnotify.Event) {
+		// New project directory
+		if filepath.Dir(event.Name) == projectsDir && event.Op&fsnotify.Create != 0 {
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				w.Add(event.Name)
+			}
+			return
+		}
+		if strings.HasSuffix(event.Name, ".jsonl") && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+			activeMu.Lock()
+			active = event.Name
+			activeMu.Unlock()
+			refresh.trigger()
+		}
+	})
+
+	return func() {
+		refresh.stop()
+		close(done)
+	}, nil
+}
@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ---- Topic tests ----
+
+// testProvider registers a topic family for one test.
+func testProvider(t *testing.T, name string, provider TopicProvider) {
+	t.Helper()
+	topicProviders[name] = provider
+	t.Cleanup(func() { delete(topicProviders, name) })
+}
+
+func TestTopics_SnapshotReplayAndStop(t *testing.T) {
+	h := newTestHub(t)
+	var publish func(data interface{})
+	var starts, stops atomic.Int32
+	testProvider(t, "test-snapshot", TopicProvider{KeyParam: "id", Snapshot: true,
+		Start: func(params map[string]string, pub func(data interface{})) (func(), error) {
+			starts.Add(1)
+			publish = pub
+			return func() { stops.Add(1) }, nil
+		}})
+
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+	if err := h.Subscribe(a, topicMessage{Topic: "test-snapshot:1"}); err != nil {
+		t.Fatal(err)
+	}
+	nextMessage(t, a, "subscribed")
+	publish(map[string]int{"n": 1})
+	if ev := nextMessage(t, a, "topic-event"); ev["topic"] != "test-snapshot:1" {
+		t.Errorf("unexpected event %v", ev)
+	}
+
+	// A later subscriber shares the provider and gets the last event
+	if err := h.Subscribe(b, topicMessage{Topic: "test-snapshot", Params: map[string]string{"id": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	nextMessage(t, b, "subscribed")
+	if ev := nextMessage(t, b, "topic-event"); ev["data"].(map[string]interface{})["n"] != 1.0 {
+		t.Errorf("unexpected replay %v", ev)
+	}
+	if starts.Load() != 1 {
+		t.Errorf("provider started %d times", starts.Load())
+	}
+
+	h.Unsubscribe(a, "test-snapshot:1")
+	if stops.Load() != 0 {
+		t.Error("provider stopped while b is subscribed")
+	}
+	h.Unsubscribe(b, "test-snapshot:1")
+	if stops.Load() != 1 {
+		t.Errorf("provider stopped %d times, want 1", stops.Load())
+	}
+}
+
+func TestTopics_DisconnectStopsProviderOutsideHubLock(t *testing.T) {
+	h := newTestHub(t)
+	stopped := make(chan struct{})
+	testProvider(t, "test-reentrant", TopicProvider{
+		Start: func(params map[string]string, publish func(data interface{})) (func(), error) {
+			// Calling into the hub from Start and stop must not deadlock
+			h.listPresence()
+			return func() {
+				h.BroadcastAll(map[string]string{"type": "test-stopped"})
+				close(stopped)
+			}, nil
+		}})
+
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+	if err := h.Subscribe(a, topicMessage{Topic: "test-reentrant"}); err != nil {
+		t.Fatal(err)
+	}
+	h.unregister <- a
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("provider not stopped on disconnect (hub deadlocked?)")
+	}
+	nextMessage(t, b, "test-stopped")
+	nextMessage(t, b, "presence-left")
+}
+
+func TestTopics_SubscribersWaitForSlowStart(t *testing.T) {
+	h := newTestHub(t)
+	release := make(chan error)
+	var starts atomic.Int32
+	testProvider(t, "test-slow", TopicProvider{KeyParam: "id",
+		Start: func(params map[string]string, publish func(data interface{})) (func(), error) {
+			starts.Add(1)
+			if err := <-release; err != nil {
+				return nil, err
+			}
+			return func() {}, nil
+		}})
+
+	subscribeAll := func(key string, clients ...*Client) []error {
+		errs := make([]error, len(clients))
+		var wg sync.WaitGroup
+		for i, c := range clients {
+			wg.Add(1)
+			go func(i int, c *Client) {
+				defer wg.Done()
+				errs[i] = h.Subscribe(c, topicMessage{Topic: key})
+			}(i, c)
+			time.Sleep(20 * time.Millisecond) // the first one starts the provider
+		}
+		// The hub keeps serving other clients while the provider starts
+		connectTestClient(t, h, "other")
+		release <- nil
+		wg.Wait()
+		return errs
+	}
+
+	a, b := connectTestClient(t, h, "a"), connectTestClient(t, h, "b")
+	for _, err := range subscribeAll("test-slow:ok", a, b) {
+		if err != nil {
+			t.Errorf("subscribe: %v", err)
+		}
+	}
+	nextMessage(t, a, "subscribed")
+	nextMessage(t, b, "subscribed")
+	if starts.Load() != 1 {
+		t.Errorf("provider started %d times, want 1", starts.Load())
+	}
+
+	// A failed start fails every waiting subscriber and drops the topic
+	c, d := connectTestClient(t, h, "c"), connectTestClient(t, h, "d")
+	errs := make(chan error, 2)
+	go func() { errs <- h.Subscribe(c, topicMessage{Topic: "test-slow:bad"}) }()
+	time.Sleep(20 * time.Millisecond)
+	go func() { errs <- h.Subscribe(d, topicMessage{Topic: "test-slow:bad"}) }()
+	time.Sleep(20 * time.Millisecond)
+	release <- errors.New("boom")
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil || err.Error() != "boom" {
+			t.Errorf("subscribe error = %v, want boom", err)
+		}
+	}
+	h.topicsMu.Lock()
+	_, exists := h.topics["test-slow:bad"]
+	h.topicsMu.Unlock()
+	if exists || c.topics["test-slow:bad"] || d.topics["test-slow:bad"] {
+		t.Error("failed topic left behind")
+	}
+}
+
+func TestTopics_LeavingDuringStartStopsProvider(t *testing.T) {
+	h := newTestHub(t)
+	release := make(chan struct{})
+	stopped := make(chan struct{})
+	testProvider(t, "test-leave", TopicProvider{
+		Start: func(params map[string]string, publish func(data interface{})) (func(), error) {
+			<-release
+			return func() { close(stopped) }, nil
+		}})
+
+	a := connectTestClient(t, h, "a")
+	done := make(chan error)
+	go func() { done <- h.Subscribe(a, topicMessage{Topic: "test-leave"}) }()
+	time.Sleep(20 * time.Millisecond)
+	h.Unsubscribe(a, "test-leave")
+	close(release)
+	<-done
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("provider started for a topic nobody is subscribed to was not stopped")
+	}
+}
@@ -6,6 +6,7 @@ import { FilePickerModal } from './FilePickerModal';
 import { useTerminal, type TerminalTab, type RecoveredSession, type TerminalListResponse } from '../hooks/useTerminal';
 import { generateTerminalId, generateProfileId } from '../utils/terminalUtils';
 import type { ThemeId } from '../themes';
+import { getAuthToken } from '../lib/api';
 
 const API_BASE = 'http://localhost:8130';
 
@@ -671,11 +672,13 @@ export function TerminalPanel({
 
   const saveProfilesToBackend = useCallback((updatedProfiles: TerminalProfile[]) => {
     setProfiles(updatedProfiles);
-    fetch(`${API_BASE}/api/terminal/profiles`, {
-      method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify(updatedProfiles),
-    }).catch((err) => console.error('[TerminalPanel] Failed to save profiles:', err));
+    getAuthToken()
+      .then((token) => fetch(`${API_BASE}/api/terminal/profiles`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'X-Auth-Token': token },
+        body: JSON.stringify(updatedProfiles),
+      }))
+      .catch((err) => console.error('[TerminalPanel] Failed to save profiles:', err));
   }, []);
 
   const handleProfileSave = useCallback((savedProfile: TerminalProfile) => {
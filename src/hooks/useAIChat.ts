@@ -5,6 +5,7 @@ import {
   createConversation as createConversationAPI,
   updateConversation as updateConversationAPI,
   deleteConversationAPI,
+  getAuthToken,
   type StoredConversation,
   type StoredMessage,
 } from '../lib/api';
@@ -424,8 +425,10 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
     }
 
     try {
+      const token = await getAuthToken();
       await fetch(`${API_BASE}/api/chat/process?conversationId=${encodeURIComponent(id)}`, {
         method: 'DELETE',
+        headers: { 'X-Auth-Token': token },
       });
     } catch (err) {
       console.warn('[useAIChat] Failed to kill backend process:', err);
@@ -821,9 +824,10 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
      * On retry, it carries the last successfully received event ID.
      */
     const connectSSE = async (reconnectEventId?: number): Promise<'completed' | 'interrupted'> => {
+      const token = await getAuthToken();
       const response = await fetch(`${API_BASE}/api/chat`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'X-Auth-Token': token },
         body: buildRequestBody(reconnectEventId),
         signal: abortController.signal,
       });
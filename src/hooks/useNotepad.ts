@@ -1,4 +1,5 @@
 import { useState, useCallback, useRef } from 'react';
+import { getAuthToken } from '../lib/api';
 
 const API_BASE = 'http://localhost:8130';
 
@@ -86,9 +87,10 @@ export function useNotepad({ workspacePath, onConversationReady }: UseNotepadOpt
 
       abortRef.current = new AbortController();
 
+      const token = await getAuthToken();
       const res = await fetch(`${API_BASE}/api/notepad`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'X-Auth-Token': token },
         body: JSON.stringify(body),
         signal: abortRef.current.signal,
       });
@@ -145,8 +147,10 @@ export function useNotepad({ workspacePath, onConversationReady }: UseNotepadOpt
     abortRef.current?.abort();
     if (state.sessionId) {
       try {
+        const token = await getAuthToken();
         await fetch(`${API_BASE}/api/notepad?sessionId=${state.sessionId}`, {
           method: 'DELETE',
+          headers: { 'X-Auth-Token': token },
         });
       } catch {
         // Best effort
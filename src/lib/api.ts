@@ -145,9 +145,10 @@ export async function checkBackendHealth(): Promise<boolean> {
  * Open a file or directory in VS Code
  */
 export async function openInEditor(path: string): Promise<void> {
+  const token = await getAuthToken();
   const response = await fetch(`${API_BASE}/api/files/open`, {
     method: 'POST',
-    headers: { 'Content-Type': 'application/json' },
+    headers: { 'Content-Type': 'application/json', 'X-Auth-Token': token },
     body: JSON.stringify({ path }),
   });
   if (!response.ok) {